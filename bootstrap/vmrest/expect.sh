@@ -1,7 +1,7 @@
 #!/usr/bin/expect -f
 
-set username [lindex $argv 0]
-set password [lindex $argv 1]
+set username $env(VIX_USERNAME)
+set password $env(VIX_PASSWORD)
 
 set timeout -1
 spawn vmrest -C
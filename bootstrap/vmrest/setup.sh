@@ -1,11 +1,11 @@
 #!/bin/bash
 
 # Generate credentials
-boots secrets set vix-username admin
-boots secrets generate -l 12 -n 1 -s 1 vix-password
-
-USER=$(boots secrets get vix-username)
-PASS=$(boots secrets get vix-password)
+boots secret set vix-username admin
+boots secret generate --if-missing -l 12 -n 1 -s 1 vix-password
 
 # Setup vmrest
-sudo ./expect.sh "$USER" "$PASS"
\ No newline at end of file
+boots secret exec \
+    --map VIX_USERNAME=vix-username \
+    --map VIX_PASSWORD=vix-password \
+    -- sudo --preserve-env=VIX_USERNAME,VIX_PASSWORD ./expect.sh
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ArtifactProvider represents a source of signed release archives for the
+// binaries which make up the stack.
+type ArtifactProvider interface {
+	// Fetch returns a network stream containing the contents of the release
+	// archive for the given product and version on the given platform.
+	Fetch(product, version, os, arch string) (io.ReadCloser, int64, error)
+
+	// Resolve returns the location and version of the release archive for the
+	// given product and version on the given platform.
+	Resolve(product, version, os, arch string) (Source, error)
+
+	// Validate takes a stream containing a release archive and validates it
+	// against the remote signed checksums for the given product and version.
+	Validate(data io.ReadCloser, product, version, os, arch string) (Signer, error)
+}
+
+// Verifier represents a strategy for validating data against a detached
+// signature.
+type Verifier interface {
+	// Extension returns the suffix appended to the filename of signed data in
+	// order to locate its detached signature.
+	Extension() string
+
+	// Verify validates the given data against the given detached signature and
+	// returns the signer.
+	Verify(data io.Reader, signature io.Reader) (Signer, error)
+}
+
+// Signer describes the key which produced a validated signature.
+type Signer struct {
+	Fingerprint string `json:"fingerprint"`
+	Identity    string `json:"identity"`
+}
+
+// Source describes the resolved location and version of a remote artifact.
+type Source struct {
+	URL     string `json:"url"`
+	Version string `json:"version"`
+}
@@ -0,0 +1,106 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_access_key = "aws-access-key"
+	flag_secret_key = "aws-secret-key"
+	flag_region     = "aws-region"
+)
+
+// credentialFlags returns the CLI flags shared by all AWS providers for
+// configuring credentials and the target region.
+func credentialFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_access_key,
+			Usage: "AWS access key ID (default: $AWS_ACCESS_KEY_ID)",
+		},
+		&cli.StringFlag{
+			Name:  flag_secret_key,
+			Usage: "AWS secret key ID (default: $AWS_SECRET_ACCESS_KEY)",
+		},
+		&cli.StringFlag{
+			Name:  flag_region,
+			Usage: "AWS region (default: $AWS_REGION)",
+		},
+	}
+}
+
+// newConfig creates a new aws.Config by parsing the credential flags contained
+// within the passed cli.Context.
+func newConfig(c *cli.Context) (*aws.Config, error) {
+	config := aws.NewConfig()
+
+	if c.IsSet(flag_access_key) || c.IsSet(flag_secret_key) {
+		if !(c.IsSet(flag_access_key) && c.IsSet(flag_secret_key)) {
+			return nil, fmt.Errorf("must supply both access and secret keys")
+		}
+
+		log.Info("Configuring static credentials")
+		creds := credentials.NewCredentials(&credentials.StaticProvider{
+			Value: credentials.Value{
+				AccessKeyID:     c.String(flag_access_key),
+				SecretAccessKey: c.String(flag_secret_key),
+				ProviderName:    "flags",
+			},
+		})
+
+		config = config.WithCredentials(creds)
+	}
+
+	if c.IsSet(flag_region) {
+		log.Infof("Using %s region", c.String(flag_region))
+		config.Region = aws.String(c.String(flag_region))
+	}
+
+	if c.Bool("debug") {
+		config.LogLevel = aws.LogLevel(aws.LogDebug)
+	}
+
+	return config, nil
+}
+
+// parseKMSKeyMap parses rules mapping path prefixes to KMS keys in the form
+// PREFIX=KEY.
+func parseKMSKeyMap(rules []string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid KMS key mapping: %s", rule)
+		}
+		keys[parts[0]] = parts[1]
+	}
+
+	return keys, nil
+}
+
+// kmsKeyID returns the KMS key mapped to the longest path prefix matching the
+// given secret key, falling back to the default key. Returns nil to use the
+// account default if neither apply.
+func kmsKeyID(key string, defaultKey string, keys map[string]string) *string {
+	var match string
+	for prefix := range keys {
+		if (key == prefix || gcli.MatchSecretPath(key, prefix, true)) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+
+	if match != "" {
+		return aws.String(keys[match])
+	} else if defaultKey != "" {
+		return aws.String(defaultKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_s3_bucket   = "aws-s3-bucket"
+	flag_s3_endpoint = "aws-s3-endpoint"
+	flag_s3_prefix   = "aws-s3-prefix"
+)
+
+// ImageProvider implements cli.ImageProvider and cli.ImagePublisher using an S3
+// compatible bucket as the backend. Images are stored using the same layout as
+// the upstream release servers with the channel as the top-level prefix:
+//
+//	<prefix>/<channel>/<arch>-usr/current/<filename>
+//
+// Signatures are stored alongside their respective image using the extension
+// of the configured verifier.
+type ImageProvider struct {
+	bucket   string
+	prefix   string
+	s3       s3iface.S3API
+	verifier gcli.Verifier
+}
+
+// buildKey returns the object key for the requested Container Linux production
+// image file.
+func (i *ImageProvider) buildKey(channel string, arch string, filename string) string {
+	key := path.Join(i.prefix, channel, fmt.Sprintf("%s-usr", arch), "current", filename)
+	return strings.TrimPrefix(key, "/")
+}
+
+// buildURL returns the s3:// URL of the object with the given key.
+func (i *ImageProvider) buildURL(key string) string {
+	return fmt.Sprintf("s3://%s/%s", i.bucket, key)
+}
+
+// sourceKey returns the object key of the given source, which must be an
+// object in the configured bucket.
+func (i *ImageProvider) sourceKey(source gcli.Source) (string, error) {
+	prefix := i.buildURL("")
+	if !strings.HasPrefix(source.URL, prefix) || source.URL == prefix {
+		return "", fmt.Errorf("source is not an object in bucket %s: %s", i.bucket, source.URL)
+	}
+
+	return strings.TrimPrefix(source.URL, prefix), nil
+}
+
+// download downloads the object with the given key, returning a stream of data
+// and it's expected size.
+func (i *ImageProvider) download(key string) (io.ReadCloser, int64, error) {
+	log.Infof("Sending get request for object: %s", key)
+	in := s3.GetObjectInput{
+		Bucket: &i.bucket,
+		Key:    &key,
+	}
+
+	out, err := i.s3.GetObject(&in)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, 0, fmt.Errorf("object not found: %s", key)
+		}
+
+		return nil, 0, fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	log.WithFields(log.Fields{
+		"length": aws.Int64Value(out.ContentLength),
+	}).Debug("Response received")
+
+	return out.Body, aws.Int64Value(out.ContentLength), nil
+}
+
+// upload uploads the given data to an object with the given key.
+func (i *ImageProvider) upload(key string, data io.ReadSeeker) error {
+	log.Infof("Sending put request for object: %s", key)
+	in := s3.PutObjectInput{
+		Bucket: &i.bucket,
+		Key:    &key,
+		Body:   data,
+	}
+
+	_, err := i.s3.PutObject(&in)
+	if err != nil {
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return nil
+}
+
+func (i *ImageProvider) Fetch(source gcli.Source) (io.ReadCloser, int64, error) {
+	key, err := i.sourceKey(source)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return i.download(key)
+}
+
+func (i *ImageProvider) Resolve(channel, arch, filename string) (gcli.Source, error) {
+	source := gcli.Source{
+		URL: i.buildURL(i.buildKey(channel, arch, filename)),
+	}
+
+	// Mirrors are not required to carry the version file, in which case the
+	// version is left unresolved.
+	data, _, err := i.download(i.buildKey(channel, arch, "version.txt"))
+	if err != nil {
+		log.Warnf("Unable to resolve image version: %s", err)
+		return source, nil
+	}
+	defer data.Close()
+
+	source.Version, err = gcli.ParseImageVersion(data)
+	if err != nil {
+		return gcli.Source{}, err
+	}
+
+	return source, nil
+}
+
+func (i *ImageProvider) Validate(data io.ReadCloser, source gcli.Source) (gcli.Signer, error) {
+	log.WithFields(log.Fields{
+		"url":     source.URL,
+		"version": source.Version,
+	}).Debug("Validating file with signature")
+	key, err := i.sourceKey(source)
+	if err != nil {
+		return gcli.Signer{}, err
+	}
+
+	sig, _, err := i.download(key + i.verifier.Extension())
+	if err != nil {
+		log.Errorf("Error downloading signature file: %s", err)
+		return gcli.Signer{}, err
+	}
+	defer sig.Close()
+
+	return i.verifier.Verify(data, sig)
+}
+
+func (i *ImageProvider) Publish(data io.ReadSeeker, signature io.ReadSeeker, channel, arch, filename string) error {
+	log.WithFields(log.Fields{
+		"channel":      channel,
+		"architecture": arch,
+		"filename":     filename,
+	}).Debug("Validating file before publishing")
+	if _, err := i.verifier.Verify(data, signature); err != nil {
+		return err
+	}
+
+	for _, r := range []io.ReadSeeker{data, signature} {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	// The signature is uploaded last so that its presence always indicates a
+	// complete image.
+	key := i.buildKey(channel, arch, filename)
+	if err := i.upload(key, data); err != nil {
+		return err
+	}
+
+	return i.upload(fmt.Sprintf("%s%s", key, i.verifier.Extension()), signature)
+}
+
+// NewImageProvider creates a new instance of ImageProvider using the given
+// configuration. Images are validated using the given verifier or, if no
+// verifier is given, against the Flatcar image signing key.
+func NewImageProvider(config ImageProviderConfig, verifier gcli.Verifier) ImageProvider {
+	sess := session.Must(session.NewSession(config.config))
+	s3 := s3.New(sess)
+
+	if verifier == nil {
+		verifier = pgp.NewVerifier(&pgp.OpenPGPClient{}, pgp.FlatcarKey)
+	}
+
+	return ImageProvider{
+		bucket:   config.bucket,
+		prefix:   config.prefix,
+		s3:       s3,
+		verifier: verifier,
+	}
+}
+
+// ImageProviderConfig provides the configuration details needed for
+// instantiating a new ImageProvider.
+type ImageProviderConfig struct {
+	bucket string
+	config *aws.Config
+	prefix string
+}
+
+// ImageFlags returns the CLI flags that can be used to configure the AWS image
+// provider.
+func ImageFlags() []cli.Flag {
+	return append(credentialFlags(),
+		&cli.StringFlag{
+			Name:  flag_s3_bucket,
+			Usage: "S3 bucket containing images",
+		},
+		&cli.StringFlag{
+			Name:  flag_s3_endpoint,
+			Usage: "S3 compatible endpoint to use instead of AWS (i.e. MinIO)",
+		},
+		&cli.StringFlag{
+			Name:  flag_s3_prefix,
+			Usage: "S3 key prefix under which the release tree is stored",
+		},
+	)
+}
+
+// NewImageProviderConfig creates a new ImageProviderConfig by parsing CLI flags
+// contained within the passed cli.Context.
+func NewImageProviderConfig(c *cli.Context) (ImageProviderConfig, error) {
+	if c.String(flag_s3_bucket) == "" {
+		return ImageProviderConfig{}, fmt.Errorf("must supply a bucket")
+	}
+
+	config, err := newConfig(c)
+	if err != nil {
+		return ImageProviderConfig{}, err
+	}
+
+	if c.IsSet(flag_s3_endpoint) {
+		log.Infof("Using %s endpoint", c.String(flag_s3_endpoint))
+		config.Endpoint = aws.String(c.String(flag_s3_endpoint))
+
+		// S3 compatible services generally don't support virtual-hosted
+		// buckets and ignore the region, though the SDK still requires one.
+		config.S3ForcePathStyle = aws.Bool(true)
+		if config.Region == nil {
+			config.Region = aws.String("us-east-1")
+		}
+	}
+
+	return ImageProviderConfig{
+		bucket: c.String(flag_s3_bucket),
+		config: config,
+		prefix: c.String(flag_s3_prefix),
+	}, nil
+}
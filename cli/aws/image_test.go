@@ -0,0 +1,317 @@
+package aws
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/openpgp"
+)
+
+type mockS3 struct {
+	s3iface.S3API
+	fnGet func(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	fnPut func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+func (m *mockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return m.fnGet(input)
+}
+
+func (m *mockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return m.fnPut(input)
+}
+
+type mockPGPClient struct {
+	fnCheckDetachedSignature func(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error)
+}
+
+func (m *mockPGPClient) ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	return openpgp.EntityList{}, nil
+}
+
+func (m *mockPGPClient) CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error) {
+	return m.fnCheckDetachedSignature(keyring, signed, signature)
+}
+
+// minio is a minimal stand-in for an S3 compatible service which stores
+// objects in memory using path-style addressing.
+type minio struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *minio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := m.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data)
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		m.objects[r.URL.Path] = data
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestBuildKey(t *testing.T) {
+	is := is.New(t)
+
+	provider := ImageProvider{}
+	is.Equal(provider.buildKey("alpha", "arm64", "image.bin"), "alpha/arm64-usr/current/image.bin")
+
+	provider = ImageProvider{prefix: "/mirror/flatcar"}
+	is.Equal(provider.buildKey("alpha", "arm64", "image.bin"), "mirror/flatcar/alpha/arm64-usr/current/image.bin")
+}
+
+func TestImageFetch(t *testing.T) {
+	is := is.New(t)
+	expected_data := "test"
+
+	// With no error
+	var got_bucket string
+	var got_key string
+	provider := ImageProvider{
+		bucket: "bucket",
+		s3: &mockS3{
+			fnGet: func(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+				got_bucket = *input.Bucket
+				got_key = *input.Key
+				return &s3.GetObjectOutput{
+					Body:          io.NopCloser(strings.NewReader(expected_data)),
+					ContentLength: aws.Int64(int64(len(expected_data))),
+				}, nil
+			},
+		},
+	}
+
+	data, size, err := provider.Fetch(gcli.Source{URL: "s3://bucket/alpha/arm64-usr/current/image.bin"})
+	is.NoErr(err)
+	is.Equal(got_bucket, "bucket")
+	is.Equal(got_key, "alpha/arm64-usr/current/image.bin")
+	is.Equal(size, int64(len(expected_data)))
+
+	got_data, err := io.ReadAll(data)
+	is.NoErr(err)
+	is.Equal(string(got_data), expected_data)
+
+	// With source in another bucket
+	_, _, err = provider.Fetch(gcli.Source{URL: "s3://other/alpha/arm64-usr/current/image.bin"})
+	is.Equal(err.Error(), "source is not an object in bucket bucket: s3://other/alpha/arm64-usr/current/image.bin")
+
+	// With missing object
+	provider = ImageProvider{
+		bucket: "bucket",
+		s3: &mockS3{
+			fnGet: func(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+				return nil, awserr.New(s3.ErrCodeNoSuchKey, "", fmt.Errorf(""))
+			},
+		},
+	}
+
+	_, _, err = provider.Fetch(gcli.Source{URL: "s3://bucket/alpha/arm64-usr/current/image.bin"})
+	is.Equal(err.Error(), "object not found: alpha/arm64-usr/current/image.bin")
+}
+
+func TestImageValidate(t *testing.T) {
+	is := is.New(t)
+	expected_data := "test"
+	expected_sig_data := "testsignature"
+
+	// With no error
+	var got_key string
+	var got_data string
+	var got_sig_data string
+	mock_pgp := mockPGPClient{
+		fnCheckDetachedSignature: func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+			data, _ := io.ReadAll(signed)
+			got_data = string(data)
+
+			data, _ = io.ReadAll(signature)
+			got_sig_data = string(data)
+
+			return nil, nil
+		},
+	}
+	source := gcli.Source{URL: "s3://bucket/alpha/arm64-usr/current/image.bin"}
+	provider := ImageProvider{
+		bucket:   "bucket",
+		verifier: pgp.NewVerifier(&mock_pgp, pgp.FlatcarKey),
+		s3: &mockS3{
+			fnGet: func(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+				got_key = *input.Key
+				return &s3.GetObjectOutput{
+					Body: io.NopCloser(strings.NewReader(expected_sig_data)),
+				}, nil
+			},
+		},
+	}
+
+	_, err := provider.Validate(io.NopCloser(strings.NewReader(expected_data)), source)
+	is.NoErr(err)
+	is.Equal(got_key, "alpha/arm64-usr/current/image.bin.sig")
+	is.Equal(got_data, expected_data)
+	is.Equal(got_sig_data, expected_sig_data)
+
+	// With failed validation
+	mock_pgp.fnCheckDetachedSignature = func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	_, err = provider.Validate(io.NopCloser(strings.NewReader(expected_data)), source)
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+}
+
+func TestImagePublish(t *testing.T) {
+	is := is.New(t)
+	expected_data := "test"
+	expected_sig_data := "testsignature"
+
+	// With no error
+	got := make(map[string]string)
+	mock_pgp := mockPGPClient{
+		fnCheckDetachedSignature: func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+			io.ReadAll(signed)
+			io.ReadAll(signature)
+			return nil, nil
+		},
+	}
+	provider := ImageProvider{
+		verifier: pgp.NewVerifier(&mock_pgp, pgp.FlatcarKey),
+		s3: &mockS3{
+			fnPut: func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+				data, _ := io.ReadAll(input.Body)
+				got[*input.Key] = string(data)
+				return nil, nil
+			},
+		},
+	}
+
+	err := provider.Publish(strings.NewReader(expected_data), strings.NewReader(expected_sig_data), "alpha", "arm64", "image.bin")
+	is.NoErr(err)
+	is.Equal(got["alpha/arm64-usr/current/image.bin"], expected_data)
+	is.Equal(got["alpha/arm64-usr/current/image.bin.sig"], expected_sig_data)
+
+	// With failed validation
+	got = make(map[string]string)
+	mock_pgp.fnCheckDetachedSignature = func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	err = provider.Publish(strings.NewReader(expected_data), strings.NewReader(expected_sig_data), "alpha", "arm64", "image.bin")
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+	is.Equal(len(got), 0)
+}
+
+func TestImageProviderMinIO(t *testing.T) {
+	is := is.New(t)
+	server := &minio{objects: make(map[string][]byte)}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	set := flag.NewFlagSet("test", 0)
+	set.String(flag_access_key, "test", "test")
+	set.String(flag_secret_key, "test", "test")
+	set.String(flag_s3_bucket, "test", "test")
+	set.String(flag_s3_endpoint, "test", "test")
+	set.String(flag_s3_prefix, "test", "test")
+	_ = set.Parse([]string{
+		fmt.Sprintf("--%s", flag_access_key), "minio",
+		fmt.Sprintf("--%s", flag_secret_key), "minio123",
+		fmt.Sprintf("--%s", flag_s3_bucket), "images",
+		fmt.Sprintf("--%s", flag_s3_endpoint), ts.URL,
+		fmt.Sprintf("--%s", flag_s3_prefix), "flatcar",
+	})
+
+	ctx := cli.NewContext(&cli.App{}, set, nil)
+	config, err := NewImageProviderConfig(ctx)
+	is.NoErr(err)
+	is.Equal(*config.config.Region, "us-east-1")
+	is.True(*config.config.S3ForcePathStyle)
+
+	provider := NewImageProvider(config, pgp.NewVerifier(&mockPGPClient{
+		fnCheckDetachedSignature: func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+			io.ReadAll(signed)
+			io.ReadAll(signature)
+			return nil, nil
+		},
+	}, pgp.FlatcarKey))
+
+	err = provider.Publish(bytes.NewReader([]byte("test")), bytes.NewReader([]byte("testsignature")), "stable", "amd64", "image.bin")
+	is.NoErr(err)
+	is.Equal(string(server.objects["/images/flatcar/stable/amd64-usr/current/image.bin"]), "test")
+	is.Equal(string(server.objects["/images/flatcar/stable/amd64-usr/current/image.bin.sig"]), "testsignature")
+
+	// Without a version file
+	source, err := provider.Resolve("stable", "amd64", "image.bin")
+	is.NoErr(err)
+	is.Equal(source.URL, "s3://images/flatcar/stable/amd64-usr/current/image.bin")
+	is.Equal(source.Version, "")
+
+	data, size, err := provider.Fetch(source)
+	is.NoErr(err)
+	is.Equal(size, int64(4))
+
+	got_data, err := io.ReadAll(data)
+	is.NoErr(err)
+	is.Equal(string(got_data), "test")
+
+	_, err = provider.Validate(io.NopCloser(bytes.NewReader(got_data)), source)
+	is.NoErr(err)
+
+	// With a version file
+	server.objects["/images/flatcar/stable/amd64-usr/current/version.txt"] = []byte("FLATCAR_VERSION=3033.1.0\n")
+	source, err = provider.Resolve("stable", "amd64", "image.bin")
+	is.NoErr(err)
+	is.Equal(source.Version, "3033.1.0")
+
+	_, _, err = provider.Fetch(gcli.Source{URL: "s3://images/flatcar/stable/amd64-usr/current/missing.bin"})
+	is.Equal(err.Error(), "object not found: flatcar/stable/amd64-usr/current/missing.bin")
+}
+
+func TestNewImageProviderConfig(t *testing.T) {
+	is := is.New(t)
+
+	// With missing bucket
+	set := flag.NewFlagSet("test", 0)
+	ctx := cli.NewContext(&cli.App{}, set, nil)
+	_, err := NewImageProviderConfig(ctx)
+	is.Equal(err.Error(), "must supply a bucket")
+
+	// With bucket and no endpoint
+	set = flag.NewFlagSet("test", 0)
+	set.String(flag_s3_bucket, "test", "test")
+	set.String(flag_region, "test", "test")
+	_ = set.Parse([]string{fmt.Sprintf("--%s", flag_region), "us-west-2"})
+
+	ctx = cli.NewContext(&cli.App{}, set, nil)
+	result, err := NewImageProviderConfig(ctx)
+	is.NoErr(err)
+	is.Equal(result.bucket, "test")
+	is.Equal(*result.config.Region, "us-west-2")
+	is.True(result.config.Endpoint == nil)
+}
@@ -2,41 +2,75 @@ package aws
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	gcli "github.com/HomeOperations/jmgilman/cli"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
-	"github.com/sethvargo/go-password/password"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
 const (
-	flag_access_key = "aws-access-key"
-	flag_secret_key = "aws-secret-key"
-	flag_region     = "aws-region"
-	flag_kms_key    = "aws-kms-key"
+	flag_kms_key     = "aws-kms-key"
+	flag_kms_key_map = "aws-kms-key-map"
 )
 
 // SecretProvider implements bootstrap.SecretProvider using the AWS SSM
-// parameter store as the backend. All parameters are configured to be encrypted
-// using the default KMS key associated with the account executing requests.
-// Credentials can be configured through the default AWS environment variables.
+// parameter store as the backend. All parameters are encrypted using the KMS
+// key mapped to the longest matching path prefix, falling back to the
+// configured KMS key and then the default key associated with the account
+// executing requests. Credentials can be configured through the default AWS
+// environment variables.
 type SecretProvider struct {
-	generator PasswordGenerator
-	ssm       ssmiface.SSMAPI
+	kmsKey  string
+	kmsKeys map[string]string
+	ssm     ssmiface.SSMAPI
 }
 
-// PasswordGenerator is a function which can be used for generating passwords.
-type PasswordGenerator func(length int, numDigits int, numSymbols int, noUpper bool, allowRepeat bool) (string, error)
+// Create sets the value of the secret with the given key only if the
+// parameter doesn't already exist.
+func (s *SecretProvider) Create(key string, value string) error {
+	return s.CreateAnnotated(key, value, "", nil)
+}
+
+// CreateAnnotated sets the value of the secret with the given key along with
+// its description and tags only if the parameter doesn't already exist. Unlike
+// overwriting, SSM accepts tags when creating a parameter so a single request
+// is sent.
+func (s *SecretProvider) CreateAnnotated(key string, value string, description string, tags map[string]string) error {
+	log.Infof("Sending create request for key: %s", key)
+	in := ssm.PutParameterInput{
+		Name:      &key,
+		Value:     &value,
+		Type:      aws.String("SecureString"),
+		Overwrite: aws.Bool(false),
+		KeyId:     s.keyID(key),
+		Tags:      ssmTags(tags),
+	}
+	if description != "" {
+		in.Description = &description
+	}
+
+	_, err := s.ssm.PutParameter(&in)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterAlreadyExists {
+			return gcli.ErrSecretExists
+		}
+
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return nil
+}
 
 // Delete deletes the secret with the given key
 func (s *SecretProvider) Delete(key string) error {
-	log.Info("Sending delete request for key: %s", key)
+	log.Infof("Sending delete request for key: %s", key)
 	in := ssm.DeleteParameterInput{
 		Name: &key,
 	}
@@ -53,48 +87,94 @@ func (s *SecretProvider) Delete(key string) error {
 	return nil
 }
 
-// Generate generates a new random secret value with the given key. Overwrites
-// any previous value that existed with the key.
-func (s *SecretProvider) Generate(key string, length int, nums int, symbols int) (string, error) {
-	log.Info("Sending put request for key: %s", key)
+// Get returns the value of the secret with the given key.
+func (s *SecretProvider) Get(key string) (string, error) {
+	log.Infof("Sending get request for key: %s", key)
+	in := ssm.GetParameterInput{
+		Name:           &key,
+		WithDecryption: aws.Bool(true),
+	}
 
-	log.WithFields(log.Fields{
-		"length":  length,
-		"nums":    nums,
-		"symbols": symbols,
-	}).Debug("Generating password")
-	res, err := s.generator(length, nums, symbols, false, false)
+	out, err := s.ssm.GetParameter(&in)
 	if err != nil {
-		return "", fmt.Errorf("failed generating random password")
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			return "", gcli.ErrSecretNotFound
+		}
+
+		return "", fmt.Errorf("error querying AWS: %s", err)
 	}
 
-	in := ssm.PutParameterInput{
-		Name:      &key,
-		Value:     &res,
-		Type:      aws.String("SecureString"),
-		Overwrite: aws.Bool(true),
+	return *out.Parameter.Value, nil
+}
+
+// Describe returns the metadata of the secret with the given key, including
+// its description and tags.
+func (s *SecretProvider) Describe(key string) (gcli.SecretMetadata, error) {
+	log.Infof("Sending describe request for key: %s", key)
+	in := ssm.DescribeParametersInput{
+		ParameterFilters: []*ssm.ParameterStringFilter{
+			{
+				Key:    aws.String("Name"),
+				Option: aws.String("Equals"),
+				Values: []*string{&key},
+			},
+		},
 	}
 
-	_, err = s.ssm.PutParameter(&in)
+	out, err := s.ssm.DescribeParameters(&in)
 	if err != nil {
-		return "", fmt.Errorf("error querying AWS: %s", err)
+		return gcli.SecretMetadata{}, fmt.Errorf("error querying AWS: %s", err)
+	}
+	if len(out.Parameters) == 0 {
+		return gcli.SecretMetadata{}, gcli.ErrSecretNotFound
+	}
+
+	p := out.Parameters[0]
+	metadata := gcli.SecretMetadata{
+		Description:  aws.StringValue(p.Description),
+		Key:          aws.StringValue(p.Name),
+		LastModified: p.LastModifiedDate,
+		ModifiedBy:   aws.StringValue(p.LastModifiedUser),
+		Type:         aws.StringValue(p.Type),
+		Version:      aws.Int64Value(p.Version),
+	}
+
+	tags, err := s.ssm.ListTagsForResource(&ssm.ListTagsForResourceInput{
+		ResourceId:   &key,
+		ResourceType: aws.String(ssm.ResourceTypeForTaggingParameter),
+	})
+	if err != nil {
+		return gcli.SecretMetadata{}, fmt.Errorf("error querying AWS: %s", err)
 	}
 
-	return res, nil
+	if len(tags.TagList) > 0 {
+		metadata.Tags = make(map[string]string, len(tags.TagList))
+		for _, tag := range tags.TagList {
+			metadata.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+
+	return metadata, nil
 }
 
-// Get returns the value of the secret with the given key.
-func (s *SecretProvider) Get(key string) (string, error) {
-	log.Info("Sending get request for key: %s", key)
+// GetVersion returns the value of the given version of the secret with the
+// given key.
+func (s *SecretProvider) GetVersion(key string, version int64) (string, error) {
+	log.Infof("Sending get request for key: %s (version %d)", key, version)
 	in := ssm.GetParameterInput{
-		Name:           &key,
+		Name:           aws.String(fmt.Sprintf("%s:%d", key, version)),
 		WithDecryption: aws.Bool(true),
 	}
 
 	out, err := s.ssm.GetParameter(&in)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
-			return "", gcli.ErrSecretNotFound
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case ssm.ErrCodeParameterNotFound:
+				return "", gcli.ErrSecretNotFound
+			case ssm.ErrCodeParameterVersionNotFound:
+				return "", gcli.ErrVersionNotFound
+			}
 		}
 
 		return "", fmt.Errorf("error querying AWS: %s", err)
@@ -103,15 +183,168 @@ func (s *SecretProvider) Get(key string) (string, error) {
 	return *out.Parameter.Value, nil
 }
 
+// History returns the versions of the secret with the given key along with
+// the identity which last modified each.
+func (s *SecretProvider) History(key string) ([]gcli.SecretVersion, error) {
+	log.Infof("Sending history request for key: %s", key)
+	in := ssm.GetParameterHistoryInput{
+		Name:           &key,
+		WithDecryption: aws.Bool(false),
+	}
+
+	var versions []gcli.SecretVersion
+	err := s.ssm.GetParameterHistoryPages(&in, func(out *ssm.GetParameterHistoryOutput, last bool) bool {
+		for _, p := range out.Parameters {
+			versions = append(versions, gcli.SecretVersion{
+				LastModified: p.LastModifiedDate,
+				ModifiedBy:   aws.StringValue(p.LastModifiedUser),
+				Version:      aws.Int64Value(p.Version),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			return nil, gcli.ErrSecretNotFound
+		}
+
+		return nil, fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return versions, nil
+}
+
+// List returns metadata for the parameters under the given path. SSM paths
+// must begin with a forward slash.
+func (s *SecretProvider) List(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	log.Infof("Sending list request for path: %s", prefix)
+	in := ssm.GetParametersByPathInput{
+		Path:           &prefix,
+		Recursive:      aws.Bool(recursive),
+		WithDecryption: aws.Bool(false),
+	}
+
+	var secrets []gcli.SecretMetadata
+	err := s.ssm.GetParametersByPathPages(&in, func(out *ssm.GetParametersByPathOutput, last bool) bool {
+		for _, p := range out.Parameters {
+			secrets = append(secrets, gcli.SecretMetadata{
+				Key:          aws.StringValue(p.Name),
+				LastModified: p.LastModifiedDate,
+				Type:         aws.StringValue(p.Type),
+				Version:      aws.Int64Value(p.Version),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return secrets, nil
+}
+
+// ListTagged returns metadata for the parameters under the given path which
+// have all of the given tags. The tags are filtered by SSM so the parameters
+// don't need to be described individually.
+func (s *SecretProvider) ListTagged(prefix string, recursive bool, tags map[string]string) ([]gcli.SecretMetadata, error) {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	option := "OneLevel"
+	if recursive {
+		option = "Recursive"
+	}
+
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	log.Infof("Sending list request for path: %s", prefix)
+	in := ssm.DescribeParametersInput{
+		ParameterFilters: []*ssm.ParameterStringFilter{
+			{
+				Key:    aws.String("Path"),
+				Option: aws.String(option),
+				Values: []*string{&prefix},
+			},
+		},
+	}
+	for _, name := range names {
+		in.ParameterFilters = append(in.ParameterFilters, &ssm.ParameterStringFilter{
+			Key:    aws.String("tag:" + name),
+			Option: aws.String("Equals"),
+			Values: []*string{aws.String(tags[name])},
+		})
+	}
+
+	var secrets []gcli.SecretMetadata
+	err := s.ssm.DescribeParametersPages(&in, func(out *ssm.DescribeParametersOutput, last bool) bool {
+		for _, p := range out.Parameters {
+			matched := make(map[string]string, len(tags))
+			for name, value := range tags {
+				matched[name] = value
+			}
+
+			secrets = append(secrets, gcli.SecretMetadata{
+				Description:  aws.StringValue(p.Description),
+				Key:          aws.StringValue(p.Name),
+				LastModified: p.LastModifiedDate,
+				ModifiedBy:   aws.StringValue(p.LastModifiedUser),
+				Tags:         matched,
+				Type:         aws.StringValue(p.Type),
+				Version:      aws.Int64Value(p.Version),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return secrets, nil
+}
+
 // Set sets the value of the secret with the given key. Overwrites any previous
 // value that existed with the key.
 func (s *SecretProvider) Set(key string, value string) error {
-	log.Info("Sending set request for key: %s", key)
+	log.Infof("Sending set request for key: %s", key)
+	in := ssm.PutParameterInput{
+		Name:      &key,
+		Value:     &value,
+		Type:      aws.String("SecureString"),
+		Overwrite: aws.Bool(true),
+		KeyId:     s.keyID(key),
+	}
+
+	_, err := s.ssm.PutParameter(&in)
+	if err != nil {
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return nil
+}
+
+// SetAnnotated sets the value of the secret with the given key along with its
+// description and tags. SSM doesn't allow tagging when overwriting a parameter
+// so the tags are added with a separate request.
+func (s *SecretProvider) SetAnnotated(key string, value string, description string, tags map[string]string) error {
+	log.Infof("Sending set request for key: %s", key)
 	in := ssm.PutParameterInput{
 		Name:      &key,
 		Value:     &value,
 		Type:      aws.String("SecureString"),
 		Overwrite: aws.Bool(true),
+		KeyId:     s.keyID(key),
+	}
+	if description != "" {
+		in.Description = &description
 	}
 
 	_, err := s.ssm.PutParameter(&in)
@@ -119,9 +352,49 @@ func (s *SecretProvider) Set(key string, value string) error {
 		return fmt.Errorf("error querying AWS: %s", err)
 	}
 
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagsIn := ssm.AddTagsToResourceInput{
+		ResourceId:   &key,
+		ResourceType: aws.String(ssm.ResourceTypeForTaggingParameter),
+		Tags:         ssmTags(tags),
+	}
+
+	_, err = s.ssm.AddTagsToResource(&tagsIn)
+	if err != nil {
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
 	return nil
 }
 
+// ssmTags returns the given tags sorted by name, or nil if there are none.
+func ssmTags(tags map[string]string) []*ssm.Tag {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []*ssm.Tag
+	for _, name := range names {
+		result = append(result, &ssm.Tag{
+			Key:   aws.String(name),
+			Value: aws.String(tags[name]),
+		})
+	}
+
+	return result
+}
+
+// keyID returns the KMS key used to encrypt the secret with the given key or
+// nil to use the account default.
+func (s *SecretProvider) keyID(key string) *string {
+	return kmsKeyID(key, s.kmsKey, s.kmsKeys)
+}
+
 // NewSecretProvider creates a new instance of SecretProvider using the given
 // configuration.
 func NewSecretProvider(config SecretProviderConfig) SecretProvider {
@@ -129,72 +402,51 @@ func NewSecretProvider(config SecretProviderConfig) SecretProvider {
 	ssm := ssm.New(sess)
 
 	return SecretProvider{
-		generator: password.Generate,
-		ssm:       ssm,
+		kmsKey:  config.kmsKey,
+		kmsKeys: config.kmsKeys,
+		ssm:     ssm,
 	}
 }
 
 // SecretProviderConfig provides the configuration details needed for
 // instantiating a new SecretProvider.
 type SecretProviderConfig struct {
-	config *aws.Config
+	config  *aws.Config
+	kmsKey  string
+	kmsKeys map[string]string
 }
 
 // Flags returns the CLI flags that can be used to configure the AWS secret
 // provider.
 func Flags() []cli.Flag {
-	return []cli.Flag{
-		&cli.StringFlag{
-			Name:  flag_access_key,
-			Usage: "AWS access key ID (default: $AWS_ACCESS_KEY_ID)",
-		},
-		&cli.StringFlag{
-			Name:  flag_secret_key,
-			Usage: "AWS secret key ID (default: $AWS_SECRET_ACCESS_KEY)",
-		},
-		&cli.StringFlag{
-			Name:  flag_region,
-			Usage: "AWS region (default: $AWS_REGION)",
-		},
+	return append(credentialFlags(),
 		&cli.StringFlag{
 			Name:  flag_kms_key,
 			Usage: "KMS key ID to use for encryption (defaults to account default)",
 		},
-	}
+		&cli.StringSliceFlag{
+			Name:  flag_kms_key_map,
+			Usage: "KMS key ID to use for secrets under a path prefix (PREFIX=KEY); the longest match wins",
+		},
+	)
 }
 
 // NewSecretProviderConfig creates a new SecretProviderConfig by parsing CLI
 // flags contained within the passed cli.Context.
 func NewSecretProviderConfig(c *cli.Context) (SecretProviderConfig, error) {
-	config := aws.NewConfig()
-
-	if c.IsSet(flag_access_key) || c.IsSet(flag_secret_key) {
-		if !(c.IsSet(flag_access_key) && c.IsSet(flag_secret_key)) {
-			return SecretProviderConfig{}, fmt.Errorf("must supply both access and secret keys")
-		}
-
-		log.Info("Configuring static credentials")
-		creds := credentials.NewCredentials(&credentials.StaticProvider{
-			Value: credentials.Value{
-				AccessKeyID:     c.String(flag_access_key),
-				SecretAccessKey: c.String(flag_secret_key),
-				ProviderName:    "flags",
-			},
-		})
-
-		config = config.WithCredentials(creds)
-	}
-
-	if c.IsSet(flag_region) {
-		log.Info("Using %s region", c.String(flag_region))
-		config.Region = aws.String(c.String(flag_region))
+	config, err := newConfig(c)
+	if err != nil {
+		return SecretProviderConfig{}, err
 	}
 
-	if c.Bool("debug") {
-		config.LogLevel = aws.LogLevel(aws.LogDebug)
+	kmsKeys, err := parseKMSKeyMap(c.StringSlice(flag_kms_key_map))
+	if err != nil {
+		return SecretProviderConfig{}, err
 	}
 
 	return SecretProviderConfig{
-		config: config,
+		config:  config,
+		kmsKey:  c.String(flag_kms_key),
+		kmsKeys: kmsKeys,
 	}, nil
 }
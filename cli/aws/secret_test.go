@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"testing"
+	"time"
 
 	gcli "github.com/HomeOperations/jmgilman/cli"
 	"github.com/aws/aws-sdk-go/aws"
@@ -17,9 +18,31 @@ import (
 
 type mockSSM struct {
 	ssmiface.SSMAPI
-	fnDelete func(input *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error)
-	fnGet    func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
-	fnPut    func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error)
+	fnAddTags   func(input *ssm.AddTagsToResourceInput) (*ssm.AddTagsToResourceOutput, error)
+	fnDescribe  func(input *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error)
+	fnDescPages func(input *ssm.DescribeParametersInput, fn func(*ssm.DescribeParametersOutput, bool) bool) error
+	fnListTags  func(input *ssm.ListTagsForResourceInput) (*ssm.ListTagsForResourceOutput, error)
+	fnDelete    func(input *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error)
+	fnGet       func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+	fnGetByPath func(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error
+	fnHistory   func(input *ssm.GetParameterHistoryInput, fn func(*ssm.GetParameterHistoryOutput, bool) bool) error
+	fnPut       func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error)
+}
+
+func (m *mockSSM) AddTagsToResource(input *ssm.AddTagsToResourceInput) (*ssm.AddTagsToResourceOutput, error) {
+	return m.fnAddTags(input)
+}
+
+func (m *mockSSM) DescribeParameters(input *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+	return m.fnDescribe(input)
+}
+
+func (m *mockSSM) DescribeParametersPages(input *ssm.DescribeParametersInput, fn func(*ssm.DescribeParametersOutput, bool) bool) error {
+	return m.fnDescPages(input, fn)
+}
+
+func (m *mockSSM) ListTagsForResource(input *ssm.ListTagsForResourceInput) (*ssm.ListTagsForResourceOutput, error) {
+	return m.fnListTags(input)
 }
 
 func (m *mockSSM) DeleteParameter(input *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error) {
@@ -30,6 +53,14 @@ func (m *mockSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterO
 	return m.fnGet(input)
 }
 
+func (m *mockSSM) GetParametersByPathPages(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+	return m.fnGetByPath(input, fn)
+}
+
+func (m *mockSSM) GetParameterHistoryPages(input *ssm.GetParameterHistoryInput, fn func(*ssm.GetParameterHistoryOutput, bool) bool) error {
+	return m.fnHistory(input, fn)
+}
+
 func (m *mockSSM) PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
 	return m.fnPut(input)
 }
@@ -66,100 +97,222 @@ func TestDelete(t *testing.T) {
 	is.True(errors.Is(err, gcli.ErrSecretNotFound))
 }
 
-func TestGenerate(t *testing.T) {
+func TestGet(t *testing.T) {
 	is := is.New(t)
 	expected_key := "test"
 	expected_value := "test"
 
-	// Password generation works
+	// With no error
 	var got_key string
-	var got_value string
 	provider := SecretProvider{
-		generator: func(length, numDigits, numSymbols int, noUpper, allowRepeat bool) (string, error) {
-			return expected_value, nil
-		},
 		ssm: &mockSSM{
-			fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+			fnGet: func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
 				got_key = *input.Name
-				got_value = *input.Value
-				return nil, nil
+				return &ssm.GetParameterOutput{
+					Parameter: &ssm.Parameter{
+						Value: aws.String(expected_value),
+					},
+				}, nil
 			},
 		},
 	}
 
-	result, err := provider.Generate(expected_key, 0, 0, 0)
+	got_value, err := provider.Get(expected_key)
 	is.NoErr(err)
-	is.Equal(got_key, expected_key)
-	is.Equal(got_value, expected_value)
-	is.Equal(result, expected_value)
+	is.Equal(expected_key, got_key)
+	is.Equal(expected_value, got_value)
 
-	// With password generation error
+	// With key error
 	provider = SecretProvider{
-		generator: func(length, numDigits, numSymbols int, noUpper, allowRepeat bool) (string, error) {
-			return "", fmt.Errorf("failed")
+		ssm: &mockSSM{
+			fnGet: func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+				return nil, awserr.New(ssm.ErrCodeParameterNotFound, "", fmt.Errorf(""))
+			},
 		},
+	}
+
+	_, err = provider.Get(expected_key)
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+}
+
+func TestGetVersion(t *testing.T) {
+	is := is.New(t)
+
+	// With no error
+	var got_name string
+	provider := SecretProvider{
 		ssm: &mockSSM{
-			fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
-				return nil, nil
+			fnGet: func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+				got_name = *input.Name
+				return &ssm.GetParameterOutput{
+					Parameter: &ssm.Parameter{
+						Value: aws.String("old"),
+					},
+				}, nil
+			},
+		},
+	}
+
+	value, err := provider.GetVersion("/glab/test", 2)
+	is.NoErr(err)
+	is.Equal(got_name, "/glab/test:2")
+	is.Equal(value, "old")
+
+	// With version error
+	provider.ssm = &mockSSM{
+		fnGet: func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+			return nil, awserr.New(ssm.ErrCodeParameterVersionNotFound, "", fmt.Errorf(""))
+		},
+	}
+
+	_, err = provider.GetVersion("/glab/test", 9)
+	is.True(errors.Is(err, gcli.ErrVersionNotFound))
+}
+
+func TestHistory(t *testing.T) {
+	is := is.New(t)
+	modified := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	// With no error
+	var got_name string
+	provider := SecretProvider{
+		ssm: &mockSSM{
+			fnHistory: func(input *ssm.GetParameterHistoryInput, fn func(*ssm.GetParameterHistoryOutput, bool) bool) error {
+				got_name = *input.Name
+				fn(&ssm.GetParameterHistoryOutput{
+					Parameters: []*ssm.ParameterHistory{
+						{Version: aws.Int64(1), LastModifiedDate: &modified, LastModifiedUser: aws.String("arn:aws:iam::123456789012:user/admin")},
+					},
+				}, false)
+				fn(&ssm.GetParameterHistoryOutput{
+					Parameters: []*ssm.ParameterHistory{
+						{Version: aws.Int64(2), LastModifiedDate: &modified},
+					},
+				}, true)
+				return nil
+			},
+		},
+	}
+
+	versions, err := provider.History("/glab/test")
+	is.NoErr(err)
+	is.Equal(got_name, "/glab/test")
+	is.Equal(versions, []gcli.SecretVersion{
+		{Version: 1, LastModified: &modified, ModifiedBy: "arn:aws:iam::123456789012:user/admin"},
+		{Version: 2, LastModified: &modified},
+	})
+
+	// With key error
+	provider.ssm = &mockSSM{
+		fnHistory: func(input *ssm.GetParameterHistoryInput, fn func(*ssm.GetParameterHistoryOutput, bool) bool) error {
+			return awserr.New(ssm.ErrCodeParameterNotFound, "", fmt.Errorf(""))
+		},
+	}
+
+	_, err = provider.History("/glab/test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+}
+
+func TestList(t *testing.T) {
+	is := is.New(t)
+	modified := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	// With multiple pages
+	var got *ssm.GetParametersByPathInput
+	provider := SecretProvider{
+		ssm: &mockSSM{
+			fnGetByPath: func(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+				got = input
+				pages := []*ssm.GetParametersByPathOutput{
+					{Parameters: []*ssm.Parameter{{Name: aws.String("/glab/a"), Type: aws.String("SecureString"), Version: aws.Int64(2), LastModifiedDate: &modified}}},
+					{Parameters: []*ssm.Parameter{{Name: aws.String("/glab/b"), Type: aws.String("String"), Version: aws.Int64(1)}}},
+				}
+				for i, page := range pages {
+					if !fn(page, i == len(pages)-1) {
+						break
+					}
+				}
+				return nil
 			},
 		},
 	}
 
-	_, err = provider.Generate(expected_key, 0, 0, 0)
-	is.Equal(err.Error(), "failed generating random password")
+	result, err := provider.List("glab", true)
+	is.NoErr(err)
+	is.Equal(*got.Path, "/glab")
+	is.True(*got.Recursive)
+	is.True(!*got.WithDecryption)
+	is.Equal(result, []gcli.SecretMetadata{
+		{Key: "/glab/a", LastModified: &modified, Type: "SecureString", Version: 2},
+		{Key: "/glab/b", Type: "String", Version: 1},
+	})
 
 	// With SSM error
 	provider = SecretProvider{
-		generator: func(length, numDigits, numSymbols int, noUpper, allowRepeat bool) (string, error) {
-			return "", nil
-		},
 		ssm: &mockSSM{
-			fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
-				return nil, fmt.Errorf("failed")
+			fnGetByPath: func(input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+				return fmt.Errorf("failed")
 			},
 		},
 	}
 
-	_, err = provider.Generate(expected_key, 0, 0, 0)
+	_, err = provider.List("/glab", false)
 	is.Equal(err.Error(), "error querying AWS: failed")
 }
 
-func TestGet(t *testing.T) {
+func TestListTagged(t *testing.T) {
 	is := is.New(t)
-	expected_key := "test"
-	expected_value := "test"
+	modified := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
 
-	// With no error
-	var got_key string
+	// With multiple pages
+	var got *ssm.DescribeParametersInput
 	provider := SecretProvider{
 		ssm: &mockSSM{
-			fnGet: func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
-				got_key = *input.Name
-				return &ssm.GetParameterOutput{
-					Parameter: &ssm.Parameter{
-						Value: aws.String(expected_value),
-					},
-				}, nil
+			fnDescPages: func(input *ssm.DescribeParametersInput, fn func(*ssm.DescribeParametersOutput, bool) bool) error {
+				got = input
+				pages := []*ssm.DescribeParametersOutput{
+					{Parameters: []*ssm.ParameterMetadata{{Name: aws.String("/glab/a"), Description: aws.String("test"), Type: aws.String("SecureString"), Version: aws.Int64(2), LastModifiedDate: &modified, LastModifiedUser: aws.String("ops")}}},
+					{Parameters: []*ssm.ParameterMetadata{{Name: aws.String("/glab/b"), Type: aws.String("String"), Version: aws.Int64(1)}}},
+				}
+				for i, page := range pages {
+					if !fn(page, i == len(pages)-1) {
+						break
+					}
+				}
+				return nil
 			},
 		},
 	}
 
-	got_value, err := provider.Get(expected_key)
+	tags := map[string]string{"owner": "ops", "env": "dev"}
+	result, err := provider.ListTagged("glab", true, tags)
 	is.NoErr(err)
-	is.Equal(expected_key, got_key)
-	is.Equal(expected_value, got_value)
+	is.Equal(got.ParameterFilters, []*ssm.ParameterStringFilter{
+		{Key: aws.String("Path"), Option: aws.String("Recursive"), Values: []*string{aws.String("/glab")}},
+		{Key: aws.String("tag:env"), Option: aws.String("Equals"), Values: []*string{aws.String("dev")}},
+		{Key: aws.String("tag:owner"), Option: aws.String("Equals"), Values: []*string{aws.String("ops")}},
+	})
+	is.Equal(result, []gcli.SecretMetadata{
+		{Description: "test", Key: "/glab/a", LastModified: &modified, ModifiedBy: "ops", Tags: tags, Type: "SecureString", Version: 2},
+		{Key: "/glab/b", Tags: tags, Type: "String", Version: 1},
+	})
+
+	// With a single level
+	_, err = provider.ListTagged("/glab", false, tags)
+	is.NoErr(err)
+	is.Equal(*got.ParameterFilters[0].Option, "OneLevel")
 
-	// With key error
+	// With SSM error
 	provider = SecretProvider{
 		ssm: &mockSSM{
-			fnGet: func(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
-				return nil, awserr.New(ssm.ErrCodeParameterNotFound, "", fmt.Errorf(""))
+			fnDescPages: func(input *ssm.DescribeParametersInput, fn func(*ssm.DescribeParametersOutput, bool) bool) error {
+				return fmt.Errorf("failed")
 			},
 		},
 	}
 
-	_, err = provider.Get(expected_key)
-	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+	_, err = provider.ListTagged("/glab", false, tags)
+	is.Equal(err.Error(), "error querying AWS: failed")
 }
 
 func TestPut(t *testing.T) {
@@ -187,9 +340,6 @@ func TestPut(t *testing.T) {
 
 	// With SSM error
 	provider = SecretProvider{
-		generator: func(length, numDigits, numSymbols int, noUpper, allowRepeat bool) (string, error) {
-			return "", nil
-		},
 		ssm: &mockSSM{
 			fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
 				return nil, fmt.Errorf("failed")
@@ -201,6 +351,57 @@ func TestPut(t *testing.T) {
 	is.Equal(err.Error(), "error querying AWS: failed")
 }
 
+func TestCreate(t *testing.T) {
+	is := is.New(t)
+
+	// With no error
+	var got *ssm.PutParameterInput
+	provider := SecretProvider{
+		ssm: &mockSSM{
+			fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+				got = input
+				return nil, nil
+			},
+		},
+	}
+
+	is.NoErr(provider.Create("test", "value"))
+	is.Equal(*got.Name, "test")
+	is.Equal(*got.Value, "value")
+	is.Equal(*got.Overwrite, false)
+	is.True(got.Description == nil)
+	is.True(got.Tags == nil)
+
+	// With description and tags
+	is.NoErr(provider.CreateAnnotated("test", "value", "vmrest password", map[string]string{"owner": "ops", "env": "dev"}))
+	is.Equal(*got.Overwrite, false)
+	is.Equal(*got.Description, "vmrest password")
+	is.Equal(got.Tags, []*ssm.Tag{
+		{Key: aws.String("env"), Value: aws.String("dev")},
+		{Key: aws.String("owner"), Value: aws.String("ops")},
+	})
+
+	// With existing parameter
+	provider.ssm = &mockSSM{
+		fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+			return nil, awserr.New(ssm.ErrCodeParameterAlreadyExists, "", fmt.Errorf(""))
+		},
+	}
+
+	err := provider.Create("test", "value")
+	is.True(errors.Is(err, gcli.ErrSecretExists))
+
+	// With SSM error
+	provider.ssm = &mockSSM{
+		fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+			return nil, fmt.Errorf("failed")
+		},
+	}
+
+	err = provider.Create("test", "value")
+	is.Equal(err.Error(), "error querying AWS: failed")
+}
+
 func TestNewSecretProviderConfig(t *testing.T) {
 	is := is.New(t)
 
@@ -218,7 +419,7 @@ func TestNewSecretProviderConfig(t *testing.T) {
 	set.String(flag_access_key, "test", "test")
 	set.String(flag_secret_key, "test", "test")
 	set.String(flag_region, "test", "test")
-	set.Bool("verbose", true, "test")
+	set.Bool("debug", true, "test")
 	_ = set.Parse([]string{fmt.Sprintf("--%s", flag_access_key), "test", fmt.Sprintf("--%s", flag_secret_key), "test", fmt.Sprintf("--%s", flag_region), "test"})
 
 	ctx = cli.NewContext(&cli.App{}, set, nil)
@@ -231,3 +432,173 @@ func TestNewSecretProviderConfig(t *testing.T) {
 	is.Equal(*result.config.Region, "test")
 	is.Equal(*result.config.LogLevel, aws.LogDebug)
 }
+
+func TestKMSKey(t *testing.T) {
+	is := is.New(t)
+
+	// With account default
+	var got *ssm.PutParameterInput
+	provider := SecretProvider{
+		ssm: &mockSSM{
+			fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+				got = input
+				return nil, nil
+			},
+		},
+	}
+
+	is.NoErr(provider.Set("/glab/test", "value"))
+	is.True(got.KeyId == nil)
+
+	// With default key
+	provider.kmsKey = "alias/default"
+	is.NoErr(provider.Set("/glab/test", "value"))
+	is.Equal(*got.KeyId, "alias/default")
+
+	// With mapped keys
+	provider.kmsKeys = map[string]string{
+		"/glab":            "alias/glab",
+		"/glab/bootstrap":  "alias/bootstrap",
+		"/glab/production": "alias/production",
+	}
+
+	is.NoErr(provider.Set("/glab/bootstrap/test", "value"))
+	is.Equal(*got.KeyId, "alias/bootstrap")
+
+	is.NoErr(provider.SetAnnotated("/glab/production/nested/test", "value", "", nil))
+	is.Equal(*got.KeyId, "alias/production")
+
+	is.NoErr(provider.Set("/glab/bootstrapped", "value"))
+	is.Equal(*got.KeyId, "alias/glab")
+
+	is.NoErr(provider.Set("/other/test", "value"))
+	is.Equal(*got.KeyId, "alias/default")
+}
+
+func TestNewSecretProviderConfigKMS(t *testing.T) {
+	is := is.New(t)
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", 0)
+		for _, f := range Flags() {
+			is.NoErr(f.Apply(set))
+		}
+		is.NoErr(set.Parse(args))
+		return cli.NewContext(&cli.App{}, set, nil)
+	}
+
+	// With KMS keys
+	config, err := NewSecretProviderConfig(newContext(
+		"--aws-kms-key", "alias/default",
+		"--aws-kms-key-map", "/glab/bootstrap=alias/bootstrap",
+		"--aws-kms-key-map", "/glab/production=arn:aws:kms:us-west-2:123456789012:key/abcd",
+	))
+	is.NoErr(err)
+	is.Equal(config.kmsKey, "alias/default")
+	is.Equal(config.kmsKeys, map[string]string{
+		"/glab/bootstrap":  "alias/bootstrap",
+		"/glab/production": "arn:aws:kms:us-west-2:123456789012:key/abcd",
+	})
+
+	// With invalid mapping
+	_, err = NewSecretProviderConfig(newContext("--aws-kms-key-map", "/glab"))
+	is.Equal(err.Error(), "invalid KMS key mapping: /glab")
+}
+
+func TestDescribe(t *testing.T) {
+	is := is.New(t)
+	modified := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	// With no error
+	var got_filter *ssm.ParameterStringFilter
+	var got_resource string
+	mock := &mockSSM{
+		fnDescribe: func(input *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+			got_filter = input.ParameterFilters[0]
+			return &ssm.DescribeParametersOutput{
+				Parameters: []*ssm.ParameterMetadata{
+					{
+						Description:      aws.String("vmrest password"),
+						LastModifiedDate: &modified,
+						LastModifiedUser: aws.String("admin"),
+						Name:             aws.String("/glab/test"),
+						Type:             aws.String("SecureString"),
+						Version:          aws.Int64(2),
+					},
+				},
+			}, nil
+		},
+		fnListTags: func(input *ssm.ListTagsForResourceInput) (*ssm.ListTagsForResourceOutput, error) {
+			got_resource = *input.ResourceId
+			return &ssm.ListTagsForResourceOutput{
+				TagList: []*ssm.Tag{{Key: aws.String("owner"), Value: aws.String("ops")}},
+			}, nil
+		},
+	}
+	provider := SecretProvider{ssm: mock}
+
+	metadata, err := provider.Describe("/glab/test")
+	is.NoErr(err)
+	is.Equal(*got_filter.Key, "Name")
+	is.Equal(*got_filter.Values[0], "/glab/test")
+	is.Equal(got_resource, "/glab/test")
+	is.Equal(metadata, gcli.SecretMetadata{
+		Description:  "vmrest password",
+		Key:          "/glab/test",
+		LastModified: &modified,
+		ModifiedBy:   "admin",
+		Tags:         map[string]string{"owner": "ops"},
+		Type:         "SecureString",
+		Version:      2,
+	})
+
+	// With missing key
+	mock.fnDescribe = func(input *ssm.DescribeParametersInput) (*ssm.DescribeParametersOutput, error) {
+		return &ssm.DescribeParametersOutput{}, nil
+	}
+
+	_, err = provider.Describe("/glab/test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+}
+
+func TestSetAnnotated(t *testing.T) {
+	is := is.New(t)
+
+	// With description and tags
+	var got_put *ssm.PutParameterInput
+	var got_tags *ssm.AddTagsToResourceInput
+	mock := &mockSSM{
+		fnPut: func(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+			got_put = input
+			return nil, nil
+		},
+		fnAddTags: func(input *ssm.AddTagsToResourceInput) (*ssm.AddTagsToResourceOutput, error) {
+			got_tags = input
+			return nil, nil
+		},
+	}
+	provider := SecretProvider{ssm: mock}
+
+	is.NoErr(provider.SetAnnotated("/glab/test", "value", "vmrest password", map[string]string{"owner": "ops", "env": "dev"}))
+	is.Equal(*got_put.Value, "value")
+	is.Equal(*got_put.Description, "vmrest password")
+	is.Equal(*got_tags.ResourceId, "/glab/test")
+	is.Equal(*got_tags.ResourceType, ssm.ResourceTypeForTaggingParameter)
+	is.Equal(len(got_tags.Tags), 2)
+	is.Equal(*got_tags.Tags[0].Key, "env")
+	is.Equal(*got_tags.Tags[1].Value, "ops")
+
+	// With no tags
+	got_tags = nil
+	is.NoErr(provider.SetAnnotated("/glab/test", "value", "", nil))
+	is.True(got_put.Description == nil)
+	is.True(got_tags == nil)
+
+	// With AWS error
+	mock.fnAddTags = func(input *ssm.AddTagsToResourceInput) (*ssm.AddTagsToResourceOutput, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	err := provider.SetAnnotated("/glab/test", "value", "", map[string]string{"owner": "ops"})
+	is.Equal(err.Error(), "error querying AWS: failed")
+}
@@ -0,0 +1,238 @@
+package aws
+
+import (
+	"fmt"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_sm_force_delete    = "aws-sm-force-delete"
+	flag_sm_recovery_window = "aws-sm-recovery-window"
+	flag_sm_version_stage   = "aws-sm-version-stage"
+
+	// currentStage is the staging label Secrets Manager attaches to the
+	// current version of a secret.
+	currentStage = "AWSCURRENT"
+)
+
+// SecretsManagerProvider implements bootstrap.SecretProvider using AWS Secrets
+// Manager as the backend. Unlike the SSM parameter store, Secrets Manager
+// supports values of up to 64 KB. Reads and writes target the configured
+// version stage, and deletes are scheduled using the configured recovery
+// window unless forced. New secrets are encrypted with the KMS key mapped to
+// their path in the same way as the SSM provider; the key of an existing
+// secret is left unchanged.
+type SecretsManagerProvider struct {
+	force          bool
+	kmsKey         string
+	kmsKeys        map[string]string
+	recoveryWindow int64
+	sm             secretsmanageriface.SecretsManagerAPI
+	stage          string
+}
+
+// Create creates the secret with the given key only if it doesn't already
+// exist. New secrets always start at the current stage.
+func (s *SecretsManagerProvider) Create(key string, value string) error {
+	if s.stage != currentStage {
+		return fmt.Errorf("secrets can only be created at the %s stage", currentStage)
+	}
+
+	log.Infof("Sending create request for key: %s", key)
+	_, err := s.sm.CreateSecret(&secretsmanager.CreateSecretInput{
+		Name:         &key,
+		SecretString: &value,
+		KmsKeyId:     kmsKeyID(key, s.kmsKey, s.kmsKeys),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceExistsException {
+			return gcli.ErrSecretExists
+		}
+
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return nil
+}
+
+// Delete schedules the secret with the given key for deletion.
+func (s *SecretsManagerProvider) Delete(key string) error {
+	log.Infof("Sending delete request for key: %s", key)
+	in := secretsmanager.DeleteSecretInput{
+		SecretId: &key,
+	}
+	if s.force {
+		log.Info("Deleting secret without recovery")
+		in.ForceDeleteWithoutRecovery = aws.Bool(true)
+	} else {
+		log.Infof("Scheduling deletion with a %d day recovery window", s.recoveryWindow)
+		in.RecoveryWindowInDays = aws.Int64(s.recoveryWindow)
+	}
+
+	_, err := s.sm.DeleteSecret(&in)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return gcli.ErrSecretNotFound
+		}
+
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return nil
+}
+
+// Get returns the value of the secret with the given key at the configured
+// version stage.
+func (s *SecretsManagerProvider) Get(key string) (string, error) {
+	log.Infof("Sending get request for key: %s", key)
+	in := secretsmanager.GetSecretValueInput{
+		SecretId:     &key,
+		VersionStage: aws.String(s.stage),
+	}
+
+	out, err := s.sm.GetSecretValue(&in)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+			return "", gcli.ErrSecretNotFound
+		}
+
+		return "", fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+
+	return string(out.SecretBinary), nil
+}
+
+// Set stores a new version of the secret with the given key, creating the
+// secret if it doesn't exist. The new version is attached to the configured
+// version stage.
+func (s *SecretsManagerProvider) Set(key string, value string) error {
+	log.Infof("Sending set request for key: %s", key)
+	in := secretsmanager.PutSecretValueInput{
+		SecretId:      &key,
+		SecretString:  &value,
+		VersionStages: []*string{aws.String(s.stage)},
+	}
+
+	_, err := s.sm.PutSecretValue(&in)
+	if err == nil {
+		return nil
+	}
+
+	aerr, ok := err.(awserr.Error)
+	if !ok || aerr.Code() != secretsmanager.ErrCodeResourceNotFoundException {
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	// New secrets always start at the current stage
+	if s.stage != currentStage {
+		return gcli.ErrSecretNotFound
+	}
+
+	log.Infof("Creating new secret for key: %s", key)
+	_, err = s.sm.CreateSecret(&secretsmanager.CreateSecretInput{
+		Name:         &key,
+		SecretString: &value,
+		KmsKeyId:     kmsKeyID(key, s.kmsKey, s.kmsKeys),
+	})
+	if err != nil {
+		return fmt.Errorf("error querying AWS: %s", err)
+	}
+
+	return nil
+}
+
+// NewSecretsManagerProvider creates a new instance of SecretsManagerProvider
+// using the given configuration.
+func NewSecretsManagerProvider(config SecretsManagerProviderConfig) SecretsManagerProvider {
+	sess := session.Must(session.NewSession(config.config))
+	sm := secretsmanager.New(sess)
+
+	return SecretsManagerProvider{
+		force:          config.force,
+		kmsKey:         config.kmsKey,
+		kmsKeys:        config.kmsKeys,
+		recoveryWindow: config.recoveryWindow,
+		sm:             sm,
+		stage:          config.stage,
+	}
+}
+
+// SecretsManagerProviderConfig provides the configuration details needed for
+// instantiating a new SecretsManagerProvider.
+type SecretsManagerProviderConfig struct {
+	config         *aws.Config
+	force          bool
+	kmsKey         string
+	kmsKeys        map[string]string
+	recoveryWindow int64
+	stage          string
+}
+
+// SecretsManagerFlags returns the CLI flags specific to the Secrets Manager
+// provider. Credentials are configured using the flags returned by Flags().
+func SecretsManagerFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_sm_version_stage,
+			Usage: "Secrets Manager version stage to read and write",
+			Value: currentStage,
+		},
+		&cli.Int64Flag{
+			Name:  flag_sm_recovery_window,
+			Usage: "Days before a deleted secret is removed permanently (7-30)",
+			Value: 30,
+		},
+		&cli.BoolFlag{
+			Name:  flag_sm_force_delete,
+			Usage: "Delete secrets immediately without a recovery window",
+		},
+	}
+}
+
+// NewSecretsManagerProviderConfig creates a new SecretsManagerProviderConfig by
+// parsing CLI flags contained within the passed cli.Context.
+func NewSecretsManagerProviderConfig(c *cli.Context) (SecretsManagerProviderConfig, error) {
+	config, err := newConfig(c)
+	if err != nil {
+		return SecretsManagerProviderConfig{}, err
+	}
+
+	window := c.Int64(flag_sm_recovery_window)
+	if !c.IsSet(flag_sm_recovery_window) && window == 0 {
+		window = 30
+	}
+	if window < 7 || window > 30 {
+		return SecretsManagerProviderConfig{}, fmt.Errorf("recovery window must be between 7 and 30 days")
+	}
+
+	stage := c.String(flag_sm_version_stage)
+	if stage == "" {
+		stage = currentStage
+	}
+
+	kmsKeys, err := parseKMSKeyMap(c.StringSlice(flag_kms_key_map))
+	if err != nil {
+		return SecretsManagerProviderConfig{}, err
+	}
+
+	return SecretsManagerProviderConfig{
+		config:         config,
+		force:          c.Bool(flag_sm_force_delete),
+		kmsKey:         c.String(flag_kms_key),
+		kmsKeys:        kmsKeys,
+		recoveryWindow: window,
+		stage:          stage,
+	}, nil
+}
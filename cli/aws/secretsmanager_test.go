@@ -0,0 +1,283 @@
+package aws
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+)
+
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	fnCreate func(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error)
+	fnDelete func(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error)
+	fnGet    func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+	fnPut    func(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error)
+}
+
+func (m *mockSecretsManager) CreateSecret(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+	return m.fnCreate(input)
+}
+
+func (m *mockSecretsManager) DeleteSecret(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error) {
+	return m.fnDelete(input)
+}
+
+func (m *mockSecretsManager) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	return m.fnGet(input)
+}
+
+func (m *mockSecretsManager) PutSecretValue(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	return m.fnPut(input)
+}
+
+func notFound() error {
+	return awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "", fmt.Errorf(""))
+}
+
+func TestSecretsManagerDelete(t *testing.T) {
+	is := is.New(t)
+
+	// With recovery window
+	var got *secretsmanager.DeleteSecretInput
+	provider := SecretsManagerProvider{
+		recoveryWindow: 7,
+		sm: &mockSecretsManager{
+			fnDelete: func(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error) {
+				got = input
+				return nil, nil
+			},
+		},
+	}
+
+	is.NoErr(provider.Delete("test"))
+	is.Equal(*got.SecretId, "test")
+	is.Equal(*got.RecoveryWindowInDays, int64(7))
+	is.True(got.ForceDeleteWithoutRecovery == nil)
+
+	// With forced delete
+	provider.force = true
+	is.NoErr(provider.Delete("test"))
+	is.True(*got.ForceDeleteWithoutRecovery)
+	is.True(got.RecoveryWindowInDays == nil)
+
+	// With key error
+	provider.sm = &mockSecretsManager{
+		fnDelete: func(input *secretsmanager.DeleteSecretInput) (*secretsmanager.DeleteSecretOutput, error) {
+			return nil, notFound()
+		},
+	}
+
+	err := provider.Delete("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+}
+
+func TestSecretsManagerGet(t *testing.T) {
+	is := is.New(t)
+
+	// With string value
+	var got *secretsmanager.GetSecretValueInput
+	provider := SecretsManagerProvider{
+		stage: "AWSPREVIOUS",
+		sm: &mockSecretsManager{
+			fnGet: func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+				got = input
+				return &secretsmanager.GetSecretValueOutput{
+					SecretString: aws.String("value"),
+				}, nil
+			},
+		},
+	}
+
+	value, err := provider.Get("test")
+	is.NoErr(err)
+	is.Equal(value, "value")
+	is.Equal(*got.SecretId, "test")
+	is.Equal(*got.VersionStage, "AWSPREVIOUS")
+
+	// With binary value
+	provider.sm = &mockSecretsManager{
+		fnGet: func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+			return &secretsmanager.GetSecretValueOutput{
+				SecretBinary: []byte("binary"),
+			}, nil
+		},
+	}
+
+	value, err = provider.Get("test")
+	is.NoErr(err)
+	is.Equal(value, "binary")
+
+	// With key error
+	provider.sm = &mockSecretsManager{
+		fnGet: func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+			return nil, notFound()
+		},
+	}
+
+	_, err = provider.Get("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+}
+
+func TestSecretsManagerSet(t *testing.T) {
+	is := is.New(t)
+
+	// With existing secret
+	var got_put *secretsmanager.PutSecretValueInput
+	var got_create *secretsmanager.CreateSecretInput
+	mock := &mockSecretsManager{
+		fnPut: func(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+			got_put = input
+			return nil, nil
+		},
+		fnCreate: func(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+			got_create = input
+			return nil, nil
+		},
+	}
+	provider := SecretsManagerProvider{
+		stage: currentStage,
+		sm:    mock,
+	}
+
+	is.NoErr(provider.Set("test", "value"))
+	is.Equal(*got_put.SecretId, "test")
+	is.Equal(*got_put.SecretString, "value")
+	is.Equal(*got_put.VersionStages[0], currentStage)
+	is.True(got_create == nil)
+
+	// With new secret
+	mock.fnPut = func(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		return nil, notFound()
+	}
+
+	is.NoErr(provider.Set("test", "value"))
+	is.Equal(*got_create.Name, "test")
+	is.Equal(*got_create.SecretString, "value")
+	is.True(got_create.KmsKeyId == nil)
+
+	// With new secret and KMS key
+	provider.kmsKey = "alias/default"
+	is.NoErr(provider.Set("test", "value"))
+	is.Equal(*got_create.KmsKeyId, "alias/default")
+
+	// With new secret at a non-current stage
+	provider.stage = "AWSPENDING"
+	err := provider.Set("test", "value")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With AWS error
+	mock.fnPut = func(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	err = provider.Set("test", "value")
+	is.Equal(err.Error(), "error querying AWS: failed")
+}
+
+func TestSecretsManagerCreate(t *testing.T) {
+	is := is.New(t)
+
+	// With no error
+	var got *secretsmanager.CreateSecretInput
+	mock := &mockSecretsManager{
+		fnCreate: func(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+			got = input
+			return nil, nil
+		},
+	}
+	provider := SecretsManagerProvider{
+		stage: currentStage,
+		sm:    mock,
+	}
+
+	is.NoErr(provider.Create("test", "value"))
+	is.Equal(*got.Name, "test")
+	is.Equal(*got.SecretString, "value")
+	is.True(got.KmsKeyId == nil)
+
+	// With KMS keys
+	provider.kmsKey = "alias/default"
+	provider.kmsKeys = map[string]string{
+		"/glab/bootstrap": "alias/bootstrap",
+	}
+
+	is.NoErr(provider.Create("/glab/bootstrap/test", "value"))
+	is.Equal(*got.KmsKeyId, "alias/bootstrap")
+
+	is.NoErr(provider.Create("/glab/other", "value"))
+	is.Equal(*got.KmsKeyId, "alias/default")
+
+	// With existing secret
+	mock.fnCreate = func(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceExistsException, "", fmt.Errorf(""))
+	}
+
+	err := provider.Create("test", "value")
+	is.True(errors.Is(err, gcli.ErrSecretExists))
+
+	// With AWS error
+	mock.fnCreate = func(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	err = provider.Create("test", "value")
+	is.Equal(err.Error(), "error querying AWS: failed")
+
+	// With a non-current stage
+	provider.stage = "AWSPENDING"
+	err = provider.Create("test", "value")
+	is.Equal(err.Error(), "secrets can only be created at the AWSCURRENT stage")
+}
+
+func TestNewSecretsManagerProviderConfig(t *testing.T) {
+	is := is.New(t)
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", 0)
+		for _, f := range append(Flags(), SecretsManagerFlags()...) {
+			is.NoErr(f.Apply(set))
+		}
+		is.NoErr(set.Parse(args))
+		return cli.NewContext(&cli.App{}, set, nil)
+	}
+
+	// With defaults
+	config, err := NewSecretsManagerProviderConfig(newContext("--aws-region", "us-west-2"))
+	is.NoErr(err)
+	is.Equal(*config.config.Region, "us-west-2")
+	is.Equal(config.stage, currentStage)
+	is.Equal(config.recoveryWindow, int64(30))
+	is.True(!config.force)
+
+	// With options
+	config, err = NewSecretsManagerProviderConfig(newContext(
+		"--aws-sm-version-stage", "AWSPREVIOUS",
+		"--aws-sm-recovery-window", "7",
+		"--aws-sm-force-delete",
+		"--aws-kms-key", "alias/default",
+		"--aws-kms-key-map", "/glab/bootstrap=alias/bootstrap",
+	))
+	is.NoErr(err)
+	is.Equal(config.stage, "AWSPREVIOUS")
+	is.Equal(config.recoveryWindow, int64(7))
+	is.True(config.force)
+	is.Equal(config.kmsKey, "alias/default")
+	is.Equal(config.kmsKeys, map[string]string{"/glab/bootstrap": "alias/bootstrap"})
+
+	// With invalid KMS key mapping
+	_, err = NewSecretsManagerProviderConfig(newContext("--aws-kms-key-map", "/glab"))
+	is.Equal(err.Error(), "invalid KMS key mapping: /glab")
+
+	// With invalid recovery window
+	_, err = NewSecretsManagerProviderConfig(newContext("--aws-sm-recovery-window", "90"))
+	is.Equal(err.Error(), "recovery window must be between 7 and 30 days")
+}
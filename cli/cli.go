@@ -18,6 +18,12 @@ type AppResult struct {
 	Success bool        `json:"success"`
 }
 
+// RawResult is implemented by command results which are written to the output
+// as-is instead of being wrapped in an AppResult.
+type RawResult interface {
+	Raw() []byte
+}
+
 // AppError is an error returned from running a CLI command.
 type AppError struct {
 	err error
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/http"
+	"github.com/HomeOperations/jmgilman/cli/lock"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_artifact_arch    = "architecture"
+	flag_artifact_os      = "os"
+	flag_artifact_output  = "output"
+	flag_artifact_product = "product"
+	flag_artifact_version = "version"
+)
+
+// artifactConfig holds dependencies utilized by the artifact subcommand.
+type artifactConfig struct {
+	fs       afero.Fs
+	provider gcli.ArtifactProvider
+}
+
+// newArtifactConfig returns an artifactConfig configured with default
+// dependencies.
+func newArtifactConfig(c *cli.Context) (artifactConfig, error) {
+	verifier, err := newVerifier(c)
+	if err != nil {
+		return artifactConfig{}, err
+	}
+
+	return artifactConfig{
+		fs:       afero.NewOsFs(),
+		provider: http.NewHashiCorpProvider(verifier),
+	}, nil
+}
+
+// artifact returns the artifact subcommand.
+func artifact(a gcli.App) *cli.Command {
+	fetch := &cli.Command{
+		Name:  "fetch",
+		Usage: "Downloads, validates, and extracts the specified HashiCorp binary to the local disk",
+		Action: func(c *cli.Context) error {
+			ac, err := newArtifactConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := fetchArtifact(c, ac)
+			return a.Exit(c, data, err)
+		},
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     flag_artifact_product,
+				Aliases:  []string{"p"},
+				Usage:    "Target product (i.e. consul, nomad, vault)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     flag_artifact_version,
+				Aliases:  []string{"r"},
+				Usage:    "Target product version",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  flag_artifact_os,
+				Usage: "Target operating system",
+				Value: "linux",
+			},
+			&cli.StringFlag{
+				Name:    flag_artifact_arch,
+				Aliases: []string{"a"},
+				Usage:   "Target architecture",
+				Value:   "amd64",
+			},
+			&cli.StringFlag{
+				Name:    flag_artifact_output,
+				Aliases: []string{"o"},
+				Usage:   "Output directory",
+				Value:   ".",
+			},
+		}, append(lockFlags(), verifyFlags()...)...),
+	}
+
+	return &cli.Command{
+		Name:        "artifact",
+		Usage:       "Provides operations for working with signed release artifacts",
+		Subcommands: []*cli.Command{fetch},
+	}
+}
+
+// fetchArtifactResult is the result from calling fetchArtifact().
+type fetchArtifactResult struct {
+	Path    string            `json:"path"`
+	Size    int64             `json:"size"`
+	Version string            `json:"version"`
+	Digests map[string]string `json:"digests"`
+}
+
+// fetchArtifact downloads the specified release archive, validates it, and
+// extracts the binary contained within it to the local disk. The release
+// archive is recorded in the lockfile.
+func fetchArtifact(c *cli.Context, ac artifactConfig) (fetchArtifactResult, error) {
+	product := c.String(flag_artifact_product)
+	version := c.String(flag_artifact_version)
+	target_os := c.String(flag_artifact_os)
+	arch := c.String(flag_artifact_arch)
+	output_dir := c.String(flag_artifact_output)
+
+	source, err := ac.provider.Resolve(product, version, target_os, arch)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+
+	archive_file := filepath.Join(output_dir, fmt.Sprintf("%s_%s_%s_%s.zip", product, version, target_os, arch))
+	archive, err := ac.fs.Create(archive_file)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+	defer ac.fs.Remove(archive_file)
+	defer archive.Close()
+
+	data, _, err := ac.provider.Fetch(product, version, target_os, arch)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+	defer data.Close()
+
+	digester := lock.NewDigester()
+	size, err := io.Copy(io.MultiWriter(archive, digester), data)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+
+	_, err = archive.Seek(0, io.SeekStart) // Reset reader for validation
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+
+	signer, err := ac.provider.Validate(archive, product, version, target_os, arch)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+
+	entry := lock.Entry{
+		Source:  source.URL,
+		Version: source.Version,
+		Size:    size,
+		Digests: digester.Digests(),
+		Signer:  signer.Fingerprint,
+	}
+
+	err = lockArtifact(c, ac.fs, fmt.Sprintf("hashicorp/%s/%s_%s", product, target_os, arch), entry)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+
+	binary := product
+	if target_os == "windows" {
+		binary = fmt.Sprintf("%s.exe", product)
+	}
+
+	output_file := filepath.Join(output_dir, binary)
+	written, err := extract(ac.fs, archive, size, binary, output_file)
+	if err != nil {
+		return fetchArtifactResult{}, err
+	}
+
+	return fetchArtifactResult{
+		Path:    output_file,
+		Size:    written,
+		Version: entry.Version,
+		Digests: entry.Digests,
+	}, nil
+}
+
+// extract writes the file with the given name from the given zip archive to
+// the given output file, returning the number of bytes written.
+func extract(fs afero.Fs, archive io.ReaderAt, size int64, name string, output_file string) (int64, error) {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, f := range reader.File {
+		if f.Name != name {
+			continue
+		}
+
+		src, err := f.Open()
+		if err != nil {
+			return 0, err
+		}
+		defer src.Close()
+
+		out, err := fs.OpenFile(output_file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+		if err != nil {
+			return 0, err
+		}
+		defer out.Close()
+
+		return io.Copy(out, src)
+	}
+
+	return 0, fmt.Errorf("archive does not contain %s", name)
+}
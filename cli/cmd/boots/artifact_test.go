@@ -0,0 +1,156 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/lock"
+	"github.com/HomeOperations/jmgilman/cli/mocks"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+func newArchive(is *is.I, name string, data string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, err := w.Create(name)
+	is.NoErr(err)
+	_, err = f.Write([]byte(data))
+	is.NoErr(err)
+	is.NoErr(w.Close())
+
+	return buf.Bytes()
+}
+
+func TestFetchArtifact(t *testing.T) {
+	is := is.New(t)
+	expected_archive := newArchive(is, "consul", "binary")
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String(flag_artifact_product, "consul", "")
+	flagSet.String(flag_artifact_version, "1.10.3", "")
+	flagSet.String(flag_artifact_os, "linux", "")
+	flagSet.String(flag_artifact_arch, "amd64", "")
+	flagSet.String(flag_artifact_output, "bin", "")
+	flagSet.String(flag_lock_file, "boots.lock", "")
+	flagSet.Bool(flag_lock_locked, false, "")
+	_ = flagSet.Parse([]string{})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	// With no error
+	expected_source := gcli.Source{
+		URL:     "https://releases.hashicorp.com/consul/1.10.3/consul_1.10.3_linux_amd64.zip",
+		Version: "1.10.3",
+	}
+	expected_signer := gcli.Signer{
+		Fingerprint: "C874011F0AB405110D02105534365D9472D7468F",
+	}
+
+	var got_fetch []string
+	var got_resolve []string
+	var got_validate []string
+	var got_data []byte
+	cfg := artifactConfig{
+		fs: afero.NewMemMapFs(),
+		provider: &mocks.MockArtifactProvider{
+			FnFetch: func(product, version, os, arch string) (io.ReadCloser, int64, error) {
+				got_fetch = []string{product, version, os, arch}
+				return io.NopCloser(bytes.NewReader(expected_archive)), int64(len(expected_archive)), nil
+			},
+			FnResolve: func(product, version, os, arch string) (gcli.Source, error) {
+				got_resolve = []string{product, version, os, arch}
+				return expected_source, nil
+			},
+			FnValidate: func(data io.ReadCloser, product, version, os, arch string) (gcli.Signer, error) {
+				got_validate = []string{product, version, os, arch}
+				got_data, _ = io.ReadAll(data)
+				return expected_signer, nil
+			},
+		},
+	}
+
+	result, err := fetchArtifact(ctx, cfg)
+	is.NoErr(err)
+	is.Equal(got_fetch, []string{"consul", "1.10.3", "linux", "amd64"})
+	is.Equal(got_resolve, []string{"consul", "1.10.3", "linux", "amd64"})
+	is.Equal(got_validate, []string{"consul", "1.10.3", "linux", "amd64"})
+	is.Equal(got_data, expected_archive)
+	is.Equal(result.Path, "bin/consul")
+	is.Equal(result.Size, int64(len("binary")))
+
+	file_data, err := afero.ReadFile(cfg.fs, "bin/consul")
+	is.NoErr(err)
+	is.Equal(string(file_data), "binary")
+
+	exists, err := afero.Exists(cfg.fs, "bin/consul_1.10.3_linux_amd64.zip")
+	is.NoErr(err)
+	is.True(!exists)
+
+	lockfile, err := lock.Load(cfg.fs, "boots.lock")
+	is.NoErr(err)
+
+	entry := lockfile.Artifacts["hashicorp/consul/linux_amd64"]
+	is.Equal(entry.Source, expected_source.URL)
+	is.Equal(entry.Version, expected_source.Version)
+	is.Equal(entry.Size, int64(len(expected_archive)))
+	is.Equal(entry.Digests, result.Digests)
+	is.Equal(entry.Signer, expected_signer.Fingerprint)
+
+	// With locked and mismatched version
+	ctx.Set(flag_lock_locked, "true")
+	expected_source.Version = "1.10.4"
+	_, err = fetchArtifact(ctx, cfg)
+	is.True(errors.Is(err, lock.ErrLockMismatch))
+	ctx.Set(flag_lock_locked, "false")
+	expected_source.Version = "1.10.3"
+
+	// With validate error
+	cfg = artifactConfig{
+		fs: afero.NewMemMapFs(),
+		provider: &mocks.MockArtifactProvider{
+			FnFetch: func(product, version, os, arch string) (io.ReadCloser, int64, error) {
+				return io.NopCloser(bytes.NewReader(expected_archive)), int64(len(expected_archive)), nil
+			},
+			FnResolve: func(product, version, os, arch string) (gcli.Source, error) {
+				return expected_source, nil
+			},
+			FnValidate: func(data io.ReadCloser, product, version, os, arch string) (gcli.Signer, error) {
+				return gcli.Signer{}, fmt.Errorf("failed")
+			},
+		},
+	}
+
+	_, err = fetchArtifact(ctx, cfg)
+	is.Equal(err.Error(), "failed")
+
+	exists, err = afero.Exists(cfg.fs, "bin/consul")
+	is.NoErr(err)
+	is.True(!exists)
+
+	// With missing binary
+	wrong_archive := newArchive(is, "nomad", "binary")
+	cfg = artifactConfig{
+		fs: afero.NewMemMapFs(),
+		provider: &mocks.MockArtifactProvider{
+			FnFetch: func(product, version, os, arch string) (io.ReadCloser, int64, error) {
+				return io.NopCloser(bytes.NewReader(wrong_archive)), int64(len(wrong_archive)), nil
+			},
+			FnResolve: func(product, version, os, arch string) (gcli.Source, error) {
+				return expected_source, nil
+			},
+			FnValidate: func(data io.ReadCloser, product, version, os, arch string) (gcli.Signer, error) {
+				return expected_signer, nil
+			},
+		},
+	}
+
+	_, err = fetchArtifact(ctx, cfg)
+	is.Equal(err.Error(), "archive does not contain consul")
+}
@@ -24,8 +24,16 @@ type App struct {
 }
 
 // Exit converts the given data and error into a gcli.AppResult and then writes
-// the marshalled JSON output to the configured output.
+// the marshalled JSON output to the configured output. Successful results
+// implementing gcli.RawResult are written as-is.
 func (a *App) Exit(c *cli.Context, data interface{}, err error) error {
+	if raw, ok := data.(gcli.RawResult); ok && err == nil {
+		if !c.Bool(flag_quiet) {
+			_, err = a.out.Write(raw.Raw())
+		}
+		return err
+	}
+
 	var result gcli.AppResult
 	if err != nil {
 		result = gcli.AppResult{
@@ -55,8 +63,12 @@ func main() {
 		out: os.Stdout,
 	}
 
+	artifact := artifact(&app)
 	image := image(&app)
+	pki := pkiCmd(&app)
 	secret := secret(&app)
+	sshCA := sshCACmd(&app)
+	sysext := sysextCmd(&app)
 
 	cli.VersionFlag = &cli.BoolFlag{
 		Name:    "version",
@@ -68,7 +80,7 @@ func main() {
 		Version:  "v0.1.1",
 		HelpName: "boots",
 		Usage:    "A CLI tool for bootstrapping the GLab stack",
-		Commands: []*cli.Command{image, secret},
+		Commands: []*cli.Command{artifact, image, pki, secret, sshCA, sysext},
 		Before:   initLogger,
 		Flags: []cli.Flag{
 			&cli.BoolFlag{
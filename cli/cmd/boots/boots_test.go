@@ -11,6 +11,23 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+type rawResult string
+
+// newTestContext returns a context with the given flags defined and the given
+// arguments parsed.
+func newTestContext(flags []cli.Flag, args ...string) *cli.Context {
+	flagSet := flag.NewFlagSet("", 0)
+	for _, f := range flags {
+		_ = f.Apply(flagSet)
+	}
+	_ = flagSet.Parse(args)
+	return cli.NewContext(&cli.App{}, flagSet, nil)
+}
+
+func (r rawResult) Raw() []byte {
+	return []byte(r)
+}
+
 func TestExit(t *testing.T) {
 	is := is.New(t)
 	fs := afero.NewMemMapFs()
@@ -57,6 +74,35 @@ func TestExit(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(string(got_data), expected_json_data)
 
+	// With raw result
+	file, err = fs.Create("test")
+	is.NoErr(err)
+
+	app = App{
+		out: file,
+	}
+	err = app.Exit(ctx, rawResult("raw\n"), nil)
+	is.NoErr(err)
+
+	file.Seek(0, io.SeekStart)
+	got_data, err = io.ReadAll(file)
+	is.NoErr(err)
+	is.Equal(string(got_data), "raw\n")
+
+	// With raw result and error
+	file, err = fs.Create("test")
+	is.NoErr(err)
+
+	app = App{
+		out: file,
+	}
+	err = app.Exit(ctx, rawResult("raw\n"), fmt.Errorf("failed"))
+
+	file.Seek(0, io.SeekStart)
+	got_data, err = io.ReadAll(file)
+	is.NoErr(err)
+	is.Equal(string(got_data), `{"data":null,"error":"failed","success":false}`)
+
 	// With quiet
 	file, err = fs.Create("test")
 	is.NoErr(err)
@@ -5,7 +5,9 @@ import (
 	"io"
 
 	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/aws"
 	"github.com/HomeOperations/jmgilman/cli/http"
+	"github.com/HomeOperations/jmgilman/cli/lock"
 	"github.com/spf13/afero"
 	"github.com/urfave/cli/v2"
 )
@@ -13,35 +15,80 @@ import (
 const (
 	flag_image_architecture = "architecture"
 	flag_image_channel      = "channel"
+	flag_image_input        = "input"
 	flag_image_name         = "image"
 	flag_image_output       = "output"
+	flag_image_signature    = "signature"
+	flag_image_source       = "source"
 )
 
 // imageConfig holds dependencies utilized by the image subcommand.
 type imageConfig struct {
-	fs       afero.Fs
-	provider gcli.ImageProvider
+	extension string
+	fs        afero.Fs
+	provider  gcli.ImageProvider
+	publisher gcli.ImagePublisher
 }
 
 // newImageConfig returns an imageConfig configured with default dependencies.
-func newImageConfig(c *cli.Context) imageConfig {
-	return imageConfig{
-		fs:       afero.NewOsFs(),
-		provider: http.NewImageProvider(),
+func newImageConfig(c *cli.Context) (imageConfig, error) {
+	verifier, err := newVerifier(c)
+	if err != nil {
+		return imageConfig{}, err
+	}
+
+	ic := imageConfig{
+		extension: ".sig",
+		fs:        afero.NewOsFs(),
+	}
+	if verifier != nil {
+		ic.extension = verifier.Extension()
+	}
+
+	switch c.String(flag_image_source) {
+	case "http":
+		ic.provider = http.NewImageProvider(verifier)
+	case "s3":
+		pc, err := aws.NewImageProviderConfig(c)
+		if err != nil {
+			return imageConfig{}, err
+		}
+
+		p := aws.NewImageProvider(pc, verifier)
+		ic.provider = &p
+		ic.publisher = &p
+	default:
+		return imageConfig{}, fmt.Errorf("invalid source: %s", c.String(flag_image_source))
 	}
+
+	return ic, nil
 }
 
 // image returns the image subcommand.
 func image(a gcli.App) *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_image_source,
+			Value: "http",
+			Usage: "image source to use (http or s3)",
+		},
+	}
+	flags = append(flags, aws.ImageFlags()...)
+	flags = append(flags, verifyFlags()...)
+
 	fetch := &cli.Command{
 		Name:  "fetch",
 		Usage: "Downloads the specified Container Linux image to the local disk",
 		Action: func(c *cli.Context) error {
-			i := newImageConfig(c)
+			i, err := newImageConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
 			data, err := fetch(c, i)
 			return a.Exit(c, data, err)
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    flag_image_architecture,
 				Aliases: []string{"a"},
@@ -66,23 +113,69 @@ func image(a gcli.App) *cli.Command {
 				Usage:       "Output filename",
 				DefaultText: "target image filename",
 			},
+		}, append(lockFlags(), flags...)...),
+	}
+	publish := &cli.Command{
+		Name:  "publish",
+		Usage: "Validates and uploads a local Container Linux image to the image source",
+		Action: func(c *cli.Context) error {
+			i, err := newImageConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := publish(c, i)
+			return a.Exit(c, data, err)
 		},
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    flag_image_architecture,
+				Aliases: []string{"a"},
+				Usage:   "Target architecture",
+				Value:   "amd64",
+			},
+			&cli.StringFlag{
+				Name:    flag_image_channel,
+				Aliases: []string{"c"},
+				Usage:   "Target channel",
+				Value:   "stable",
+			},
+			&cli.StringFlag{
+				Name:    flag_image_name,
+				Aliases: []string{"i"},
+				Usage:   "Target image filename",
+				Value:   "flatcar_production_image.bin.bz2",
+			},
+			&cli.StringFlag{
+				Name:        flag_image_input,
+				Usage:       "Local image to publish",
+				DefaultText: "target image filename",
+			},
+			&cli.StringFlag{
+				Name:        flag_image_signature,
+				Usage:       "Local signature (or Sigstore bundle) of the image",
+				DefaultText: "input filename with a .sig (or .bundle) suffix",
+			},
+		}, flags...),
 	}
 
 	return &cli.Command{
 		Name:        "image",
 		Usage:       "Provides operations for working with Container Linux images",
-		Subcommands: []*cli.Command{fetch},
+		Subcommands: []*cli.Command{fetch, publish},
 	}
 }
 
 // fetchResult is the result from calling fetch().
 type fetchResult struct {
-	Path string `json:"path"`
-	Size int64  `json:"size"`
+	Path    string            `json:"path"`
+	Size    int64             `json:"size"`
+	Version string            `json:"version"`
+	Digests map[string]string `json:"digests"`
 }
 
-// fetch downloads the specified Container Linux image to the local disk.
+// fetch downloads the specified Container Linux image to the local disk and
+// records it in the lockfile.
 func fetch(c *cli.Context, i imageConfig) (fetchResult, error) {
 	arch := c.String(flag_image_architecture)
 	channel := c.String(flag_image_channel)
@@ -92,24 +185,33 @@ func fetch(c *cli.Context, i imageConfig) (fetchResult, error) {
 	if c.IsSet(flag_image_output) {
 		output_file = c.String(flag_image_output)
 	} else {
-		fmt.Println("Value:", c.String(flag_image_output))
 		output_file = filename
 	}
 
+	name := fmt.Sprintf("flatcar/%s/%s/%s", channel, arch, filename)
+	source, err := i.provider.Resolve(channel, arch, filename)
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	if err := checkLockedVersion(c, i.fs, name, source.Version); err != nil {
+		return fetchResult{}, err
+	}
+
 	out, err := i.fs.Create(output_file)
 	if err != nil {
 		return fetchResult{}, err
 	}
 	defer out.Close()
 
-	data, size, err := i.provider.Fetch(channel, arch, filename)
+	data, _, err := i.provider.Fetch(source)
 	if err != nil {
 		return fetchResult{}, err
 	}
 	defer data.Close()
 
-	_, err = io.Copy(out, data)
-
+	digester := lock.NewDigester()
+	size, err := io.Copy(io.MultiWriter(out, digester), data)
 	if err != nil {
 		return fetchResult{}, err
 	}
@@ -119,13 +221,85 @@ func fetch(c *cli.Context, i imageConfig) (fetchResult, error) {
 		return fetchResult{}, err
 	}
 
-	err = i.provider.Validate(out, channel, arch, filename)
+	signer, err := i.provider.Validate(out, source)
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	entry := lock.Entry{
+		Source:  source.URL,
+		Version: source.Version,
+		Size:    size,
+		Digests: digester.Digests(),
+		Signer:  signer.Fingerprint,
+	}
+
+	err = lockArtifact(c, i.fs, name, entry)
 	if err != nil {
+		out.Close()
+		i.fs.Remove(output_file)
 		return fetchResult{}, err
 	}
 
 	return fetchResult{
-		Path: output_file,
-		Size: size,
+		Path:    output_file,
+		Size:    size,
+		Version: entry.Version,
+		Digests: entry.Digests,
+	}, nil
+}
+
+// publishResult is the result from calling publish().
+type publishResult struct {
+	Path      string `json:"path"`
+	Signature string `json:"signature"`
+}
+
+// publish validates a local Container Linux image against its signature and
+// uploads both to the configured image source.
+func publish(c *cli.Context, i imageConfig) (publishResult, error) {
+	if i.publisher == nil {
+		return publishResult{}, fmt.Errorf("source does not support publishing: %s", c.String(flag_image_source))
+	}
+
+	arch := c.String(flag_image_architecture)
+	channel := c.String(flag_image_channel)
+	filename := c.String(flag_image_name)
+
+	input_file := filename
+	if c.IsSet(flag_image_input) {
+		input_file = c.String(flag_image_input)
+	}
+
+	extension := i.extension
+	if extension == "" {
+		extension = ".sig"
+	}
+
+	sig_file := input_file + extension
+	if c.IsSet(flag_image_signature) {
+		sig_file = c.String(flag_image_signature)
+	}
+
+	data, err := i.fs.Open(input_file)
+	if err != nil {
+		return publishResult{}, err
+	}
+	defer data.Close()
+
+	sig, err := i.fs.Open(sig_file)
+	if err != nil {
+		return publishResult{}, err
+	}
+	defer sig.Close()
+
+	err = i.publisher.Publish(data, sig, channel, arch, filename)
+	if err != nil {
+		return publishResult{}, err
+	}
+
+	return publishResult{
+		Path:      input_file,
+		Signature: sig_file,
 	}, nil
 }
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"testing"
 
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/lock"
 	"github.com/HomeOperations/jmgilman/cli/mocks"
 	"github.com/matryer/is"
 	"github.com/spf13/afero"
@@ -21,55 +24,68 @@ func TestFetch(t *testing.T) {
 	expected_size := int64(expected_data.Len())
 	expected_filename := "flatcar_production_image.bin.bz2"
 	expected_output_file := "image.bin.bz2"
+	expected_source := gcli.Source{
+		URL:     "https://stable.release.flatcar-linux.net/aarch64-usr/3033.1.0/flatcar_production_image.bin.bz2",
+		Version: "3033.1.0",
+	}
+	expected_signer := gcli.Signer{
+		Fingerprint: "F88CFEDEFF29A5B4D9523864E25D9AED0593B34A",
+	}
 
 	flagSet := flag.NewFlagSet("", 0)
 	flagSet.String(flag_image_architecture, expected_arch, "")
 	flagSet.String(flag_image_channel, expected_channel, "")
 	flagSet.String(flag_image_name, expected_filename, "")
 	flagSet.String(flag_image_output, expected_output_file, "")
+	flagSet.String(flag_lock_file, lock.Filename, "")
+	flagSet.Bool(flag_lock_locked, false, "")
 	_ = flagSet.Parse([]string{})
 	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
 	ctx.Set(flag_image_output, expected_output_file)
 
-	var got_fetch_channel string
-	var got_fetch_arch string
-	var got_fetch_filename string
-	var got_validate_channel string
-	var got_validate_arch string
-	var got_validate_filename string
+	var got_fetch_source gcli.Source
+	var got_resolve_channel string
+	var got_resolve_arch string
+	var got_resolve_filename string
+	var got_validate_source gcli.Source
 	var got_data []byte
-	cfg := imageConfig{
-		fs: afero.NewMemMapFs(),
-		provider: &mocks.MockImageProvider{
-			FnFetch: func(channel, arch string, filename string) (io.ReadCloser, int64, error) {
-				got_fetch_channel = channel
-				got_fetch_arch = arch
-				got_fetch_filename = filename
-				return io.NopCloser(expected_data), expected_size, nil
-			},
-			FnValidate: func(data io.ReadCloser, channel, arch string, filename string) error {
-				got_validate_channel = channel
-				got_validate_arch = arch
-				got_validate_filename = filename
-				got_data, _ = io.ReadAll(data)
+	resolved := expected_source
+	provider := &mocks.MockImageProvider{
+		FnFetch: func(source gcli.Source) (io.ReadCloser, int64, error) {
+			got_fetch_source = source
+			return io.NopCloser(bytes.NewReader(expected_data.Bytes())), expected_size, nil
+		},
+		FnResolve: func(channel, arch, filename string) (gcli.Source, error) {
+			got_resolve_channel = channel
+			got_resolve_arch = arch
+			got_resolve_filename = filename
+			return resolved, nil
+		},
+		FnValidate: func(data io.ReadCloser, source gcli.Source) (gcli.Signer, error) {
+			got_validate_source = source
+			got_data, _ = io.ReadAll(data)
 
-				return nil
-			},
+			return expected_signer, nil
 		},
 	}
+	cfg := imageConfig{
+		fs:       afero.NewMemMapFs(),
+		provider: provider,
+	}
 
 	result, err := fetch(ctx, cfg)
 	is.NoErr(err)
-	is.Equal(got_fetch_channel, expected_channel)
-	is.Equal(got_fetch_arch, expected_arch)
-	is.Equal(got_fetch_filename, expected_filename)
-	is.Equal(got_validate_channel, expected_channel)
-	is.Equal(got_validate_arch, expected_arch)
-	is.Equal(got_validate_filename, expected_filename)
+	is.Equal(got_resolve_channel, expected_channel)
+	is.Equal(got_resolve_arch, expected_arch)
+	is.Equal(got_resolve_filename, expected_filename)
+	is.Equal(got_fetch_source, expected_source)
+	is.Equal(got_validate_source, expected_source)
 	is.Equal(string(got_data), "test")
 
 	is.Equal(result.Path, expected_output_file)
 	is.Equal(result.Size, expected_size)
+	is.Equal(result.Version, expected_source.Version)
+	is.Equal(result.Digests["sha256"], "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
 
 	file, err := cfg.fs.Open(expected_output_file)
 	is.NoErr(err)
@@ -78,15 +94,68 @@ func TestFetch(t *testing.T) {
 	is.NoErr(err)
 	is.Equal(string(file_data), "test")
 
+	lockfile, err := lock.Load(cfg.fs, lock.Filename)
+	is.NoErr(err)
+
+	entry := lockfile.Artifacts["flatcar/stable/aarch64/flatcar_production_image.bin.bz2"]
+	is.Equal(entry.Source, expected_source.URL)
+	is.Equal(entry.Version, expected_source.Version)
+	is.Equal(entry.Size, expected_size)
+	is.Equal(entry.Digests, result.Digests)
+	is.Equal(entry.Signer, expected_signer.Fingerprint)
+
+	// With locked and matching artifact
+	ctx.Set(flag_lock_locked, "true")
+	_, err = fetch(ctx, cfg)
+	is.NoErr(err)
+
+	// With locked and mismatched version
+	got_fetch_source = gcli.Source{}
+	resolved = gcli.Source{URL: expected_source.URL, Version: "3033.2.0"}
+	_, err = fetch(ctx, cfg)
+	is.True(errors.Is(err, lock.ErrLockMismatch))
+	is.Equal(got_fetch_source, gcli.Source{}) // refused before downloading
+	resolved = expected_source
+
+	// With locked and mismatched artifact
+	expected_data = bytes.NewBuffer([]byte("tampered"))
+	_, err = fetch(ctx, cfg)
+	is.True(errors.Is(err, lock.ErrLockMismatch))
+
+	exists, err := afero.Exists(cfg.fs, expected_output_file)
+	is.NoErr(err)
+	is.True(!exists)
+
+	// With locked and missing entry
+	_, err = fetch(ctx, imageConfig{fs: afero.NewMemMapFs(), provider: provider})
+	is.True(errors.Is(err, lock.ErrNotLocked))
+	ctx.Set(flag_lock_locked, "false")
+
 	// With fetch error
 	cfg = imageConfig{
 		fs: afero.NewMemMapFs(),
 		provider: &mocks.MockImageProvider{
-			FnFetch: func(channel, arch, filename string) (io.ReadCloser, int64, error) {
+			FnFetch: func(source gcli.Source) (io.ReadCloser, int64, error) {
 				return nil, 0, fmt.Errorf("failed")
 			},
-			FnValidate: func(data io.ReadCloser, channel, arch, filename string) error {
-				return nil
+			FnResolve: func(channel, arch, filename string) (gcli.Source, error) {
+				return expected_source, nil
+			},
+			FnValidate: func(data io.ReadCloser, source gcli.Source) (gcli.Signer, error) {
+				return expected_signer, nil
+			},
+		},
+	}
+
+	_, err = fetch(ctx, cfg)
+	is.Equal(err.Error(), "failed")
+
+	// With resolve error
+	cfg = imageConfig{
+		fs: afero.NewMemMapFs(),
+		provider: &mocks.MockImageProvider{
+			FnResolve: func(channel, arch, filename string) (gcli.Source, error) {
+				return gcli.Source{}, fmt.Errorf("failed")
 			},
 		},
 	}
@@ -98,11 +167,14 @@ func TestFetch(t *testing.T) {
 	cfg = imageConfig{
 		fs: afero.NewMemMapFs(),
 		provider: &mocks.MockImageProvider{
-			FnFetch: func(channel, arch, filename string) (io.ReadCloser, int64, error) {
+			FnFetch: func(source gcli.Source) (io.ReadCloser, int64, error) {
 				return io.NopCloser(expected_data), int64(expected_data.Len()), nil
 			},
-			FnValidate: func(data io.ReadCloser, channel, arch, filename string) error {
-				return fmt.Errorf("failed")
+			FnResolve: func(channel, arch, filename string) (gcli.Source, error) {
+				return expected_source, nil
+			},
+			FnValidate: func(data io.ReadCloser, source gcli.Source) (gcli.Signer, error) {
+				return gcli.Signer{}, fmt.Errorf("failed")
 			},
 		},
 	}
@@ -110,3 +182,75 @@ func TestFetch(t *testing.T) {
 	_, err = fetch(ctx, cfg)
 	is.Equal(err.Error(), "failed")
 }
+
+func TestPublish(t *testing.T) {
+	is := is.New(t)
+	expected_channel := "stable"
+	expected_arch := "amd64"
+	expected_filename := "flatcar_production_image.bin.bz2"
+	expected_input_file := "image.bin.bz2"
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String(flag_image_architecture, expected_arch, "")
+	flagSet.String(flag_image_channel, expected_channel, "")
+	flagSet.String(flag_image_name, expected_filename, "")
+	flagSet.String(flag_image_input, "", "")
+	_ = flagSet.Parse([]string{})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+	ctx.Set(flag_image_input, expected_input_file)
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, expected_input_file, []byte("test"), 0644)
+	afero.WriteFile(fs, expected_input_file+".sig", []byte("testsignature"), 0644)
+
+	// With no error
+	var got_channel string
+	var got_arch string
+	var got_filename string
+	var got_data []byte
+	var got_sig []byte
+	cfg := imageConfig{
+		fs: fs,
+		publisher: &mocks.MockImagePublisher{
+			FnPublish: func(data, signature io.ReadSeeker, channel, arch, filename string) error {
+				got_channel = channel
+				got_arch = arch
+				got_filename = filename
+				got_data, _ = io.ReadAll(data)
+				got_sig, _ = io.ReadAll(signature)
+				return nil
+			},
+		},
+	}
+
+	result, err := publish(ctx, cfg)
+	is.NoErr(err)
+	is.Equal(got_channel, expected_channel)
+	is.Equal(got_arch, expected_arch)
+	is.Equal(got_filename, expected_filename)
+	is.Equal(string(got_data), "test")
+	is.Equal(string(got_sig), "testsignature")
+	is.Equal(result.Path, expected_input_file)
+	is.Equal(result.Signature, expected_input_file+".sig")
+
+	// With missing signature
+	fs.Remove(expected_input_file + ".sig")
+	_, err = publish(ctx, cfg)
+	is.True(err != nil)
+
+	// With publish error
+	afero.WriteFile(fs, expected_input_file+".sig", []byte("testsignature"), 0644)
+	cfg.publisher = &mocks.MockImagePublisher{
+		FnPublish: func(data, signature io.ReadSeeker, channel, arch, filename string) error {
+			return fmt.Errorf("failed")
+		},
+	}
+
+	_, err = publish(ctx, cfg)
+	is.Equal(err.Error(), "failed")
+
+	// With unsupported source
+	cfg.publisher = nil
+	_, err = publish(ctx, cfg)
+	is.True(err != nil)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/HomeOperations/jmgilman/cli/lock"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_lock_file   = "lockfile"
+	flag_lock_locked = "locked"
+)
+
+// lockFlags returns the flags used by subcommands which record fetched
+// artifacts in the lockfile.
+func lockFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_lock_file,
+			Usage: "Path to the lockfile",
+			Value: lock.Filename,
+		},
+		&cli.BoolFlag{
+			Name:  flag_lock_locked,
+			Usage: "Refuse any artifact which doesn't match the lockfile",
+		},
+	}
+}
+
+// lockArtifact checks the given entry against the lockfile if the locked flag
+// is set. Otherwise, the entry is recorded in the lockfile.
+func lockArtifact(c *cli.Context, fs afero.Fs, name string, entry lock.Entry) error {
+	path := lockPath(c)
+	l, err := lock.Load(fs, path)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool(flag_lock_locked) {
+		log.Infof("Checking %s against lockfile", name)
+		return l.Check(name, entry)
+	}
+
+	log.Infof("Recording %s in lockfile", name)
+	l.Set(name, entry)
+	return l.Save(fs, path)
+}
+
+// checkLockedVersion checks the given version against the lockfile if the
+// locked flag is set, so a mismatched artifact is refused before it's
+// downloaded.
+func checkLockedVersion(c *cli.Context, fs afero.Fs, name string, version string) error {
+	if !c.Bool(flag_lock_locked) {
+		return nil
+	}
+
+	l, err := lock.Load(fs, lockPath(c))
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Checking %s version against lockfile", name)
+	return l.CheckVersion(name, version)
+}
+
+// lockPath returns the path to the lockfile given by flag.
+func lockPath(c *cli.Context) string {
+	if path := c.String(flag_lock_file); path != "" {
+		return path
+	}
+
+	return lock.Filename
+}
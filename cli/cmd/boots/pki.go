@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pki"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_pki_common_name = "common-name"
+	flag_pki_datacenter  = "datacenter"
+	flag_pki_force       = "force"
+	flag_pki_output      = "output"
+	flag_pki_prefix      = "prefix"
+	flag_pki_region      = "region"
+	flag_pki_role        = "role"
+	flag_pki_san         = "san"
+	flag_pki_service     = "service"
+	flag_pki_ttl         = "ttl"
+)
+
+// The names CAs are stored under beneath the prefix.
+const (
+	pkiIntermediate = "intermediate"
+	pkiRoot         = "root"
+)
+
+// pkiConfig holds dependencies utilized by the pki subcommand.
+type pkiConfig struct {
+	fs       afero.Fs
+	provider gcli.SecretProvider
+}
+
+// newPKIConfig returns a pkiConfig configured with default dependencies.
+func newPKIConfig(c *cli.Context) (*pkiConfig, error) {
+	provider, err := newSecretProvider(c, c.String(flag_secret_backend))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkiConfig{fs: afero.NewOsFs(), provider: provider}, nil
+}
+
+// pkiCmd returns the pki subcommand.
+func pkiCmd(a gcli.App) *cli.Command {
+	flags := append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_pki_prefix,
+			Value: "/glab/pki",
+			Usage: "path prefix the certificates and keys are stored under",
+		},
+	}, secretBackendFlags()...)
+
+	root := &cli.Command{
+		Name:  "root",
+		Usage: "Creates a root CA",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  flag_pki_common_name,
+				Value: "GLab Root CA",
+				Usage: "common name of the CA",
+			},
+			&cli.DurationFlag{
+				Name:  flag_pki_ttl,
+				Value: 10 * 365 * 24 * time.Hour,
+				Usage: "lifetime of the CA",
+			},
+			&cli.BoolFlag{
+				Name:  flag_pki_force,
+				Usage: "replace an existing CA",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			p, err := newPKIConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := pkiRootCA(c, p)
+			return a.Exit(c, data, err)
+		},
+	}
+	intermediate := &cli.Command{
+		Name:  "intermediate",
+		Usage: "Creates an intermediate CA signed by the root CA",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  flag_pki_common_name,
+				Value: "GLab Intermediate CA",
+				Usage: "common name of the CA",
+			},
+			&cli.DurationFlag{
+				Name:  flag_pki_ttl,
+				Value: 5 * 365 * 24 * time.Hour,
+				Usage: "lifetime of the CA",
+			},
+			&cli.BoolFlag{
+				Name:  flag_pki_force,
+				Usage: "replace an existing CA",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			p, err := newPKIConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := pkiIntermediateCA(c, p)
+			return a.Exit(c, data, err)
+		},
+	}
+	issue := &cli.Command{
+		Name:      "issue",
+		Usage:     "Issues a certificate signed by the intermediate CA",
+		ArgsUsage: "<NAME>",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     flag_pki_service,
+				Usage:    "service the certificate is for (consul, nomad, or vault)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  flag_pki_role,
+				Value: pki.RoleServer,
+				Usage: "role the certificate is for (server, client, or cli)",
+			},
+			&cli.StringFlag{
+				Name:  flag_pki_datacenter,
+				Value: "dc1",
+				Usage: "Consul datacenter the certificate is for",
+			},
+			&cli.StringFlag{
+				Name:  flag_pki_region,
+				Value: "global",
+				Usage: "Nomad region the certificate is for",
+			},
+			&cli.StringSliceFlag{
+				Name:  flag_pki_san,
+				Usage: "additional DNS name or IP address to include in the certificate",
+			},
+			&cli.DurationFlag{
+				Name:  flag_pki_ttl,
+				Value: 365 * 24 * time.Hour,
+				Usage: "lifetime of the certificate",
+			},
+			&cli.StringFlag{
+				Name:    flag_pki_output,
+				Aliases: []string{"o"},
+				Usage:   "directory to write the certificate, key, and CA chain to",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			p, err := newPKIConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := pkiIssue(c, p)
+			return a.Exit(c, data, err)
+		},
+	}
+	bundle := &cli.Command{
+		Name:  "bundle",
+		Usage: "Prints the intermediate CA as a PEM bundle for importing into Vault",
+		Flags: flags,
+		Action: func(c *cli.Context) error {
+			p, err := newPKIConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := pkiBundle(c, p)
+			return a.Exit(c, data, err)
+		},
+	}
+
+	return &cli.Command{
+		Name:        "pki",
+		Usage:       "Manages the bootstrap certificate authority",
+		Subcommands: []*cli.Command{bundle, intermediate, issue, root},
+	}
+}
+
+// pkiCAResult is the result from creating a CA.
+type pkiCAResult struct {
+	Certificate string    `json:"certificate"`
+	Expires     time.Time `json:"expires"`
+	Key         string    `json:"key"`
+	Subject     string    `json:"subject"`
+}
+
+// pkiRootCA creates a root CA and stores it.
+func pkiRootCA(c *cli.Context, p *pkiConfig) (pkiCAResult, error) {
+	name := path.Join(c.String(flag_pki_prefix), pkiRoot)
+	if err := ensureNoSecret(p.provider, name+".crt", c.Bool(flag_pki_force)); err != nil {
+		return pkiCAResult{}, err
+	}
+
+	ca, err := pki.NewRootCA(c.String(flag_pki_common_name), c.Duration(flag_pki_ttl))
+	if err != nil {
+		return pkiCAResult{}, err
+	}
+
+	return storeCA(p.provider, name, ca)
+}
+
+// pkiIntermediateCA creates an intermediate CA signed by the stored root CA
+// and stores it.
+func pkiIntermediateCA(c *cli.Context, p *pkiConfig) (pkiCAResult, error) {
+	name := path.Join(c.String(flag_pki_prefix), pkiIntermediate)
+	if err := ensureNoSecret(p.provider, name+".crt", c.Bool(flag_pki_force)); err != nil {
+		return pkiCAResult{}, err
+	}
+
+	root, err := loadCertificate(p.provider, path.Join(c.String(flag_pki_prefix), pkiRoot))
+	if err != nil {
+		return pkiCAResult{}, err
+	}
+
+	ca, err := root.NewIntermediateCA(c.String(flag_pki_common_name), c.Duration(flag_pki_ttl))
+	if err != nil {
+		return pkiCAResult{}, err
+	}
+
+	return storeCA(p.provider, name, ca)
+}
+
+// pkiIssueResult is the result from calling pkiIssue(). The PEM encoded
+// fields can be consumed by Ansible directly.
+type pkiIssueResult struct {
+	CAChain     []string  `json:"ca_chain"`
+	Certificate string    `json:"certificate"`
+	DNSNames    []string  `json:"dns_names"`
+	Expires     time.Time `json:"expires"`
+	IPAddresses []string  `json:"ip_addresses"`
+	Key         string    `json:"key"`
+	PrivateKey  string    `json:"private_key"`
+	Subject     string    `json:"subject"`
+}
+
+// pkiIssue issues a certificate for a service signed by the stored
+// intermediate CA. The private key is stored alongside the certificate and,
+// if an output directory is given, both are written to it along with the CA
+// chain.
+func pkiIssue(c *cli.Context, p *pkiConfig) (pkiIssueResult, error) {
+	if c.NArg() < 1 {
+		return pkiIssueResult{}, fmt.Errorf("must provide a name")
+	}
+
+	// The name is used as a path segment beneath the prefix alongside the CAs
+	name := c.Args().First()
+	if name == pkiRoot || name == pkiIntermediate {
+		return pkiIssueResult{}, fmt.Errorf("name is reserved for the CA: %s", name)
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return pkiIssueResult{}, fmt.Errorf("invalid name: %s", name)
+	}
+
+	service := c.String(flag_pki_service)
+	location := c.String(flag_pki_datacenter)
+	if service == pki.ServiceNomad {
+		location = c.String(flag_pki_region)
+	}
+
+	req, err := pki.ServiceRequest(service, c.String(flag_pki_role), location, c.Duration(flag_pki_ttl))
+	if err != nil {
+		return pkiIssueResult{}, err
+	}
+	for _, san := range c.StringSlice(flag_pki_san) {
+		if ip := net.ParseIP(san); ip != nil {
+			req.IPAddresses = append(req.IPAddresses, ip)
+		} else {
+			req.DNSNames = append(req.DNSNames, san)
+		}
+	}
+
+	prefix := c.String(flag_pki_prefix)
+	root, err := loadCertificate(p.provider, path.Join(prefix, pkiRoot))
+	if err != nil {
+		return pkiIssueResult{}, err
+	}
+	intermediate, err := loadCertificate(p.provider, path.Join(prefix, pkiIntermediate))
+	if err != nil {
+		return pkiIssueResult{}, err
+	}
+
+	cert, err := intermediate.Issue(req)
+	if err != nil {
+		return pkiIssueResult{}, err
+	}
+
+	secret := path.Join(prefix, name)
+	key, err := storeCertificate(p.provider, secret, cert)
+	if err != nil {
+		return pkiIssueResult{}, err
+	}
+
+	result := pkiIssueResult{
+		CAChain:     []string{string(intermediate.CertificatePEM()), string(root.CertificatePEM())},
+		Certificate: string(cert.CertificatePEM()),
+		DNSNames:    cert.Certificate.DNSNames,
+		Expires:     cert.Certificate.NotAfter,
+		Key:         secret,
+		PrivateKey:  string(key),
+		Subject:     cert.Certificate.Subject.CommonName,
+	}
+	for _, ip := range cert.Certificate.IPAddresses {
+		result.IPAddresses = append(result.IPAddresses, ip.String())
+	}
+
+	if dir := c.String(flag_pki_output); dir != "" {
+		base := filepath.Join(dir, name)
+		files := []struct {
+			path string
+			data string
+			mode os.FileMode
+		}{
+			{base + ".pem", result.Certificate, 0644},
+			{base + "-key.pem", result.PrivateKey, 0600},
+			{filepath.Join(dir, "ca.pem"), result.CAChain[0] + result.CAChain[1], 0644},
+		}
+
+		if err := p.fs.MkdirAll(filepath.Dir(base), 0755); err != nil {
+			return pkiIssueResult{}, err
+		}
+		for _, file := range files {
+			if err := afero.WriteFile(p.fs, file.path, []byte(file.data), file.mode); err != nil {
+				return pkiIssueResult{}, err
+			}
+
+			// Existing files keep their permissions unless changed explicitly
+			if err := p.fs.Chmod(file.path, file.mode); err != nil {
+				return pkiIssueResult{}, err
+			}
+		}
+	}
+
+	log.Infof("Issued certificate for %s expiring %s", result.Subject, result.Expires)
+	return result, nil
+}
+
+// pkiBundleResult is the result from calling pkiBundle().
+type pkiBundleResult struct {
+	Bundle string
+}
+
+// Raw returns the PEM bundle.
+func (p pkiBundleResult) Raw() []byte {
+	return []byte(p.Bundle)
+}
+
+// pkiBundle returns the private key and certificate of the intermediate CA
+// followed by the root certificate. The bundle can be imported into Vault
+// using the pem_bundle parameter of the PKI engine's config/ca endpoint.
+func pkiBundle(c *cli.Context, p *pkiConfig) (pkiBundleResult, error) {
+	prefix := c.String(flag_pki_prefix)
+	root, err := loadCertificate(p.provider, path.Join(prefix, pkiRoot))
+	if err != nil {
+		return pkiBundleResult{}, err
+	}
+	intermediate, err := loadCertificate(p.provider, path.Join(prefix, pkiIntermediate))
+	if err != nil {
+		return pkiBundleResult{}, err
+	}
+
+	key, err := intermediate.KeyPEM()
+	if err != nil {
+		return pkiBundleResult{}, err
+	}
+
+	return pkiBundleResult{
+		Bundle: string(key) + string(intermediate.CertificatePEM()) + string(root.CertificatePEM()),
+	}, nil
+}
+
+// loadCertificate returns the certificate and private key stored under name.
+func loadCertificate(provider gcli.SecretProvider, name string) (pki.Certificate, error) {
+	cert, err := provider.Get(name + ".crt")
+	if err != nil {
+		return pki.Certificate{}, fmt.Errorf("error fetching certificate %s: %w", name, err)
+	}
+
+	key, err := provider.Get(name + ".key")
+	if err != nil {
+		return pki.Certificate{}, fmt.Errorf("error fetching private key %s: %w", name, err)
+	}
+
+	return pki.Parse([]byte(cert), []byte(key))
+}
+
+// storeCertificate stores the certificate and private key under name with .crt
+// and .key appended respectively. Returns the PEM encoded private key.
+func storeCertificate(provider gcli.SecretProvider, name string, cert pki.Certificate) ([]byte, error) {
+	key, err := cert.KeyPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := provider.Set(name+".key", string(key)); err != nil {
+		return nil, err
+	}
+
+	if err := provider.Set(name+".crt", string(cert.CertificatePEM())); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// storeCA stores a CA under name and returns the result describing it.
+func storeCA(provider gcli.SecretProvider, name string, ca pki.Certificate) (pkiCAResult, error) {
+	if _, err := storeCertificate(provider, name, ca); err != nil {
+		return pkiCAResult{}, err
+	}
+
+	log.Infof("Created CA %s expiring %s", ca.Certificate.Subject.CommonName, ca.Certificate.NotAfter)
+	return pkiCAResult{
+		Certificate: string(ca.CertificatePEM()),
+		Expires:     ca.Certificate.NotAfter,
+		Key:         name,
+		Subject:     ca.Certificate.Subject.CommonName,
+	}, nil
+}
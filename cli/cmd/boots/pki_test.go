@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pki"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+// pkiFlags returns the flags used by the pki commands with the given default TTL.
+func pkiFlags(ttl time.Duration) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: flag_pki_common_name, Value: "Test CA"},
+		&cli.StringFlag{Name: flag_pki_datacenter, Value: "dc1"},
+		&cli.BoolFlag{Name: flag_pki_force},
+		&cli.StringFlag{Name: flag_pki_output},
+		&cli.StringFlag{Name: flag_pki_prefix, Value: "/glab/pki"},
+		&cli.StringFlag{Name: flag_pki_region, Value: "global"},
+		&cli.StringFlag{Name: flag_pki_role, Value: pki.RoleServer},
+		&cli.StringSliceFlag{Name: flag_pki_san},
+		&cli.StringFlag{Name: flag_pki_service},
+		&cli.DurationFlag{Name: flag_pki_ttl, Value: ttl},
+	}
+}
+
+func TestPKI(t *testing.T) {
+	is := is.New(t)
+	secrets := make(map[string]string)
+	p := pkiConfig{
+		fs:       afero.NewMemMapFs(),
+		provider: newMapProvider(secrets),
+	}
+
+	// With no root CA
+	_, err := pkiIntermediateCA(newTestContext(pkiFlags(time.Hour)), &p)
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With root CA
+	root, err := pkiRootCA(newTestContext(pkiFlags(2*time.Hour)), &p)
+	is.NoErr(err)
+	is.Equal(root.Key, "/glab/pki/root")
+	is.Equal(secrets["/glab/pki/root.crt"], root.Certificate)
+
+	_, err = pkiRootCA(newTestContext(pkiFlags(time.Hour)), &p)
+	is.Equal(err.Error(), "/glab/pki/root.crt already exists; pass --force to replace it")
+
+	// With intermediate CA
+	_, err = pkiIntermediateCA(newTestContext(pkiFlags(time.Hour), "--common-name", "Test Intermediate CA"), &p)
+	is.NoErr(err)
+
+	// With issued certificate
+	result, err := pkiIssue(newTestContext(pkiFlags(time.Hour), "--service", "nomad", "--san", "nomad.glab.lan", "--san", "10.0.0.5", "--output", "/certs", "nomad-server"), &p)
+	is.NoErr(err)
+	is.Equal(result.Key, "/glab/pki/nomad-server")
+	is.Equal(result.Subject, "server.global.nomad")
+	is.Equal(result.DNSNames, []string{"server.global.nomad", "localhost", "nomad.glab.lan"})
+	is.Equal(result.IPAddresses, []string{"127.0.0.1", "10.0.0.5"})
+	is.Equal(secrets["/glab/pki/nomad-server.key"], result.PrivateKey)
+
+	block, _ := pem.Decode([]byte(result.Certificate))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	is.NoErr(err)
+	roots := x509.NewCertPool()
+	is.True(roots.AppendCertsFromPEM([]byte(result.CAChain[1])))
+	intermediates := x509.NewCertPool()
+	is.True(intermediates.AppendCertsFromPEM([]byte(result.CAChain[0])))
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "nomad.glab.lan", Intermediates: intermediates, Roots: roots})
+	is.NoErr(err)
+
+	data, err := afero.ReadFile(p.fs, "/certs/nomad-server-key.pem")
+	is.NoErr(err)
+	is.Equal(string(data), result.PrivateKey)
+	info, err := p.fs.Stat("/certs/nomad-server-key.pem")
+	is.NoErr(err)
+	is.Equal(info.Mode().Perm(), os.FileMode(0600))
+	data, err = afero.ReadFile(p.fs, "/certs/ca.pem")
+	is.NoErr(err)
+	is.Equal(string(data), result.CAChain[0]+result.CAChain[1])
+
+	// With invalid service
+	_, err = pkiIssue(newTestContext(pkiFlags(time.Hour), "--service", "boundary", "boundary"), &p)
+	is.Equal(err.Error(), "unknown service: boundary")
+
+	// With a name reserved for a CA
+	root_key := secrets["/glab/pki/root.key"]
+	_, err = pkiIssue(newTestContext(pkiFlags(time.Hour), "--service", "nomad", "root"), &p)
+	is.Equal(err.Error(), "name is reserved for the CA: root")
+	_, err = pkiIssue(newTestContext(pkiFlags(time.Hour), "--service", "nomad", "intermediate"), &p)
+	is.Equal(err.Error(), "name is reserved for the CA: intermediate")
+	is.Equal(secrets["/glab/pki/root.key"], root_key)
+
+	// With a name outside of the prefix
+	_, err = pkiIssue(newTestContext(pkiFlags(time.Hour), "--service", "nomad", "../x"), &p)
+	is.Equal(err.Error(), "invalid name: ../x")
+	_, err = pkiIssue(newTestContext(pkiFlags(time.Hour), "--service", "nomad", ".."), &p)
+	is.Equal(err.Error(), "invalid name: ..")
+
+	// With bundle
+	bundle, err := pkiBundle(newTestContext(pkiFlags(time.Hour)), &p)
+	is.NoErr(err)
+	is.Equal(string(bundle.Raw()), secrets["/glab/pki/intermediate.key"]+secrets["/glab/pki/intermediate.crt"]+secrets["/glab/pki/root.crt"])
+}
@@ -1,29 +1,80 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	gcli "github.com/HomeOperations/jmgilman/cli"
 	"github.com/HomeOperations/jmgilman/cli/aws"
+	"github.com/HomeOperations/jmgilman/cli/consul"
+	"github.com/HomeOperations/jmgilman/cli/file"
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
+	"github.com/HomeOperations/jmgilman/cli/vault"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"github.com/urfave/cli/v2"
 )
 
 const (
-	flag_secret_backend = "backend"
-	flag_secret_length  = "length"
-	flag_secret_numbers = "numbers"
-	flag_secret_symbols = "symbols"
+	flag_secret_allowed    = "allowed-symbols"
+	flag_secret_ambiguous  = "exclude-ambiguous"
+	flag_secret_backend    = "backend"
+	flag_secret_bits       = "bits"
+	flag_secret_bytes      = "bytes"
+	flag_secret_chunk      = "chunk-size"
+	flag_secret_comment    = "comment"
+	flag_secret_conflict   = "on-conflict"
+	flag_secret_desc       = "description"
+	flag_secret_dry_run    = "dry-run"
+	flag_secret_force      = "force"
+	flag_secret_format     = "format"
+	flag_secret_from       = "from"
+	flag_secret_if_missing = "if-missing"
+	flag_secret_keyfile    = "keyfile"
+	flag_secret_length     = "length"
+	flag_secret_map        = "map"
+	flag_secret_numbers    = "numbers"
+	flag_secret_output     = "output"
+	flag_secret_passphrase = "passphrase"
+	flag_secret_policy     = "policy"
+	flag_secret_policies   = "policy-file"
+	flag_secret_prefix     = "prefix"
+	flag_secret_recurse    = "recursive"
+	flag_secret_reveal     = "reveal"
+	flag_secret_separator  = "separator"
+	flag_secret_shell      = "shell"
+	flag_secret_symbols    = "symbols"
+	flag_secret_tag        = "tag"
+	flag_secret_to         = "to"
+	flag_secret_type       = "type"
+	flag_secret_values     = "values"
+	flag_secret_version    = "version"
+	flag_secret_words      = "words"
 )
 
 // secretConfig holds dependencies utilized by the secret subcommand.
 type secretConfig struct {
+	fs       afero.Fs
 	provider gcli.SecretProvider
 }
 
 // newSecretConfig returns a secretConfig configured with default dependencies.
 func newSecretsConfig(c *cli.Context) (*secretConfig, error) {
-	sc := &secretConfig{}
-	switch c.String(flag_secret_backend) {
+	provider, err := newSecretProvider(c, c.String(flag_secret_backend))
+	if err != nil {
+		return nil, err
+	}
+
+	return &secretConfig{fs: afero.NewOsFs(), provider: provider}, nil
+}
+
+// newSecretProvider returns the SecretProvider for the given backend
+// configured using the flags in the passed cli.Context.
+func newSecretProvider(c *cli.Context, backend string) (gcli.SecretProvider, error) {
+	switch backend {
 	case "aws":
 		pc, err := aws.NewSecretProviderConfig(c)
 		if err != nil {
@@ -31,46 +82,149 @@ func newSecretsConfig(c *cli.Context) (*secretConfig, error) {
 		}
 
 		p := aws.NewSecretProvider(pc)
-		sc.provider = &p
+		return &p, nil
+	case "aws-sm":
+		pc, err := aws.NewSecretsManagerProviderConfig(c)
+		if err != nil {
+			return nil, err
+		}
+
+		p := aws.NewSecretsManagerProvider(pc)
+		return &p, nil
+	case "consul":
+		pc, err := consul.NewSecretProviderConfig(c)
+		if err != nil {
+			return nil, err
+		}
+
+		p := consul.NewSecretProvider(pc)
+		return &p, nil
+	case "file":
+		pc, err := file.NewSecretProviderConfig(c)
+		if err != nil {
+			return nil, err
+		}
+
+		p := file.NewSecretProvider(pc)
+		return &p, nil
+	case "vault":
+		pc, err := vault.NewSecretProviderConfig(c)
+		if err != nil {
+			return nil, err
+		}
+
+		p := vault.NewSecretProvider(pc)
+		return &p, nil
 	default:
-		return nil, fmt.Errorf("invalid backend: %s", c.String(flag_secret_backend))
+		return nil, fmt.Errorf("invalid backend: %s", backend)
 	}
+}
 
-	return sc, nil
+// secretProviderFlags returns the flags for configuring each secret backend.
+func secretProviderFlags() []cli.Flag {
+	var flags []cli.Flag
+	flags = append(flags, aws.Flags()...)
+	flags = append(flags, aws.SecretsManagerFlags()...)
+	flags = append(flags, consul.Flags()...)
+	flags = append(flags, file.Flags()...)
+	flags = append(flags, vault.Flags()...)
+
+	return flags
 }
 
-// secret returns the secret subcommand.
-func secret(a gcli.App) *cli.Command {
-	flags := []cli.Flag{
+// secretBackendFlags returns the flags for selecting and configuring the
+// secret backend.
+func secretBackendFlags() []cli.Flag {
+	return append([]cli.Flag{
 		&cli.StringFlag{
-			Name:  "backend",
+			Name:  flag_secret_backend,
 			Value: "aws",
-			Usage: "secret backend to use",
+			Usage: "secret backend to use (aws, aws-sm, consul, file, or vault)",
 		},
-	}
-	flags = append(flags, aws.Flags()...)
+	}, secretProviderFlags()...)
+}
+
+// secret returns the secret subcommand.
+func secret(a gcli.App) *cli.Command {
+	backendFlags := secretProviderFlags()
+	flags := secretBackendFlags()
 
 	gen_flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    flag_secret_type,
+			Aliases: []string{"t"},
+			Value:   gen.TypePassword,
+			Usage:   "type of value to generate (password, passphrase, hex, base64, uuid, alnum, acl-token, consul-gossip, nomad-gossip, vault-unseal-placeholder, wireguard, or age)",
+		},
+		&cli.StringFlag{
+			Name:    flag_secret_policy,
+			Aliases: []string{"p"},
+			Value:   gen.DefaultPolicy,
+			Usage:   "name of the generation policy to use",
+		},
+		&cli.StringFlag{
+			Name:    flag_secret_policies,
+			Usage:   "path to a YAML file of additional generation policies",
+			EnvVars: []string{"BOOTS_GENERATE_POLICIES"},
+		},
 		&cli.IntFlag{
 			Name:    flag_secret_length,
 			Aliases: []string{"l"},
-			Value:   16,
-			Usage:   "length of the generated password",
+			Usage:   "length of the generated password or alnum value (overrides the policy)",
 		},
 		&cli.IntFlag{
 			Name:    flag_secret_numbers,
 			Aliases: []string{"n"},
-			Value:   1,
-			Usage:   "The quantity of numbers to include in the password",
+			Usage:   "minimum quantity of numbers to include in the password, 0 excludes them (overrides the policy)",
 		},
 		&cli.IntFlag{
 			Name:    flag_secret_symbols,
 			Aliases: []string{"s"},
-			Value:   1,
-			Usage:   "The quantity of symbols to include in the password",
+			Usage:   "minimum quantity of symbols to include in the password, 0 excludes them (overrides the policy)",
+		},
+		&cli.StringFlag{
+			Name:  flag_secret_allowed,
+			Usage: "symbols which may be included in the password (overrides the policy)",
+		},
+		&cli.BoolFlag{
+			Name:  flag_secret_ambiguous,
+			Usage: "exclude easily confused characters from the password",
+		},
+		&cli.IntFlag{
+			Name:  flag_secret_words,
+			Value: gen.DefaultWords,
+			Usage: "number of words in the generated passphrase",
+		},
+		&cli.StringFlag{
+			Name:  flag_secret_separator,
+			Value: "-",
+			Usage: "separator placed between the words of the generated passphrase",
+		},
+		&cli.IntFlag{
+			Name:  flag_secret_bytes,
+			Value: gen.DefaultTokenBytes,
+			Usage: "number of random bytes in the generated hex or base64 token",
+		},
+		&cli.BoolFlag{
+			Name:  flag_secret_if_missing,
+			Usage: "only store the generated value if the key doesn't already exist",
+		},
+		&cli.BoolFlag{
+			Name:  flag_secret_reveal,
+			Usage: "include the stored value in the result when using --if-missing",
 		},
 	}
-	gen_flags = append(flags, gen_flags...)
+	annotate_flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_secret_desc,
+			Usage: "description of what the secret is for",
+		},
+		&cli.StringSliceFlag{
+			Name:  flag_secret_tag,
+			Usage: "tag to attach to the secret (KEY=VALUE)",
+		},
+	}
+	gen_flags = append(append(flags, annotate_flags...), gen_flags...)
 
 	delete := &cli.Command{
 		Name:      "delete",
@@ -102,11 +256,167 @@ func secret(a gcli.App) *cli.Command {
 			return a.Exit(c, data, err)
 		},
 	}
+	encryptionFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    flag_secret_passphrase,
+			Usage:   "passphrase used to encrypt or decrypt the secrets file",
+			EnvVars: []string{"BOOTS_SECRETS_PASSPHRASE"},
+		},
+		&cli.StringFlag{
+			Name:  flag_secret_keyfile,
+			Usage: "path to a keyfile used to encrypt or decrypt the secrets file",
+		},
+	}
+	describe := &cli.Command{
+		Name:      "describe",
+		Usage:     "Fetches the metadata of a secret",
+		ArgsUsage: "<KEY>",
+		Flags:     flags,
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := describe(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	envCmd := &cli.Command{
+		Name:      "env",
+		Usage:     "Prints shell statements exporting secrets as environment variables",
+		ArgsUsage: "<MAPPING_FILE>",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  flag_secret_shell,
+				Usage: "shell syntax to print (bash, fish, or powershell)",
+				Value: shellBash,
+			},
+			&cli.StringFlag{
+				Name:  flag_secret_format,
+				Usage: "mapping file format (yaml, json, or dotenv); detected from the file name by default",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := env(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	execCmd := &cli.Command{
+		Name:      "exec",
+		Usage:     "Runs a command with secrets injected into its environment",
+		ArgsUsage: "-- <COMMAND> [ARGS...]",
+		Flags: append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  flag_secret_map,
+				Usage: "set environment variable NAME to the value of the secret KEY (NAME=KEY)",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			e, err := newExecConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			code, err := execSecrets(c, e)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+			if code != 0 {
+				return cli.Exit("", code)
+			}
+
+			return nil
+		},
+	}
+	export := &cli.Command{
+		Name:  "export",
+		Usage: "Exports secrets under a path prefix to a file",
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  flag_secret_prefix,
+				Usage: "path prefix of the secrets to export",
+			},
+			&cli.BoolFlag{
+				Name:    flag_secret_recurse,
+				Aliases: []string{"r"},
+				Usage:   "include secrets in nested paths",
+			},
+			&cli.StringFlag{
+				Name:     flag_secret_output,
+				Aliases:  []string{"o"},
+				Usage:    "file to write the secrets to",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  flag_secret_format,
+				Usage: "file format (yaml, json, or dotenv); detected from the output file by default",
+			},
+		}, encryptionFlags...), flags...),
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := exportSecrets(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	generateSSH := &cli.Command{
+		Name:      "generate-ssh",
+		Usage:     "Generates a new SSH keypair and prints the public key",
+		ArgsUsage: "<KEY>",
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    flag_secret_type,
+				Aliases: []string{"t"},
+				Value:   gen.SSHKeyED25519,
+				Usage:   "type of key to generate (ed25519, rsa, or ecdsa)",
+			},
+			&cli.IntFlag{
+				Name:  flag_secret_bits,
+				Usage: "size of RSA keys (default 4096) or curve size of ECDSA keys (default 256)",
+			},
+			&cli.StringFlag{
+				Name:  flag_secret_comment,
+				Usage: "comment to attach to the key",
+			},
+			&cli.IntFlag{
+				Name:  flag_secret_chunk,
+				Value: defaultChunkSize,
+				Usage: "private keys larger than this are split into chunks",
+			},
+			&cli.BoolFlag{
+				Name:  flag_secret_force,
+				Usage: "replace an existing keypair",
+			},
+		}, annotate_flags...), flags...),
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := generateSSH(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
 	get := &cli.Command{
 		Name:      "get",
 		Usage:     "Fetches a secret",
 		ArgsUsage: "<KEY>",
-		Flags:     flags,
+		Flags: append([]cli.Flag{
+			&cli.Int64Flag{
+				Name:  flag_secret_version,
+				Usage: "fetch the given version instead of the latest",
+			},
+		}, flags...),
 		Action: func(c *cli.Context) error {
 			s, err := newSecretsConfig(c)
 			if err != nil {
@@ -117,11 +427,148 @@ func secret(a gcli.App) *cli.Command {
 			return a.Exit(c, data, err)
 		},
 	}
+	history := &cli.Command{
+		Name:      "history",
+		Usage:     "Lists the versions of a secret",
+		ArgsUsage: "<KEY>",
+		Flags:     flags,
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := history(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	importCmd := &cli.Command{
+		Name:      "import",
+		Usage:     "Imports secrets from a file",
+		ArgsUsage: "<FILE>",
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  flag_secret_conflict,
+				Usage: "action to take when a secret already exists (skip, overwrite, or fail)",
+				Value: conflictFail,
+			},
+			&cli.StringFlag{
+				Name:  flag_secret_format,
+				Usage: "file format (yaml, json, or dotenv); detected from the file name by default",
+			},
+		}, encryptionFlags...), flags...),
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := importSecrets(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	list := &cli.Command{
+		Name:      "list",
+		Usage:     "Lists secrets under a path prefix",
+		ArgsUsage: "[PREFIX]",
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{
+				Name:    flag_secret_recurse,
+				Aliases: []string{"r"},
+				Usage:   "include secrets in nested paths",
+			},
+			&cli.BoolFlag{
+				Name:  flag_secret_values,
+				Usage: "include secret values in the output",
+			},
+			&cli.StringSliceFlag{
+				Name:  flag_secret_tag,
+				Usage: "only include secrets with the given tag (KEY=VALUE)",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := list(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	migrate := &cli.Command{
+		Name:  "migrate",
+		Usage: "Copies secrets under a path prefix from one backend to another",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     flag_secret_from,
+				Usage:    "backend to copy secrets from",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     flag_secret_to,
+				Usage:    "backend to copy secrets to",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  flag_secret_prefix,
+				Usage: "path prefix of the secrets to migrate",
+			},
+			&cli.BoolFlag{
+				Name:    flag_secret_recurse,
+				Aliases: []string{"r"},
+				Usage:   "include secrets in nested paths",
+			},
+			&cli.StringSliceFlag{
+				Name:  flag_secret_map,
+				Usage: "rewrite keys starting with FROM to start with TO (FROM=TO); the longest match wins",
+			},
+			&cli.StringFlag{
+				Name:  flag_secret_conflict,
+				Usage: "action to take when a secret already exists in the destination (skip, overwrite, or fail)",
+				Value: conflictFail,
+			},
+			&cli.BoolFlag{
+				Name:  flag_secret_dry_run,
+				Usage: "only print the migration plan",
+			},
+		}, backendFlags...),
+		Action: func(c *cli.Context) error {
+			m, err := newMigrateConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := migrate(c, m)
+			return a.Exit(c, data, err)
+		},
+	}
+	rollback := &cli.Command{
+		Name:      "rollback",
+		Usage:     "Restores a previous version of a secret",
+		ArgsUsage: "<KEY> <VERSION>",
+		Flags:     flags,
+		Action: func(c *cli.Context) error {
+			s, err := newSecretsConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := rollback(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
 	set := &cli.Command{
 		Name:      "set",
 		Usage:     "Sets a secret",
 		ArgsUsage: "<KEY> <VALUE>",
-		Flags:     flags,
+		Flags: append(append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    flag_secret_type,
+				Aliases: []string{"t"},
+				Usage:   "validate the value is correctly formatted for the given generator type",
+			},
+		}, annotate_flags...), flags...),
 		Action: func(c *cli.Context) error {
 			s, err := newSecretsConfig(c)
 			if err != nil {
@@ -136,7 +583,7 @@ func secret(a gcli.App) *cli.Command {
 	return &cli.Command{
 		Name:        "secret",
 		Usage:       "Provides CRUD operations for secrets",
-		Subcommands: []*cli.Command{delete, generate, get, set},
+		Subcommands: []*cli.Command{delete, describe, envCmd, execCmd, export, generate, generateSSH, get, history, importCmd, list, migrate, rollback, set},
 	}
 }
 
@@ -161,69 +608,523 @@ func delete(c *cli.Context, s *secretConfig) (deleteResult, error) {
 	}, nil
 }
 
+// describeResult is the result from calling describe().
+type describeResult struct {
+	gcli.SecretMetadata
+}
+
+// describe fetches the metadata of a secret.
+func describe(c *cli.Context, s *secretConfig) (describeResult, error) {
+	if c.NArg() < 1 {
+		return describeResult{}, fmt.Errorf("must provide a key")
+	}
+
+	annotator, ok := s.provider.(gcli.SecretAnnotator)
+	if !ok {
+		return describeResult{}, gcli.ErrUnsupported
+	}
+
+	metadata, err := annotator.Describe(c.Args().First())
+	if err != nil {
+		return describeResult{}, err
+	}
+
+	return describeResult{SecretMetadata: metadata}, nil
+}
+
 // generateResult is the result from calling generate().
 type generateResult struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Created   bool    `json:"created"`
+	Entropy   float64 `json:"entropy"`
+	Key       string  `json:"key"`
+	Policy    string  `json:"policy,omitempty"`
+	PublicKey string  `json:"public_key,omitempty"`
+	Type      string  `json:"type"`
+	Value     string  `json:"value,omitempty"`
 }
 
-// generate generates a new random secret.
+// generate generates a new random secret of the type given by flag and sets
+// it. Keypair types store the private key under the key and the public key
+// with .pub appended, and return only the public key. If --if-missing is
+// given, an existing secret is left untouched and the value is only returned
+// if --reveal is also given.
 func generate(c *cli.Context, s *secretConfig) (generateResult, error) {
 	if c.NArg() < 1 {
 		return generateResult{}, fmt.Errorf("must provide a key")
 	}
 
-	value, err := s.provider.Generate(c.Args().First(), c.Int(flag_secret_length), c.Int(flag_secret_numbers), c.Int(flag_secret_symbols))
+	annotator, description, tags, err := secretAnnotations(c, s.provider)
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	typ := c.String(flag_secret_type)
+	if typ == "" {
+		typ = gen.TypePassword
+	}
+
+	switch typ {
+	case gen.TypeAge:
+		return generateKeyPair(c, s, typ, gen.AgeKey{}, annotator, description, tags)
+	case gen.TypeWireGuard:
+		return generateKeyPair(c, s, typ, gen.WireGuardKey{}, annotator, description, tags)
+	}
+
+	generator, err := newGenerator(c, s.fs, typ)
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	value, err := generator.Generate()
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	key := c.Args().First()
+	created, err := storeSecret(c, s.provider, annotator, key, value, description, tags)
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	result := generateResult{
+		Created: created,
+		Entropy: math.Floor(generator.Entropy()*10) / 10,
+		Key:     key,
+		Type:    typ,
+		Value:   value,
+	}
+	if typ == gen.TypePassword {
+		result.Policy = c.String(flag_secret_policy)
+	}
+
+	if c.Bool(flag_secret_if_missing) {
+		switch {
+		case !c.Bool(flag_secret_reveal):
+			result.Value = ""
+		case !created:
+			result.Value, err = getChunked(s.provider, key)
+			if err != nil {
+				return generateResult{}, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// generateKeyPair generates a new keypair using generator and sets the private
+// and public keys.
+func generateKeyPair(c *cli.Context, s *secretConfig, typ string, generator gen.KeyPairGenerator, annotator gcli.SecretAnnotator, description string, tags map[string]string) (generateResult, error) {
+	pair, err := generator.GenerateKeyPair()
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	key := c.Args().First()
+	created, err := storeSecret(c, s.provider, annotator, key, pair.Private, description, tags)
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	if created {
+		err = setSecret(s.provider, annotator, key+".pub", pair.Public, description, tags)
+	} else {
+		pair.Public, err = s.provider.Get(key + ".pub")
+	}
 	if err != nil {
 		return generateResult{}, err
 	}
 
 	return generateResult{
-		Key:   c.Args().First(),
-		Value: value,
+		Created:   created,
+		Entropy:   generator.Entropy(),
+		Key:       key,
+		PublicKey: pair.Public,
+		Type:      typ,
 	}, nil
 }
 
+// storeSecret sets a generated secret, or creates it if --if-missing is given.
+// Returns whether the value was stored.
+func storeSecret(c *cli.Context, provider gcli.SecretProvider, annotator gcli.SecretAnnotator, key string, value string, description string, tags map[string]string) (bool, error) {
+	if !c.Bool(flag_secret_if_missing) {
+		return true, setSecret(provider, annotator, key, value, description, tags)
+	}
+
+	var err error
+	if annotator != nil {
+		creator, ok := provider.(gcli.SecretAnnotatedCreator)
+		if !ok {
+			return false, gcli.ErrUnsupported
+		}
+		err = creator.CreateAnnotated(key, value, description, tags)
+	} else {
+		creator, ok := provider.(gcli.SecretCreator)
+		if !ok {
+			return false, gcli.ErrUnsupported
+		}
+		err = creator.Create(key, value)
+	}
+
+	if errors.Is(err, gcli.ErrSecretExists) {
+		log.Infof("Secret %s already exists; leaving it unchanged", key)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// newGenerator returns a generator for the given type configured by flag.
+func newGenerator(c *cli.Context, fs afero.Fs, typ string) (gen.Generator, error) {
+	switch typ {
+	case gen.TypePassword:
+		return newPolicy(c, fs)
+	case gen.TypePassphrase:
+		return gen.Passphrase{
+			Words:     c.Int(flag_secret_words),
+			Separator: c.String(flag_secret_separator),
+		}, nil
+	case gen.TypeHex, gen.TypeBase64:
+		return gen.Token{
+			Bytes:    c.Int(flag_secret_bytes),
+			Encoding: typ,
+		}, nil
+	case gen.TypeUUID, gen.TypeACLToken:
+		return gen.UUID{}, nil
+	case gen.TypeConsulGossip, gen.TypeNomadGossip:
+		return gen.GossipKey{}, nil
+	case gen.TypeVaultUnsealPlaceholder:
+		return gen.Placeholder{Value: gen.VaultUnsealPlaceholder}, nil
+	case gen.TypeAlnum:
+		length := gen.Policies["alphanumeric"].Length
+		if c.IsSet(flag_secret_length) {
+			length = c.Int(flag_secret_length)
+		}
+		return gen.Policy{Length: length, NoSymbols: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown type: %s", typ)
+	}
+}
+
+// newPolicy returns the generation policy named by flag with any overrides
+// given by flag applied.
+func newPolicy(c *cli.Context, fs afero.Fs) (gen.Policy, error) {
+	policies := gen.Policies
+	if path := c.String(flag_secret_policies); path != "" {
+		data, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return gen.Policy{}, err
+		}
+
+		policies, err = gen.LoadPolicies(data)
+		if err != nil {
+			return gen.Policy{}, err
+		}
+	}
+
+	name := c.String(flag_secret_policy)
+	if name == "" {
+		name = gen.DefaultPolicy
+	}
+
+	policy, ok := policies[name]
+	if !ok {
+		return gen.Policy{}, fmt.Errorf("unknown policy: %s", name)
+	}
+
+	if c.IsSet(flag_secret_length) {
+		policy.Length = c.Int(flag_secret_length)
+	}
+	// An explicit zero excludes the class rather than only dropping its minimum
+	if c.IsSet(flag_secret_numbers) {
+		policy.MinDigits = c.Int(flag_secret_numbers)
+		policy.NoDigits = policy.MinDigits == 0
+	}
+	if c.IsSet(flag_secret_symbols) {
+		policy.MinSymbols = c.Int(flag_secret_symbols)
+		policy.NoSymbols = policy.MinSymbols == 0
+	}
+	if c.IsSet(flag_secret_allowed) {
+		policy.AllowedSymbols = c.String(flag_secret_allowed)
+	}
+	if c.Bool(flag_secret_ambiguous) {
+		policy.ExcludeAmbiguous = true
+	}
+
+	return policy, policy.Validate()
+}
+
 // getResult is the result from calling get().
 type getResult struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version int64  `json:"version,omitempty"`
 }
 
-// get fetches a secret.
+// get fetches a secret. A specific version is fetched if one is given,
+// otherwise secrets split into chunks are reassembled.
 func get(c *cli.Context, s *secretConfig) (getResult, error) {
 	if c.NArg() < 1 {
 		return getResult{}, fmt.Errorf("must provide a key")
 	}
 
-	value, err := s.provider.Get(c.Args().First())
+	var value string
+	var err error
+	if version := c.Int64(flag_secret_version); version > 0 {
+		versioner, ok := s.provider.(gcli.SecretVersioner)
+		if !ok {
+			return getResult{}, gcli.ErrUnsupported
+		}
+		value, err = versioner.GetVersion(c.Args().First(), version)
+	} else {
+		value, err = getChunked(s.provider, c.Args().First())
+	}
 	if err != nil {
 		return getResult{}, err
 	}
 
 	return getResult{
-		Key:   c.Args().First(),
-		Value: value,
+		Key:     c.Args().First(),
+		Value:   value,
+		Version: c.Int64(flag_secret_version),
+	}, nil
+}
+
+// historyResult is the result from calling history().
+type historyResult struct {
+	Key      string               `json:"key"`
+	Versions []gcli.SecretVersion `json:"versions"`
+}
+
+// history lists the versions of a secret.
+func history(c *cli.Context, s *secretConfig) (historyResult, error) {
+	if c.NArg() < 1 {
+		return historyResult{}, fmt.Errorf("must provide a key")
+	}
+
+	versioner, ok := s.provider.(gcli.SecretVersioner)
+	if !ok {
+		return historyResult{}, gcli.ErrUnsupported
+	}
+
+	versions, err := versioner.History(c.Args().First())
+	if err != nil {
+		return historyResult{}, err
+	}
+
+	return historyResult{
+		Key:      c.Args().First(),
+		Versions: versions,
 	}, nil
 }
 
+// listEntry is a single secret returned by list().
+type listEntry struct {
+	gcli.SecretMetadata
+	Value string `json:"value,omitempty"`
+}
+
+// listResult is the result from calling list().
+type listResult struct {
+	Secrets []listEntry `json:"secrets"`
+}
+
+// list lists the secrets under a path prefix.
+func list(c *cli.Context, s *secretConfig) (listResult, error) {
+	lister, ok := s.provider.(gcli.SecretLister)
+	if !ok {
+		return listResult{}, gcli.ErrUnsupported
+	}
+
+	tags, err := parseTags(c.StringSlice(flag_secret_tag))
+	if err != nil {
+		return listResult{}, err
+	}
+
+	// Prefer filtering on the backend and fall back to describing each secret
+	filter, filtered := s.provider.(gcli.SecretTagFilter)
+	filtered = filtered && len(tags) > 0
+	annotator, ok := s.provider.(gcli.SecretAnnotator)
+	if len(tags) > 0 && !filtered && !ok {
+		return listResult{}, gcli.ErrUnsupported
+	}
+
+	var secrets []gcli.SecretMetadata
+	if filtered {
+		secrets, err = filter.ListTagged(c.Args().First(), c.Bool(flag_secret_recurse), tags)
+	} else {
+		secrets, err = lister.List(c.Args().First(), c.Bool(flag_secret_recurse))
+	}
+	if err != nil {
+		return listResult{}, err
+	}
+
+	result := listResult{Secrets: make([]listEntry, 0, len(secrets))}
+	for _, secret := range secrets {
+		if len(tags) > 0 && !filtered {
+			secret, err = annotator.Describe(secret.Key)
+			if err != nil {
+				return listResult{}, err
+			}
+			if !matchTags(secret.Tags, tags) {
+				continue
+			}
+		}
+
+		entry := listEntry{SecretMetadata: secret}
+		if c.Bool(flag_secret_values) {
+			entry.Value, err = getChunked(s.provider, secret.Key)
+			if err != nil {
+				return listResult{}, err
+			}
+		}
+		result.Secrets = append(result.Secrets, entry)
+	}
+
+	return result, nil
+}
+
+// rollbackResult is the result from calling rollback().
+type rollbackResult struct {
+	Key     string `json:"key"`
+	Version int64  `json:"version"`
+}
+
+// rollback restores a previous version of a secret by setting it as the
+// latest value.
+func rollback(c *cli.Context, s *secretConfig) (rollbackResult, error) {
+	if c.NArg() < 2 {
+		return rollbackResult{}, fmt.Errorf("must provide a key and version")
+	}
+
+	version, err := strconv.ParseInt(c.Args().Get(1), 10, 64)
+	if err != nil || version < 1 {
+		return rollbackResult{}, fmt.Errorf("invalid version: %s", c.Args().Get(1))
+	}
+
+	versioner, ok := s.provider.(gcli.SecretVersioner)
+	if !ok {
+		return rollbackResult{}, gcli.ErrUnsupported
+	}
+
+	value, err := versioner.GetVersion(c.Args().First(), version)
+	if err != nil {
+		return rollbackResult{}, err
+	}
+
+	if err := s.provider.Set(c.Args().First(), value); err != nil {
+		return rollbackResult{}, err
+	}
+
+	return rollbackResult{
+		Key:     c.Args().First(),
+		Version: version,
+	}, nil
+}
+
+// secretAnnotations returns the description and tags given by flag along with
+// the SecretAnnotator used to set them. The annotator is nil if neither were
+// given.
+func secretAnnotations(c *cli.Context, provider gcli.SecretProvider) (gcli.SecretAnnotator, string, map[string]string, error) {
+	tags, err := parseTags(c.StringSlice(flag_secret_tag))
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	description := c.String(flag_secret_desc)
+	if description == "" && len(tags) == 0 {
+		return nil, "", nil, nil
+	}
+
+	annotator, ok := provider.(gcli.SecretAnnotator)
+	if !ok {
+		return nil, "", nil, gcli.ErrUnsupported
+	}
+
+	return annotator, description, tags, nil
+}
+
+// setSecret sets a secret using the annotator if one is given.
+func setSecret(provider gcli.SecretProvider, annotator gcli.SecretAnnotator, key string, value string, description string, tags map[string]string) error {
+	if annotator != nil {
+		return annotator.SetAnnotated(key, value, description, tags)
+	}
+
+	return provider.Set(key, value)
+}
+
+// ensureNoSecret returns an error if a secret is already stored under key,
+// unless force is set.
+func ensureNoSecret(provider gcli.SecretProvider, key string, force bool) error {
+	if force {
+		return nil
+	}
+
+	_, err := provider.Get(key)
+	if err == nil {
+		return fmt.Errorf("%s already exists; pass --force to replace it", key)
+	} else if !errors.Is(err, gcli.ErrSecretNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// parseTags parses tags in the form KEY=VALUE.
+func parseTags(values []string) (map[string]string, error) {
+	tags := make(map[string]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag: %s", value)
+		}
+		tags[parts[0]] = parts[1]
+	}
+
+	return tags, nil
+}
+
+// matchTags returns whether all of the wanted tags are present in tags.
+func matchTags(tags map[string]string, want map[string]string) bool {
+	for key, value := range want {
+		if v, ok := tags[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 // setResult is the result from calling set().
 type setResult struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
-// set sets a secret.
+// set sets a secret. If a type is given, the value must be correctly formatted
+// for it.
 func set(c *cli.Context, s *secretConfig) (setResult, error) {
 	if c.NArg() < 2 {
 		return setResult{}, fmt.Errorf("must provide a key and value")
 	}
 
-	err := s.provider.Set(c.Args().Get(0), c.Args().Get(1))
+	if typ := c.String(flag_secret_type); typ != "" {
+		if err := gen.ValidateValue(typ, c.Args().Get(1)); err != nil {
+			return setResult{}, err
+		}
+	}
+
+	annotator, description, tags, err := secretAnnotations(c, s.provider)
 	if err != nil {
 		return setResult{}, err
 	}
 
+	if err := setSecret(s.provider, annotator, c.Args().Get(0), c.Args().Get(1), description, tags); err != nil {
+		return setResult{}, err
+	}
+
 	return setResult{
 		Key:   c.Args().Get(0),
 		Value: c.Args().Get(1),
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/HomeOperations/jmgilman/cli/secretfile"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	shellBash       = "bash"
+	shellFish       = "fish"
+	shellPowerShell = "powershell"
+)
+
+// envNamePattern matches valid environment variable names.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envResult is the result from calling env(). It's written to the output as
+// shell statements which export each variable.
+type envResult struct {
+	Shell     string            `json:"shell"`
+	Variables map[string]string `json:"variables"`
+}
+
+// Raw renders the variables as statements for the configured shell.
+func (e envResult) Raw() []byte {
+	names := make([]string, 0, len(e.Variables))
+	for name := range e.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		value := e.Variables[name]
+		switch e.Shell {
+		case shellFish:
+			fmt.Fprintf(&buf, "set -gx %s %s;\n", name, quoteFish(value))
+		case shellPowerShell:
+			fmt.Fprintf(&buf, "$Env:%s = %s\n", name, quotePowerShell(value))
+		default:
+			fmt.Fprintf(&buf, "export %s=%s\n", name, quoteBash(value))
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// env fetches the secrets named in a mapping file of environment variable
+// names to secret keys and renders them as shell statements.
+func env(c *cli.Context, s *secretConfig) (envResult, error) {
+	if c.NArg() < 1 {
+		return envResult{}, fmt.Errorf("must provide a mapping file")
+	}
+
+	shell := strings.ToLower(c.String(flag_secret_shell))
+	if shell != shellBash && shell != shellFish && shell != shellPowerShell {
+		return envResult{}, fmt.Errorf("invalid shell: %s", shell)
+	}
+
+	mapping, err := readEnvMapping(c, s.fs, c.Args().First())
+	if err != nil {
+		return envResult{}, err
+	}
+
+	result := envResult{Shell: shell, Variables: make(map[string]string, len(mapping))}
+	for name, key := range mapping {
+		result.Variables[name], err = getChunked(s.provider, key)
+		if err != nil {
+			return envResult{}, fmt.Errorf("error fetching %s for %s: %w", key, name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// readEnvMapping reads a mapping of environment variable names to secret keys
+// from the given file.
+func readEnvMapping(c *cli.Context, fs afero.Fs, path string) (map[string]string, error) {
+	format, err := secretFileFormat(c, path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := secretfile.Unmarshal(format, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range mapping {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable name: %s", name)
+		}
+	}
+
+	return mapping, nil
+}
+
+// quoteBash quotes a value for POSIX shells. Single quotes can't be escaped
+// within single quotes so each is closed, escaped, and reopened.
+func quoteBash(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// quoteFish quotes a value for fish, which supports escaping backslashes and
+// single quotes within single quotes.
+func quoteFish(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// quotePowerShell quotes a value for PowerShell, where single quotes are
+// escaped by doubling them.
+func quotePowerShell(value string) string {
+	return "'" + strings.NewReplacer(
+		"'", "''",
+		"‘", "‘‘",
+		"’", "’’",
+		"‚", "‚‚",
+		"‛", "‛‛",
+	).Replace(value) + "'"
+}
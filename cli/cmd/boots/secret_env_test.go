@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+// envFlags returns the flags used by the env command.
+func envFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: flag_secret_format},
+		&cli.StringFlag{Name: flag_secret_shell, Value: shellBash},
+	}
+}
+
+func TestEnv(t *testing.T) {
+	is := is.New(t)
+	fs := afero.NewMemMapFs()
+	is.NoErr(afero.WriteFile(fs, "env.yaml", []byte("VIX_USERNAME: vix-username\nVIX_PASSWORD: vix-password\n"), 0600))
+	is.NoErr(afero.WriteFile(fs, "missing.yaml", []byte("MISSING: missing\n"), 0600))
+	is.NoErr(afero.WriteFile(fs, "invalid.yaml", []byte("NOT-VALID: vix-username\n"), 0600))
+	is.NoErr(afero.WriteFile(fs, "chunked.yaml", []byte("SSH_KEY: ssh/provision\n"), 0600))
+
+	s := secretConfig{
+		fs: fs,
+		provider: newMapProvider(map[string]string{
+			"vix-username":    "admin",
+			"vix-password":    `it's a "$secret"`,
+			"ssh/provision":   chunkPrefix + "2",
+			"ssh/provision/0": "private",
+			"ssh/provision/1": "key",
+		}),
+	}
+
+	// With bash
+	result, err := env(newTestContext(envFlags(), "env.yaml"), &s)
+	is.NoErr(err)
+	is.Equal(result.Variables, map[string]string{"VIX_USERNAME": "admin", "VIX_PASSWORD": `it's a "$secret"`})
+	is.Equal(string(result.Raw()), "export VIX_PASSWORD='it'\\''s a \"$secret\"'\nexport VIX_USERNAME='admin'\n")
+
+	// With fish
+	result, err = env(newTestContext(envFlags(), "--shell", "fish", "env.yaml"), &s)
+	is.NoErr(err)
+	is.Equal(string(result.Raw()), "set -gx VIX_PASSWORD 'it\\'s a \"$secret\"';\nset -gx VIX_USERNAME 'admin';\n")
+
+	// With PowerShell
+	result, err = env(newTestContext(envFlags(), "--shell", "powershell", "env.yaml"), &s)
+	is.NoErr(err)
+	is.Equal(string(result.Raw()), "$Env:VIX_PASSWORD = 'it''s a \"$secret\"'\n$Env:VIX_USERNAME = 'admin'\n")
+
+	// With chunked secret
+	result, err = env(newTestContext(envFlags(), "chunked.yaml"), &s)
+	is.NoErr(err)
+	is.Equal(result.Variables, map[string]string{"SSH_KEY": "privatekey"})
+
+	// With invalid shell
+	_, err = env(newTestContext(envFlags(), "--shell", "csh", "env.yaml"), &s)
+	is.Equal(err.Error(), "invalid shell: csh")
+
+	// With missing secret
+	_, err = env(newTestContext(envFlags(), "missing.yaml"), &s)
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With invalid variable name
+	_, err = env(newTestContext(envFlags(), "invalid.yaml"), &s)
+	is.Equal(err.Error(), "invalid environment variable name: NOT-VALID")
+}
+
+func TestQuote(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(quoteBash(`a'b\c`), `'a'\''b\c'`)
+	is.Equal(quoteFish(`a'b\c`), `'a\'b\\c'`)
+	is.Equal(quotePowerShell("a'b’c"), "'a''b’’c'")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// commandRunner is an interface for running a command to completion.
+type commandRunner interface {
+	Run(name string, args []string, env []string) (int, error)
+}
+
+// execRunner implements commandRunner using the exec package. The command
+// inherits the standard streams and receives any signals sent to this process.
+type execRunner struct{}
+
+// Run runs the command with the given environment and returns its exit code.
+// Commands terminated by a signal return 128 plus the signal number.
+func (e *execRunner) Run(name string, args []string, env []string) (int, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				log.Debugf("Forwarding signal %s to process %d", sig, cmd.Process.Pid)
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// execConfig holds dependencies utilized by the exec subcommand.
+type execConfig struct {
+	provider gcli.SecretProvider
+	runner   commandRunner
+}
+
+// newExecConfig returns an execConfig configured with default dependencies.
+func newExecConfig(c *cli.Context) (*execConfig, error) {
+	provider, err := newSecretProvider(c, c.String(flag_secret_backend))
+	if err != nil {
+		return nil, err
+	}
+
+	return &execConfig{provider: provider, runner: &execRunner{}}, nil
+}
+
+// execSecrets runs a command with secrets injected into its environment using
+// the given NAME=key mappings. The secrets are only visible to the command.
+// Returns the exit code of the command.
+func execSecrets(c *cli.Context, e *execConfig) (int, error) {
+	if c.NArg() < 1 {
+		return 0, fmt.Errorf("must provide a command")
+	}
+
+	secrets := make(map[string]string)
+	for _, rule := range c.StringSlice(flag_secret_map) {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return 0, fmt.Errorf("invalid mapping rule: %s", rule)
+		}
+		if !envNamePattern.MatchString(parts[0]) {
+			return 0, fmt.Errorf("invalid environment variable name: %s", parts[0])
+		}
+
+		value, err := getChunked(e.provider, parts[1])
+		if err != nil {
+			return 0, fmt.Errorf("error fetching %s for %s: %w", parts[1], parts[0], err)
+		}
+		secrets[parts[0]] = value
+	}
+
+	env := make([]string, 0, len(os.Environ())+len(secrets))
+	for _, entry := range os.Environ() {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if _, ok := secrets[name]; !ok {
+			env = append(env, entry)
+		}
+	}
+	for name, value := range secrets {
+		env = append(env, name+"="+value)
+	}
+
+	log.Infof("Running %s with %d secrets", c.Args().First(), len(secrets))
+	return e.runner.Run(c.Args().First(), c.Args().Tail(), env)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+)
+
+type mockRunner struct {
+	fnRun func(name string, args []string, env []string) (int, error)
+}
+
+func (m *mockRunner) Run(name string, args []string, env []string) (int, error) {
+	return m.fnRun(name, args, env)
+}
+
+// execFlags returns the flags used by the exec command.
+func execFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{Name: flag_secret_map},
+	}
+}
+
+func TestExecSecrets(t *testing.T) {
+	is := is.New(t)
+	t.Setenv("VIX_USERNAME", "stale")
+	t.Setenv("BOOTS_TEST", "inherited")
+
+	var got_name string
+	var got_args []string
+	var got_env []string
+	e := execConfig{
+		provider: newMapProvider(map[string]string{
+			"vix-username":    "admin",
+			"vix-password":    "secret",
+			"ssh/provision":   chunkPrefix + "2",
+			"ssh/provision/0": "private",
+			"ssh/provision/1": "key",
+		}),
+		runner: &mockRunner{
+			fnRun: func(name string, args []string, env []string) (int, error) {
+				got_name = name
+				got_args = args
+				got_env = env
+				return 3, nil
+			},
+		},
+	}
+
+	// With mapped secrets
+	code, err := execSecrets(newTestContext(execFlags(), "--map", "VIX_USERNAME=vix-username", "--map", "VIX_PASSWORD=vix-password", "--", "./expect.sh", "-f"), &e)
+	is.NoErr(err)
+	is.Equal(code, 3)
+	is.Equal(got_name, "./expect.sh")
+	is.Equal(got_args, []string{"-f"})
+
+	env := make(map[string][]string)
+	for _, entry := range got_env {
+		parts := strings.SplitN(entry, "=", 2)
+		env[parts[0]] = append(env[parts[0]], parts[1])
+	}
+	is.Equal(env["VIX_USERNAME"], []string{"admin"})
+	is.Equal(env["VIX_PASSWORD"], []string{"secret"})
+	is.Equal(env["BOOTS_TEST"], []string{"inherited"})
+
+	// With chunked secret
+	_, err = execSecrets(newTestContext(execFlags(), "--map", "SSH_KEY=ssh/provision", "true"), &e)
+	is.NoErr(err)
+	is.Equal(got_env[len(got_env)-1], "SSH_KEY=privatekey")
+
+	// With missing secret
+	_, err = execSecrets(newTestContext(execFlags(), "--map", "MISSING=missing", "true"), &e)
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With invalid mapping
+	_, err = execSecrets(newTestContext(execFlags(), "--map", "NOKEY", "true"), &e)
+	is.Equal(err.Error(), "invalid mapping rule: NOKEY")
+
+	// With no command
+	_, err = execSecrets(newTestContext(execFlags(), "--map", "VIX_USERNAME=vix-username"), &e)
+	is.Equal(err.Error(), "must provide a command")
+}
+
+func TestExecRunner(t *testing.T) {
+	is := is.New(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("requires a POSIX shell")
+	}
+
+	runner := execRunner{}
+
+	// With exit code
+	code, err := runner.Run("sh", []string{"-c", `test "$SECRET" = value && exit 7`}, []string{"SECRET=value"})
+	is.NoErr(err)
+	is.Equal(code, 7)
+
+	// With signal
+	code, err = runner.Run("sh", []string{"-c", "kill -TERM $$"}, nil)
+	is.NoErr(err)
+	is.Equal(code, 128+15)
+
+	// With missing command
+	_, err = runner.Run("boots-missing-command", nil, nil)
+	is.True(err != nil)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/envelope"
+	"github.com/HomeOperations/jmgilman/cli/secretfile"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	conflictFail      = "fail"
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+)
+
+// exportResult is the result from calling exportSecrets().
+type exportResult struct {
+	Encrypted bool     `json:"encrypted"`
+	Format    string   `json:"format"`
+	Keys      []string `json:"keys"`
+	Path      string   `json:"path"`
+}
+
+// exportSecrets writes the secrets under a path prefix to a file, optionally
+// encrypting it.
+func exportSecrets(c *cli.Context, s *secretConfig) (exportResult, error) {
+	lister, ok := s.provider.(gcli.SecretLister)
+	if !ok {
+		return exportResult{}, gcli.ErrUnsupported
+	}
+
+	output := c.String(flag_secret_output)
+	if output == "" {
+		return exportResult{}, fmt.Errorf("must provide an output file")
+	}
+
+	format, err := secretFileFormat(c, output)
+	if err != nil {
+		return exportResult{}, err
+	}
+
+	secret, err := newEnvelopeSecret(c, s.fs)
+	if err != nil {
+		return exportResult{}, err
+	}
+
+	metadata, err := lister.List(c.String(flag_secret_prefix), c.Bool(flag_secret_recurse))
+	if err != nil {
+		return exportResult{}, err
+	}
+
+	// Chunked values are exported whole under their own key
+	metadata, err = foldChunks(s.provider, metadata)
+	if err != nil {
+		return exportResult{}, err
+	}
+
+	secrets := make(map[string]string, len(metadata))
+	keys := make([]string, 0, len(metadata))
+	for _, m := range metadata {
+		secrets[m.Key], err = getChunked(s.provider, m.Key)
+		if err != nil {
+			return exportResult{}, err
+		}
+		keys = append(keys, m.Key)
+	}
+	sort.Strings(keys)
+
+	data, err := secretfile.Marshal(format, secrets)
+	if err != nil {
+		return exportResult{}, err
+	}
+
+	if secret != nil {
+		data, err = envelope.Seal(*secret, data)
+		if err != nil {
+			return exportResult{}, err
+		}
+	}
+
+	if err := afero.WriteFile(s.fs, output, data, 0600); err != nil {
+		return exportResult{}, err
+	}
+
+	return exportResult{
+		Encrypted: secret != nil,
+		Format:    string(format),
+		Keys:      keys,
+		Path:      output,
+	}, nil
+}
+
+// importResult is the result from calling importSecrets().
+type importResult struct {
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"`
+}
+
+// importSecrets sets the secrets contained within a file. Existing secrets are
+// skipped, overwritten, or cause the import to fail before anything is written
+// depending on the conflict mode.
+func importSecrets(c *cli.Context, s *secretConfig) (importResult, error) {
+	if c.NArg() < 1 {
+		return importResult{}, fmt.Errorf("must provide a file")
+	}
+
+	mode := c.String(flag_secret_conflict)
+	if err := validConflictMode(mode); err != nil {
+		return importResult{}, err
+	}
+
+	path := c.Args().First()
+	format, err := secretFileFormat(c, path)
+	if err != nil {
+		return importResult{}, err
+	}
+
+	data, err := afero.ReadFile(s.fs, path)
+	if err != nil {
+		return importResult{}, err
+	}
+
+	if envelope.IsSealed(data) {
+		secret, err := newEnvelopeSecret(c, s.fs)
+		if err != nil {
+			return importResult{}, err
+		}
+		if secret == nil {
+			return importResult{}, fmt.Errorf("%s is encrypted: must supply a passphrase or keyfile", path)
+		}
+
+		data, err = envelope.Open(*secret, data)
+		if err != nil {
+			return importResult{}, fmt.Errorf("error decrypting %s: %w", path, err)
+		}
+	}
+
+	secrets, err := secretfile.Unmarshal(format, data)
+	if err != nil {
+		return importResult{}, err
+	}
+
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Resolve conflicts up front so a failed import doesn't write anything
+	existing, err := resolveConflicts(s.provider, keys, mode)
+	if err != nil {
+		return importResult{}, err
+	}
+
+	result := importResult{Imported: []string{}, Skipped: []string{}}
+	for _, key := range keys {
+		if existing[key] {
+			result.Skipped = append(result.Skipped, key)
+			continue
+		}
+
+		if err := s.provider.Set(key, secrets[key]); err != nil {
+			return result, err
+		}
+		result.Imported = append(result.Imported, key)
+	}
+
+	return result, nil
+}
+
+// resolveConflicts returns the set of keys which already exist in the given
+// provider. An error is returned if any exist and the conflict mode is fail.
+// Nothing is checked when overwriting.
+func resolveConflicts(provider gcli.SecretProvider, keys []string, mode string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if mode == conflictOverwrite {
+		return existing, nil
+	}
+
+	var conflicts []string
+	for _, key := range keys {
+		_, err := provider.Get(key)
+		if errors.Is(err, gcli.ErrSecretNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		existing[key] = true
+		conflicts = append(conflicts, key)
+	}
+
+	if mode == conflictFail && len(conflicts) > 0 {
+		return nil, fmt.Errorf("secrets already exist: %s", strings.Join(conflicts, ", "))
+	}
+
+	return existing, nil
+}
+
+// validConflictMode returns an error if the given conflict mode is unknown.
+func validConflictMode(mode string) error {
+	if mode != conflictFail && mode != conflictOverwrite && mode != conflictSkip {
+		return fmt.Errorf("invalid conflict mode: %s", mode)
+	}
+
+	return nil
+}
+
+// secretFileFormat returns the format given by flag or detected from path.
+func secretFileFormat(c *cli.Context, path string) (secretfile.Format, error) {
+	if c.String(flag_secret_format) != "" {
+		return secretfile.ParseFormat(c.String(flag_secret_format))
+	}
+
+	return secretfile.FormatFromPath(path)
+}
+
+// newEnvelopeSecret returns the secret used for encrypting secret files or nil
+// if neither a passphrase nor keyfile was given.
+func newEnvelopeSecret(c *cli.Context, fs afero.Fs) (*envelope.Secret, error) {
+	switch {
+	case c.String(flag_secret_passphrase) != "" && c.String(flag_secret_keyfile) != "":
+		return nil, fmt.Errorf("must supply only one of a passphrase or keyfile")
+	case c.String(flag_secret_passphrase) != "":
+		secret := envelope.Passphrase(c.String(flag_secret_passphrase))
+		return &secret, nil
+	case c.String(flag_secret_keyfile) != "":
+		data, err := afero.ReadFile(fs, c.String(flag_secret_keyfile))
+		if err != nil {
+			return nil, err
+		}
+		secret := envelope.Keyfile(data)
+		return &secret, nil
+	default:
+		return nil, nil
+	}
+}
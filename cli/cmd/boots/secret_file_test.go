@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/envelope"
+	"github.com/HomeOperations/jmgilman/cli/mocks"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+// newMapProvider returns a mock secret provider backed by the given map.
+func newMapProvider(secrets map[string]string) *mocks.MockSecretLister {
+	return &mocks.MockSecretLister{
+		MockSecretProvider: mocks.MockSecretProvider{
+			FnGet: func(key string) (string, error) {
+				value, ok := secrets[key]
+				if !ok {
+					return "", gcli.ErrSecretNotFound
+				}
+				return value, nil
+			},
+			FnSet: func(key string, value string) error {
+				secrets[key] = value
+				return nil
+			},
+			FnDelete: func(key string) error {
+				if _, ok := secrets[key]; !ok {
+					return gcli.ErrSecretNotFound
+				}
+				// The delete command shadows the builtin
+				reflect.ValueOf(secrets).SetMapIndex(reflect.ValueOf(key), reflect.Value{})
+				return nil
+			},
+		},
+		FnList: func(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+			var result []gcli.SecretMetadata
+			for key := range secrets {
+				if gcli.MatchSecretPath(key, prefix, recursive) {
+					result = append(result, gcli.SecretMetadata{Key: key})
+				}
+			}
+			sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+			return result, nil
+		},
+	}
+}
+
+// secretFileFlags returns the flags used by the export and import commands.
+func secretFileFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: flag_secret_conflict, Value: conflictFail},
+		&cli.StringFlag{Name: flag_secret_format},
+		&cli.StringFlag{Name: flag_secret_keyfile},
+		&cli.StringFlag{Name: flag_secret_output},
+		&cli.StringFlag{Name: flag_secret_passphrase},
+		&cli.StringFlag{Name: flag_secret_prefix},
+		&cli.BoolFlag{Name: flag_secret_recurse},
+	}
+}
+
+func TestExportSecrets(t *testing.T) {
+	is := is.New(t)
+	fs := afero.NewMemMapFs()
+	is.NoErr(afero.WriteFile(fs, "key", []byte("keyfile"), 0600))
+
+	s := secretConfig{
+		fs: fs,
+		provider: newMapProvider(map[string]string{
+			"/glab/a":        "1",
+			"/glab/nested/b": "2",
+			"/other/c":       "3",
+		}),
+	}
+
+	// With plaintext output
+	result, err := exportSecrets(newTestContext(secretFileFlags(), "--prefix", "/glab", "--recursive", "--output", "out.json"), &s)
+	is.NoErr(err)
+	is.Equal(result.Keys, []string{"/glab/a", "/glab/nested/b"})
+	is.Equal(result.Format, "json")
+	is.True(!result.Encrypted)
+
+	data, err := afero.ReadFile(fs, "out.json")
+	is.NoErr(err)
+	is.Equal(string(data), "{\n  \"/glab/a\": \"1\",\n  \"/glab/nested/b\": \"2\"\n}\n")
+
+	// With encrypted output
+	result, err = exportSecrets(newTestContext(secretFileFlags(), "--prefix", "/glab", "--output", "out.yaml.enc", "--keyfile", "key"), &s)
+	is.NoErr(err)
+	is.Equal(result.Keys, []string{"/glab/a"})
+	is.Equal(result.Format, "yaml")
+	is.True(result.Encrypted)
+
+	data, err = afero.ReadFile(fs, "out.yaml.enc")
+	is.NoErr(err)
+	is.True(envelope.IsSealed(data))
+
+	plaintext, err := envelope.Open(envelope.Keyfile([]byte("keyfile")), data)
+	is.NoErr(err)
+	is.Equal(string(plaintext), "/glab/a: \"1\"\n")
+
+	// With chunked secret
+	s.provider = newMapProvider(map[string]string{
+		"/glab/ssh/provision":   chunkPrefix + "2",
+		"/glab/ssh/provision/0": "private",
+		"/glab/ssh/provision/1": "key",
+	})
+	result, err = exportSecrets(newTestContext(secretFileFlags(), "--prefix", "/glab", "--recursive", "--output", "chunked.json"), &s)
+	is.NoErr(err)
+	is.Equal(result.Keys, []string{"/glab/ssh/provision"})
+
+	data, err = afero.ReadFile(fs, "chunked.json")
+	is.NoErr(err)
+	is.Equal(string(data), "{\n  \"/glab/ssh/provision\": \"privatekey\"\n}\n")
+
+	// With unsupported backend
+	s.provider = &mocks.MockSecretProvider{}
+	_, err = exportSecrets(newTestContext(secretFileFlags(), "--output", "out.json"), &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestImportSecrets(t *testing.T) {
+	is := is.New(t)
+	fs := afero.NewMemMapFs()
+	is.NoErr(afero.WriteFile(fs, "secrets.env", []byte("A=\"new\"\nB=\"new\"\n"), 0600))
+
+	newConfig := func() (secretConfig, map[string]string) {
+		secrets := map[string]string{"A": "old"}
+		return secretConfig{fs: fs, provider: newMapProvider(secrets)}, secrets
+	}
+
+	// With conflict and fail mode
+	s, secrets := newConfig()
+	_, err := importSecrets(newTestContext(secretFileFlags(), "secrets.env"), &s)
+	is.Equal(err.Error(), "secrets already exist: A")
+	is.Equal(secrets, map[string]string{"A": "old"})
+
+	// With conflict and skip mode
+	s, secrets = newConfig()
+	result, err := importSecrets(newTestContext(secretFileFlags(), "--on-conflict", "skip", "secrets.env"), &s)
+	is.NoErr(err)
+	is.Equal(result.Imported, []string{"B"})
+	is.Equal(result.Skipped, []string{"A"})
+	is.Equal(secrets, map[string]string{"A": "old", "B": "new"})
+
+	// With conflict and overwrite mode
+	s, secrets = newConfig()
+	result, err = importSecrets(newTestContext(secretFileFlags(), "--on-conflict", "overwrite", "secrets.env"), &s)
+	is.NoErr(err)
+	is.Equal(result.Imported, []string{"A", "B"})
+	is.Equal(secrets, map[string]string{"A": "new", "B": "new"})
+
+	// With invalid conflict mode
+	_, err = importSecrets(newTestContext(secretFileFlags(), "--on-conflict", "merge", "secrets.env"), &s)
+	is.Equal(err.Error(), "invalid conflict mode: merge")
+}
+
+func TestImportSecretsEncrypted(t *testing.T) {
+	is := is.New(t)
+	fs := afero.NewMemMapFs()
+
+	data, err := envelope.Seal(envelope.Keyfile([]byte("keyfile")), []byte("A: one\n"))
+	is.NoErr(err)
+	is.NoErr(afero.WriteFile(fs, "secrets.enc", data, 0600))
+	is.NoErr(afero.WriteFile(fs, "key", []byte("keyfile"), 0600))
+	is.NoErr(afero.WriteFile(fs, "wrong", []byte("wrong"), 0600))
+
+	secrets := map[string]string{}
+	s := secretConfig{fs: fs, provider: newMapProvider(secrets)}
+
+	// With keyfile
+	result, err := importSecrets(newTestContext(secretFileFlags(), "--format", "yaml", "--keyfile", "key", "secrets.enc"), &s)
+	is.NoErr(err)
+	is.Equal(result.Imported, []string{"A"})
+	is.Equal(secrets["A"], "one")
+
+	// With missing keyfile
+	_, err = importSecrets(newTestContext(secretFileFlags(), "--format", "yaml", "secrets.enc"), &s)
+	is.True(strings.Contains(err.Error(), "must supply a passphrase or keyfile"))
+
+	// With wrong keyfile
+	_, err = importSecrets(newTestContext(secretFileFlags(), "--format", "yaml", "--keyfile", "wrong", "secrets.enc"), &s)
+	is.True(errors.Is(err, envelope.ErrDecrypt))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/urfave/cli/v2"
+)
+
+// migrateConfig holds dependencies utilized by the migrate subcommand.
+type migrateConfig struct {
+	destination gcli.SecretProvider
+	source      gcli.SecretProvider
+}
+
+// newMigrateConfig returns a migrateConfig configured with the source and
+// destination backends given by flag.
+func newMigrateConfig(c *cli.Context) (*migrateConfig, error) {
+	if c.String(flag_secret_from) == c.String(flag_secret_to) {
+		return nil, fmt.Errorf("source and destination backends must differ")
+	}
+
+	source, err := newSecretProvider(c, c.String(flag_secret_from))
+	if err != nil {
+		return nil, err
+	}
+
+	destination, err := newSecretProvider(c, c.String(flag_secret_to))
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrateConfig{destination: destination, source: source}, nil
+}
+
+// keyMapping rewrites keys starting with from to start with to.
+type keyMapping struct {
+	from string
+	to   string
+}
+
+// parseKeyMappings parses mapping rules in the form FROM=TO.
+func parseKeyMappings(rules []string) ([]keyMapping, error) {
+	var mappings []keyMapping
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid mapping rule: %s", rule)
+		}
+		mappings = append(mappings, keyMapping{from: parts[0], to: parts[1]})
+	}
+
+	return mappings, nil
+}
+
+// mapKey returns the key rewritten by the longest matching mapping rule. Rules
+// only match on path segment boundaries. Keys matching no rule are returned
+// unchanged.
+func mapKey(key string, mappings []keyMapping) string {
+	var match *keyMapping
+	for i, m := range mappings {
+		if !gcli.MatchSecretPath(key, m.from, true) && key != m.from {
+			continue
+		}
+		if match == nil || len(m.from) > len(match.from) {
+			match = &mappings[i]
+		}
+	}
+
+	if match == nil {
+		return key
+	}
+
+	return match.to + strings.TrimPrefix(key, match.from)
+}
+
+// migrateEntry is a single secret handled by migrate().
+type migrateEntry struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Skipped     bool   `json:"skipped"`
+	Verified    bool   `json:"verified"`
+}
+
+// migrateResult is the result from calling migrate().
+type migrateResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Secrets []migrateEntry `json:"secrets"`
+}
+
+// migrate copies the secrets under a path prefix from the source backend to
+// the destination backend. Each copied value is read back from the
+// destination to verify it. With dry run enabled, only the plan is returned.
+func migrate(c *cli.Context, m *migrateConfig) (migrateResult, error) {
+	lister, ok := m.source.(gcli.SecretLister)
+	if !ok {
+		return migrateResult{}, fmt.Errorf("source backend cannot list secrets: %w", gcli.ErrUnsupported)
+	}
+
+	mode := c.String(flag_secret_conflict)
+	if err := validConflictMode(mode); err != nil {
+		return migrateResult{}, err
+	}
+
+	mappings, err := parseKeyMappings(c.StringSlice(flag_secret_map))
+	if err != nil {
+		return migrateResult{}, err
+	}
+
+	secrets, err := lister.List(c.String(flag_secret_prefix), c.Bool(flag_secret_recurse))
+	if err != nil {
+		return migrateResult{}, err
+	}
+
+	// Chunks are copied along with the secret they belong to
+	secrets, err = foldChunks(m.source, secrets)
+	if err != nil {
+		return migrateResult{}, err
+	}
+
+	result := migrateResult{
+		DryRun:  c.Bool(flag_secret_dry_run),
+		Secrets: make([]migrateEntry, 0, len(secrets)),
+	}
+	destinations := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		key := mapKey(secret.Key, mappings)
+		destinations = append(destinations, key)
+		result.Secrets = append(result.Secrets, migrateEntry{
+			Source:      secret.Key,
+			Destination: key,
+		})
+	}
+
+	// Resolve conflicts up front so a failed migration doesn't write anything
+	existing, err := resolveConflicts(m.destination, destinations, mode)
+	if err != nil {
+		return migrateResult{}, err
+	}
+
+	for i := range result.Secrets {
+		entry := &result.Secrets[i]
+		entry.Skipped = existing[entry.Destination]
+		if result.DryRun || entry.Skipped {
+			continue
+		}
+
+		value, err := m.source.Get(entry.Source)
+		if err != nil {
+			return result, err
+		}
+
+		// Chunked values are split again as the destination may share the
+		// source's size limit
+		if strings.HasPrefix(value, chunkPrefix) {
+			value, err = assembleChunks(m.source, entry.Source, value)
+			if err != nil {
+				return result, err
+			}
+
+			_, err = setChunked(m.destination, nil, entry.Destination, value, defaultChunkSize, "", nil)
+		} else {
+			err = m.destination.Set(entry.Destination, value)
+		}
+		if err != nil {
+			return result, err
+		}
+
+		got, err := getChunked(m.destination, entry.Destination)
+		if err != nil {
+			return result, fmt.Errorf("error verifying %s: %s", entry.Destination, err)
+		}
+		if got != value {
+			return result, fmt.Errorf("error verifying %s: value read back does not match", entry.Destination)
+		}
+		entry.Verified = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/mocks"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+)
+
+// migrateFlags returns the flags used by the migrate command.
+func migrateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: flag_secret_conflict, Value: conflictFail},
+		&cli.BoolFlag{Name: flag_secret_dry_run},
+		&cli.StringFlag{Name: flag_secret_prefix},
+		&cli.BoolFlag{Name: flag_secret_recurse},
+		&cli.StringSliceFlag{Name: flag_secret_map},
+	}
+}
+
+func TestMapKey(t *testing.T) {
+	is := is.New(t)
+	mappings, err := parseKeyMappings([]string{"/=", "/glab/bootstrap=bootstrap", "/glab/bootstrap/tls=tls"})
+	is.NoErr(err)
+
+	is.Equal(mapKey("/glab/bootstrap/key", mappings), "bootstrap/key")
+	is.Equal(mapKey("/glab/bootstrap/tls/cert", mappings), "tls/cert")
+	is.Equal(mapKey("/glab/bootstrapped", mappings), "glab/bootstrapped")
+	is.Equal(mapKey("/glab/bootstrap", mappings), "bootstrap")
+	is.Equal(mapKey("relative", mappings), "relative")
+
+	// With invalid rule
+	_, err = parseKeyMappings([]string{"nomapping"})
+	is.Equal(err.Error(), "invalid mapping rule: nomapping")
+}
+
+func TestMigrate(t *testing.T) {
+	is := is.New(t)
+
+	newConfig := func() (*migrateConfig, map[string]string) {
+		destination := map[string]string{"bootstrap/existing": "old"}
+		return &migrateConfig{
+			source: newMapProvider(map[string]string{
+				"/glab/bootstrap/existing": "new",
+				"/glab/bootstrap/key":      "value",
+				"/other/key":               "other",
+			}),
+			destination: newMapProvider(destination),
+		}, destination
+	}
+	args := []string{"--prefix", "/glab", "--recursive", "--map", "/glab/=", "--map", "/glab/bootstrap=bootstrap"}
+
+	// With dry run
+	m, destination := newConfig()
+	result, err := migrate(newTestContext(migrateFlags(), append(args, "--dry-run", "--on-conflict", "skip")...), m)
+	is.NoErr(err)
+	is.True(result.DryRun)
+	is.Equal(result.Secrets, []migrateEntry{
+		{Source: "/glab/bootstrap/existing", Destination: "bootstrap/existing", Skipped: true},
+		{Source: "/glab/bootstrap/key", Destination: "bootstrap/key"},
+	})
+	is.Equal(destination, map[string]string{"bootstrap/existing": "old"})
+
+	// With conflict and fail mode
+	m, destination = newConfig()
+	_, err = migrate(newTestContext(migrateFlags(), args...), m)
+	is.Equal(err.Error(), "secrets already exist: bootstrap/existing")
+	is.Equal(len(destination), 1)
+
+	// With conflict and overwrite mode
+	m, destination = newConfig()
+	result, err = migrate(newTestContext(migrateFlags(), append(args, "--on-conflict", "overwrite")...), m)
+	is.NoErr(err)
+	is.Equal(result.Secrets, []migrateEntry{
+		{Source: "/glab/bootstrap/existing", Destination: "bootstrap/existing", Verified: true},
+		{Source: "/glab/bootstrap/key", Destination: "bootstrap/key", Verified: true},
+	})
+	is.Equal(destination, map[string]string{"bootstrap/existing": "new", "bootstrap/key": "value"})
+
+	// With chunked secret
+	source := map[string]string{"/glab/ssh/provision": chunkPrefix + "2", "/glab/ssh/provision/0": "private", "/glab/ssh/provision/1": "key"}
+	destination = make(map[string]string)
+	m = &migrateConfig{source: newMapProvider(source), destination: newMapProvider(destination)}
+	result, err = migrate(newTestContext(migrateFlags(), args...), m)
+	is.NoErr(err)
+	is.Equal(result.Secrets, []migrateEntry{
+		{Source: "/glab/ssh/provision", Destination: "ssh/provision", Verified: true},
+	})
+	is.Equal(destination, map[string]string{"ssh/provision": "privatekey"})
+
+	// With failed verification
+	m, _ = newConfig()
+	m.destination = &mocks.MockSecretProvider{
+		FnGet: func(key string) (string, error) {
+			return "corrupted", nil
+		},
+		FnSet: func(key string, value string) error {
+			return nil
+		},
+	}
+	_, err = migrate(newTestContext(migrateFlags(), append(args, "--on-conflict", "overwrite")...), m)
+	is.Equal(err.Error(), "error verifying bootstrap/existing: value read back does not match")
+
+	// With source that can't list
+	m.source = &mocks.MockSecretProvider{}
+	_, err = migrate(newTestContext(migrateFlags(), args...), m)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
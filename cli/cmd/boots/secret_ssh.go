@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+// chunkPrefix marks a secret whose value is split across several chunks. The
+// remainder of the value is the number of chunks stored beneath the key.
+const chunkPrefix = "boots:chunked:"
+
+// defaultChunkSize is the size of a standard tier SSM parameter, the smallest
+// limit among the supported backends.
+const defaultChunkSize = 4096
+
+// generateSSHResult is the result from calling generateSSH().
+type generateSSHResult struct {
+	Chunks      int    `json:"chunks"`
+	Fingerprint string `json:"fingerprint"`
+	Key         string `json:"key"`
+	PublicKey   string `json:"public_key"`
+	Type        string `json:"type"`
+}
+
+// Raw returns the public key in the authorized_keys format.
+func (g generateSSHResult) Raw() []byte {
+	return []byte(g.PublicKey)
+}
+
+// generateSSH generates a new SSH keypair and stores the private key, public
+// key, and fingerprint of the public key. The public key and fingerprint are
+// stored with .pub and .fingerprint appended to the key. An existing keypair is
+// only replaced if --force is given.
+func generateSSH(c *cli.Context, s *secretConfig) (generateSSHResult, error) {
+	if c.NArg() < 1 {
+		return generateSSHResult{}, fmt.Errorf("must provide a key")
+	}
+
+	name := c.Args().First()
+	if err := ensureNoSecret(s.provider, name, c.Bool(flag_secret_force)); err != nil {
+		return generateSSHResult{}, err
+	}
+
+	annotator, description, tags, err := secretAnnotations(c, s.provider)
+	if err != nil {
+		return generateSSHResult{}, err
+	}
+
+	typ := c.String(flag_secret_type)
+	if typ == "" {
+		typ = gen.SSHKeyED25519
+	}
+
+	key := gen.SSHKey{
+		Type:    typ,
+		Bits:    c.Int(flag_secret_bits),
+		Comment: c.String(flag_secret_comment),
+	}
+	pair, err := key.Generate()
+	if err != nil {
+		return generateSSHResult{}, err
+	}
+
+	chunks, err := setChunked(s.provider, annotator, name, string(pair.PrivateKey), c.Int(flag_secret_chunk), description, tags)
+	if err != nil {
+		return generateSSHResult{}, err
+	}
+
+	if err := setSecret(s.provider, annotator, name+".pub", string(pair.PublicKey), description, tags); err != nil {
+		return generateSSHResult{}, err
+	}
+
+	if err := setSecret(s.provider, annotator, name+".fingerprint", pair.Fingerprint, description, tags); err != nil {
+		return generateSSHResult{}, err
+	}
+
+	log.Infof("Generated %s key %s with fingerprint %s", typ, name, pair.Fingerprint)
+	return generateSSHResult{
+		Chunks:      chunks,
+		Fingerprint: pair.Fingerprint,
+		Key:         name,
+		PublicKey:   string(pair.PublicKey),
+		Type:        typ,
+	}, nil
+}
+
+// setChunked sets a secret, splitting values larger than size into chunks
+// stored as key/0, key/1, and so on. The key itself then holds the number of
+// chunks. Chunks left over from a previous value with more chunks are deleted.
+// Returns the number of chunks written, or zero if the value wasn't split.
+func setChunked(provider gcli.SecretProvider, annotator gcli.SecretAnnotator, key string, value string, size int, description string, tags map[string]string) (int, error) {
+	if size < 1 {
+		return 0, fmt.Errorf("chunk size must be greater than zero")
+	}
+
+	var previous int
+	current, err := provider.Get(key)
+	if err != nil && !errors.Is(err, gcli.ErrSecretNotFound) {
+		return 0, err
+	} else if err == nil && strings.HasPrefix(current, chunkPrefix) {
+		previous, _ = chunkCount(key, current)
+	}
+
+	var chunks int
+	if len(value) <= size {
+		err = setSecret(provider, annotator, key, value, description, tags)
+	} else {
+		for start := 0; start < len(value); start += size {
+			end := start + size
+			if end > len(value) {
+				end = len(value)
+			}
+
+			chunk := key + "/" + strconv.Itoa(chunks)
+			if err := setSecret(provider, annotator, chunk, value[start:end], description, tags); err != nil {
+				return 0, fmt.Errorf("error storing chunk %s: %w", chunk, err)
+			}
+			chunks++
+		}
+
+		err = setSecret(provider, annotator, key, chunkPrefix+strconv.Itoa(chunks), description, tags)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Stale chunks are only removed once the key no longer refers to them
+	for i := chunks; i < previous; i++ {
+		chunk := key + "/" + strconv.Itoa(i)
+		if err := provider.Delete(chunk); err != nil && !errors.Is(err, gcli.ErrSecretNotFound) {
+			return 0, fmt.Errorf("error deleting stale chunk %s: %w", chunk, err)
+		}
+	}
+
+	return chunks, nil
+}
+
+// getChunked returns the value of a secret, reassembling it if it was split
+// into chunks by setChunked.
+func getChunked(provider gcli.SecretProvider, key string) (string, error) {
+	value, err := provider.Get(key)
+	if err != nil || !strings.HasPrefix(value, chunkPrefix) {
+		return value, err
+	}
+
+	return assembleChunks(provider, key, value)
+}
+
+// chunkCount returns the number of chunks recorded in the value of a chunked
+// secret.
+func chunkCount(key string, value string) (int, error) {
+	chunks, err := strconv.Atoi(strings.TrimPrefix(value, chunkPrefix))
+	if err != nil || chunks < 1 {
+		return 0, fmt.Errorf("invalid chunk count for %s: %s", key, value)
+	}
+
+	return chunks, nil
+}
+
+// assembleChunks returns the value split into chunks beneath key, where value
+// is the chunk count stored in the key itself.
+func assembleChunks(provider gcli.SecretProvider, key string, value string) (string, error) {
+	chunks, err := chunkCount(key, value)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i := 0; i < chunks; i++ {
+		chunk := key + "/" + strconv.Itoa(i)
+		value, err := provider.Get(chunk)
+		if err != nil {
+			return "", fmt.Errorf("error fetching chunk %s: %w", chunk, err)
+		}
+		b.WriteString(value)
+	}
+
+	return b.String(), nil
+}
+
+// foldChunks returns the given secrets without the chunks of any chunked
+// secret which is also among them, so callers can handle each chunked value
+// as a single secret.
+func foldChunks(provider gcli.SecretProvider, secrets []gcli.SecretMetadata) ([]gcli.SecretMetadata, error) {
+	listed := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		listed[secret.Key] = true
+	}
+
+	// Only secrets with a listed first chunk need to be checked
+	chunks := make(map[string]bool)
+	for _, secret := range secrets {
+		if !listed[secret.Key+"/0"] {
+			continue
+		}
+
+		value, err := provider.Get(secret.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(value, chunkPrefix) {
+			continue
+		}
+
+		count, err := chunkCount(secret.Key, value)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			chunks[secret.Key+"/"+strconv.Itoa(i)] = true
+		}
+	}
+
+	folded := make([]gcli.SecretMetadata, 0, len(secrets))
+	for _, secret := range secrets {
+		if !chunks[secret.Key] {
+			folded = append(folded, secret)
+		}
+	}
+
+	return folded, nil
+}
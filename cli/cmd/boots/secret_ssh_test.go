@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshFlags returns the flags used by the ssh generate command.
+func sshFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: flag_secret_type, Value: gen.SSHKeyED25519},
+		&cli.IntFlag{Name: flag_secret_bits},
+		&cli.StringFlag{Name: flag_secret_comment},
+		&cli.IntFlag{Name: flag_secret_chunk, Value: defaultChunkSize},
+		&cli.StringFlag{Name: flag_secret_desc},
+		&cli.StringSliceFlag{Name: flag_secret_tag},
+		&cli.BoolFlag{Name: flag_secret_force},
+	}
+}
+
+func TestGenerateSSH(t *testing.T) {
+	is := is.New(t)
+	secrets := make(map[string]string)
+	s := secretConfig{provider: newMapProvider(secrets)}
+
+	// With ed25519
+	result, err := generateSSH(newTestContext(sshFlags(), "--comment", "ops@glab", "ssh/provision"), &s)
+	is.NoErr(err)
+	is.Equal(result.Chunks, 0)
+	is.Equal(secrets["ssh/provision.pub"], result.PublicKey)
+	is.Equal(secrets["ssh/provision.fingerprint"], result.Fingerprint)
+	is.Equal(string(result.Raw()), result.PublicKey)
+	is.True(strings.HasSuffix(result.PublicKey, " ops@glab\n"))
+
+	signer, err := ssh.ParsePrivateKey([]byte(secrets["ssh/provision"]))
+	is.NoErr(err)
+	is.Equal(signer.PublicKey().Type(), ssh.KeyAlgoED25519)
+	is.Equal(ssh.FingerprintSHA256(signer.PublicKey()), result.Fingerprint)
+
+	// With chunked RSA key
+	result, err = generateSSH(newTestContext(sshFlags(), "--type", "rsa", "--bits", "2048", "--chunk-size", "512", "ssh/rsa"), &s)
+	is.NoErr(err)
+	is.True(result.Chunks > 1)
+	is.Equal(secrets["ssh/rsa"], chunkPrefix+strconv.Itoa(result.Chunks))
+
+	private, err := getChunked(s.provider, "ssh/rsa")
+	is.NoErr(err)
+	signer, err = ssh.ParsePrivateKey([]byte(private))
+	is.NoErr(err)
+	is.Equal(ssh.FingerprintSHA256(signer.PublicKey()), result.Fingerprint)
+
+	// With existing key
+	_, err = generateSSH(newTestContext(sshFlags(), "ssh/rsa"), &s)
+	is.Equal(err.Error(), "ssh/rsa already exists; pass --force to replace it")
+	is.Equal(secrets["ssh/rsa"], chunkPrefix+strconv.Itoa(result.Chunks))
+
+	// With existing chunked key replaced by fewer chunks
+	chunks := result.Chunks
+	result, err = generateSSH(newTestContext(sshFlags(), "--force", "ssh/rsa"), &s)
+	is.NoErr(err)
+	is.Equal(result.Chunks, 0)
+	for i := 0; i < chunks; i++ {
+		_, ok := secrets["ssh/rsa/"+strconv.Itoa(i)]
+		is.True(!ok)
+	}
+
+	private, err = getChunked(s.provider, "ssh/rsa")
+	is.NoErr(err)
+	signer, err = ssh.ParsePrivateKey([]byte(private))
+	is.NoErr(err)
+	is.Equal(ssh.FingerprintSHA256(signer.PublicKey()), result.Fingerprint)
+
+	// With invalid type
+	_, err = generateSSH(newTestContext(sshFlags(), "--type", "dsa", "ssh/dsa"), &s)
+	is.Equal(err.Error(), "unknown SSH key type: dsa")
+
+	// With no key
+	_, err = generateSSH(newTestContext(sshFlags()), &s)
+	is.Equal(err.Error(), "must provide a key")
+}
+
+func TestChunked(t *testing.T) {
+	is := is.New(t)
+	secrets := make(map[string]string)
+	provider := newMapProvider(secrets)
+
+	// With small value
+	chunks, err := setChunked(provider, nil, "small", "value", 8, "", nil)
+	is.NoErr(err)
+	is.Equal(chunks, 0)
+	is.Equal(secrets["small"], "value")
+
+	// With large value
+	chunks, err = setChunked(provider, nil, "large", "0123456789abcdefghij", 8, "", nil)
+	is.NoErr(err)
+	is.Equal(chunks, 3)
+	is.Equal(secrets["large/2"], "ghij")
+
+	for key, expected := range map[string]string{"small": "value", "large": "0123456789abcdefghij"} {
+		value, err := getChunked(provider, key)
+		is.NoErr(err)
+		is.Equal(value, expected)
+	}
+
+	// With missing chunk
+	_, err = getChunked(newMapProvider(map[string]string{"large": chunkPrefix + "2", "large/0": "01234567"}), "large")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With fewer chunks than before
+	chunks, err = setChunked(provider, nil, "large", "0123456789", 8, "", nil)
+	is.NoErr(err)
+	is.Equal(chunks, 2)
+	_, ok := secrets["large/2"]
+	is.True(!ok)
+
+	chunks, err = setChunked(provider, nil, "large", "0123456789abcdefghij", 8, "", nil)
+	is.NoErr(err)
+	is.Equal(chunks, 3)
+
+	// With folded chunks
+	secrets["plain"] = "value"
+	secrets["plain/0"] = "unrelated"
+	folded, err := foldChunks(provider, []gcli.SecretMetadata{{Key: "large"}, {Key: "large/0"}, {Key: "large/1"}, {Key: "large/2"}, {Key: "plain"}, {Key: "plain/0"}})
+	is.NoErr(err)
+	is.Equal(folded, []gcli.SecretMetadata{{Key: "large"}, {Key: "plain"}, {Key: "plain/0"}})
+
+	// With invalid chunk count
+	secrets["invalid"] = chunkPrefix + "x"
+	_, err = getChunked(provider, "invalid")
+	is.Equal(err.Error(), "invalid chunk count for invalid: boots:chunked:x")
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"strings"
 	"testing"
 
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
 	"github.com/HomeOperations/jmgilman/cli/mocks"
 	"github.com/matryer/is"
+	"github.com/spf13/afero"
 	"github.com/urfave/cli/v2"
 )
 
@@ -51,51 +56,248 @@ func TestDelete(t *testing.T) {
 func TestGenerate(t *testing.T) {
 	is := is.New(t)
 	expected_key := "key"
-	expected_value := "value"
 
-	flagSet := flag.NewFlagSet("", 0)
-	flagSet.Int(flag_secret_length, 12, "")
-	flagSet.Int(flag_secret_numbers, 2, "")
-	flagSet.Int(flag_secret_symbols, 3, "")
-	_ = flagSet.Parse([]string{expected_key})
-	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("", 0)
+		flagSet.String(flag_secret_type, gen.TypePassword, "")
+		flagSet.String(flag_secret_policy, gen.DefaultPolicy, "")
+		flagSet.String(flag_secret_policies, "", "")
+		flagSet.Int(flag_secret_length, 0, "")
+		flagSet.Int(flag_secret_numbers, 0, "")
+		flagSet.Int(flag_secret_symbols, 0, "")
+		flagSet.String(flag_secret_allowed, "", "")
+		flagSet.Bool(flag_secret_ambiguous, false, "")
+		flagSet.Int(flag_secret_words, gen.DefaultWords, "")
+		flagSet.String(flag_secret_separator, "-", "")
+		flagSet.Int(flag_secret_bytes, gen.DefaultTokenBytes, "")
+		flagSet.Bool(flag_secret_if_missing, false, "")
+		flagSet.Bool(flag_secret_reveal, false, "")
+		flagSet.String(flag_secret_desc, "", "")
+		flagSet.Var(&cli.StringSlice{}, flag_secret_tag, "")
+		_ = flagSet.Parse(args)
+		return cli.NewContext(&cli.App{}, flagSet, nil)
+	}
 
 	// With no error
 	var got_key string
-	var got_length int
-	var got_numbers int
-	var got_symbols int
+	var got_value string
 	s := secretConfig{
+		fs: afero.NewMemMapFs(),
 		provider: &mocks.MockSecretProvider{
-			FnGenerate: func(key string, length int, nums int, symbols int) (string, error) {
+			FnSet: func(key string, value string) error {
 				got_key = key
-				got_length = length
-				got_numbers = nums
-				got_symbols = symbols
-				return expected_value, nil
+				got_value = value
+				return nil
 			},
 		},
 	}
 
-	result, err := generate(ctx, &s)
+	result, err := generate(newContext(expected_key), &s)
 	is.NoErr(err)
 	is.Equal(expected_key, got_key)
-	is.Equal(12, got_length)
-	is.Equal(2, got_numbers)
-	is.Equal(3, got_symbols)
+	is.Equal(len(got_value), 16)
 	is.Equal(result.Key, expected_key)
-	is.Equal(result.Value, expected_value)
+	is.Equal(result.Policy, gen.DefaultPolicy)
+	is.Equal(result.Type, gen.TypePassword)
+	is.Equal(result.Value, got_value)
+	is.True(result.Entropy > 100)
+	is.True(result.Created)
+
+	// With overrides
+	_, err = generate(newContext("--length", "12", "--symbols", "3", "--allowed-symbols", "-_", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 12)
+	is.True(strings.Count(got_value, "-")+strings.Count(got_value, "_") >= 3)
+
+	// With numbers and symbols excluded
+	for i := 0; i < 20; i++ {
+		_, err = generate(newContext("--length", "64", "--numbers", "0", "--symbols", "0", expected_key), &s)
+		is.NoErr(err)
+		is.True(!strings.ContainsAny(got_value, gen.Digits+gen.Symbols))
+	}
+
+	// With symbols required by a policy which excludes them
+	_, err = generate(newContext("--policy", "alphanumeric", "--symbols", "2", expected_key), &s)
+	is.NoErr(err)
+	symbols := 0
+	for _, r := range got_value {
+		if strings.ContainsRune(gen.Symbols, r) {
+			symbols++
+		}
+	}
+	is.True(symbols >= 2)
+
+	// With numbers excluded from a custom alphabet
+	is.NoErr(afero.WriteFile(s.fs, "alphabet.yml", []byte("pin:\n  length: 64\n  alphabet: \"abc123\"\n"), 0644))
+	_, err = generate(newContext("--policy-file", "alphabet.yml", "--policy", "pin", "--numbers", "0", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 64)
+	is.True(!strings.ContainsAny(got_value, gen.Digits))
+
+	// With named policy
+	_, err = generate(newContext("--policy", "alphanumeric", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 32)
+
+	// With policy file
+	is.NoErr(afero.WriteFile(s.fs, "policies.yml", []byte("vmrest:\n  length: 8\n  no_symbols: true\n"), 0644))
+	result, err = generate(newContext("--policy-file", "policies.yml", "--policy", "vmrest", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 8)
+	is.Equal(result.Policy, "vmrest")
+
+	// With passphrase
+	result, err = generate(newContext("--type", "passphrase", "--words", "4", "--separator", " ", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(strings.Split(got_value, " ")), 4)
+	is.Equal(result.Entropy, 51.6)
+	is.Equal(result.Policy, "")
+
+	// With tokens
+	result, err = generate(newContext("--type", "hex", "--bytes", "16", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 32)
+	is.Equal(result.Entropy, 128.0)
+
+	_, err = generate(newContext("--type", "base64", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 43)
+
+	result, err = generate(newContext("--type", "uuid", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 36)
+	is.Equal(result.Entropy, 122.0)
+
+	_, err = generate(newContext("--type", "alnum", "--length", "20", expected_key), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 20)
+	is.Equal(strings.Trim(got_value, gen.LowerLetters+gen.UpperLetters+gen.Digits), "")
+
+	// With HashiCorp types
+	for _, typ := range []string{gen.TypeACLToken, gen.TypeConsulGossip, gen.TypeNomadGossip, gen.TypeVaultUnsealPlaceholder} {
+		_, err = generate(newContext("--type", typ, expected_key), &s)
+		is.NoErr(err)
+		is.NoErr(gen.ValidateValue(typ, got_value))
+	}
+	is.Equal(got_value, gen.VaultUnsealPlaceholder)
+
+	// With keypair types
+	for _, typ := range []string{gen.TypeAge, gen.TypeWireGuard} {
+		secrets := map[string]string{}
+		result, err = generate(newContext("--type", typ, expected_key), &secretConfig{provider: newMapProvider(secrets)})
+		is.NoErr(err)
+		is.NoErr(gen.ValidateValue(typ, secrets[expected_key]))
+		is.Equal(result.PublicKey, secrets[expected_key+".pub"])
+		is.Equal(result.Value, "")
+		is.Equal(result.Entropy, 251.0)
+	}
+
+	// With if missing
+	secrets := map[string]string{}
+	creator := &mocks.MockSecretCreator{
+		MockSecretProvider: newMapProvider(secrets).MockSecretProvider,
+		FnCreate: func(key string, value string) error {
+			if _, ok := secrets[key]; ok {
+				return gcli.ErrSecretExists
+			}
+			secrets[key] = value
+			return nil
+		},
+	}
+	cs := &secretConfig{provider: creator}
+
+	result, err = generate(newContext("--if-missing", expected_key), cs)
+	is.NoErr(err)
+	is.True(result.Created)
+	is.Equal(result.Value, "")
+	existing := secrets[expected_key]
+	is.Equal(len(existing), 16)
+
+	result, err = generate(newContext("--if-missing", expected_key), cs)
+	is.NoErr(err)
+	is.True(!result.Created)
+	is.Equal(result.Value, "")
+	is.Equal(secrets[expected_key], existing)
+
+	result, err = generate(newContext("--if-missing", "--reveal", expected_key), cs)
+	is.NoErr(err)
+	is.True(!result.Created)
+	is.Equal(result.Value, existing)
+
+	result, err = generate(newContext("--if-missing", "--reveal", "other"), cs)
+	is.NoErr(err)
+	is.True(result.Created)
+	is.Equal(result.Value, secrets["other"])
+
+	// With if missing keypair
+	result, err = generate(newContext("--if-missing", "--type", "wireguard", "wg"), cs)
+	is.NoErr(err)
+	is.True(result.Created)
+	public := secrets["wg.pub"]
+	is.Equal(result.PublicKey, public)
+
+	result, err = generate(newContext("--if-missing", "--type", "wireguard", "wg"), cs)
+	is.NoErr(err)
+	is.True(!result.Created)
+	is.Equal(result.PublicKey, public)
+
+	// With if missing and an unsupported backend
+	_, err = generate(newContext("--if-missing", expected_key), &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+
+	// With if missing and annotations
+	var got_desc string
+	var got_tags map[string]string
+	annotated := &mocks.MockSecretAnnotatedCreator{
+		MockSecretAnnotator: mocks.MockSecretAnnotator{
+			FnSetAnnotated: func(key string, value string, description string, tags map[string]string) error {
+				return fmt.Errorf("secret written twice")
+			},
+		},
+		FnCreateAnnotated: func(key string, value string, description string, tags map[string]string) error {
+			got_desc = description
+			got_tags = tags
+			return nil
+		},
+	}
+
+	result, err = generate(newContext("--if-missing", "--description", "vmrest password", "--tag", "owner=ops", expected_key), &secretConfig{provider: annotated})
+	is.NoErr(err)
+	is.True(result.Created)
+	is.Equal(got_desc, "vmrest password")
+	is.Equal(got_tags, map[string]string{"owner": "ops"})
+
+	// With if missing and annotations on a backend which can't create them
+	_, err = generate(newContext("--if-missing", "--tag", "owner=ops", expected_key), &secretConfig{provider: &mocks.MockSecretAnnotator{}})
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+
+	// With unknown type
+	_, err = generate(newContext("--type", "pin", expected_key), &s)
+	is.Equal(err.Error(), "unknown type: pin")
+
+	// With invalid passphrase
+	_, err = generate(newContext("--type", "passphrase", "--words", "0", expected_key), &s)
+	is.Equal(err.Error(), "word count must be greater than zero")
+
+	// With unknown policy
+	_, err = generate(newContext("--policy", "missing", expected_key), &s)
+	is.Equal(err.Error(), "unknown policy: missing")
+
+	// With invalid overrides
+	_, err = generate(newContext("--length", "2", "--numbers", "3", expected_key), &s)
+	is.Equal(err.Error(), "required characters (4) exceed length (2)")
 
 	// With error
 	s = secretConfig{
+		fs: afero.NewMemMapFs(),
 		provider: &mocks.MockSecretProvider{
-			FnGenerate: func(key string, length int, nums int, symbols int) (string, error) {
-				return "", fmt.Errorf("failed")
+			FnSet: func(key string, value string) error {
+				return fmt.Errorf("failed")
 			},
 		},
 	}
 
-	_, err = generate(ctx, &s)
+	_, err = generate(newContext(expected_key), &s)
 	is.Equal(err.Error(), "failed")
 }
 
@@ -181,3 +383,341 @@ func TestSet(t *testing.T) {
 	_, err = set(ctx, &s)
 	is.Equal(err.Error(), "failed")
 }
+
+func TestSetTyped(t *testing.T) {
+	is := is.New(t)
+
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("", 0)
+		flagSet.String(flag_secret_type, "", "")
+		_ = flagSet.Parse(args)
+		return cli.NewContext(&cli.App{}, flagSet, nil)
+	}
+
+	var got_value string
+	s := secretConfig{
+		provider: &mocks.MockSecretProvider{
+			FnSet: func(key string, value string) error {
+				got_value = value
+				return nil
+			},
+		},
+	}
+
+	// With valid value
+	key := "zGhUQ3ZRsfT5iS8xXwQ8R0mFBhGvbSmWI4fYGzC2ZPU="
+	_, err := set(newContext("--type", "consul-gossip", "gossip", key), &s)
+	is.NoErr(err)
+	is.Equal(got_value, key)
+
+	// With invalid value
+	got_value = ""
+	_, err = set(newContext("--type", "acl-token", "token", "root"), &s)
+	is.Equal(err.Error(), "acl-token must be a UUID")
+	is.Equal(got_value, "")
+}
+
+func TestList(t *testing.T) {
+	is := is.New(t)
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.Bool(flag_secret_recurse, true, "")
+	flagSet.Bool(flag_secret_values, false, "")
+	_ = flagSet.Parse([]string{"/glab"})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	// With no error
+	var got_prefix string
+	var got_recursive bool
+	s := secretConfig{
+		provider: &mocks.MockSecretLister{
+			MockSecretProvider: mocks.MockSecretProvider{
+				FnGet: func(key string) (string, error) {
+					return "value", nil
+				},
+			},
+			FnList: func(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+				got_prefix = prefix
+				got_recursive = recursive
+				return []gcli.SecretMetadata{{Key: "/glab/test", Version: 1}}, nil
+			},
+		},
+	}
+
+	result, err := list(ctx, &s)
+	is.NoErr(err)
+	is.Equal(got_prefix, "/glab")
+	is.True(got_recursive)
+	is.Equal(len(result.Secrets), 1)
+	is.Equal(result.Secrets[0].Key, "/glab/test")
+	is.Equal(result.Secrets[0].Value, "")
+
+	// With values
+	ctx.Set(flag_secret_values, "true")
+	result, err = list(ctx, &s)
+	is.NoErr(err)
+	is.Equal(result.Secrets[0].Value, "value")
+
+	// With unsupported backend
+	s = secretConfig{
+		provider: &mocks.MockSecretProvider{},
+	}
+
+	_, err = list(ctx, &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestGetVersion(t *testing.T) {
+	is := is.New(t)
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.Int64(flag_secret_version, 0, "")
+	_ = flagSet.Parse([]string{"--version", "2", "key"})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	// With no error
+	var got_version int64
+	s := secretConfig{
+		provider: &mocks.MockSecretVersioner{
+			FnGetVersion: func(key string, version int64) (string, error) {
+				got_version = version
+				return "old", nil
+			},
+		},
+	}
+
+	result, err := get(ctx, &s)
+	is.NoErr(err)
+	is.Equal(got_version, int64(2))
+	is.Equal(result.Value, "old")
+	is.Equal(result.Version, int64(2))
+
+	// With unsupported backend
+	s = secretConfig{
+		provider: &mocks.MockSecretProvider{},
+	}
+
+	_, err = get(ctx, &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestHistory(t *testing.T) {
+	is := is.New(t)
+
+	flagSet := flag.NewFlagSet("", 0)
+	_ = flagSet.Parse([]string{"key"})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	// With no error
+	var got_key string
+	s := secretConfig{
+		provider: &mocks.MockSecretVersioner{
+			FnHistory: func(key string) ([]gcli.SecretVersion, error) {
+				got_key = key
+				return []gcli.SecretVersion{{Version: 1, ModifiedBy: "admin"}}, nil
+			},
+		},
+	}
+
+	result, err := history(ctx, &s)
+	is.NoErr(err)
+	is.Equal(got_key, "key")
+	is.Equal(result.Versions, []gcli.SecretVersion{{Version: 1, ModifiedBy: "admin"}})
+
+	// With unsupported backend
+	s = secretConfig{
+		provider: &mocks.MockSecretProvider{},
+	}
+
+	_, err = history(ctx, &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestRollback(t *testing.T) {
+	is := is.New(t)
+
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("", 0)
+		_ = flagSet.Parse(args)
+		return cli.NewContext(&cli.App{}, flagSet, nil)
+	}
+
+	// With no error
+	var got_value string
+	s := secretConfig{
+		provider: &mocks.MockSecretVersioner{
+			MockSecretProvider: mocks.MockSecretProvider{
+				FnSet: func(key string, value string) error {
+					got_value = value
+					return nil
+				},
+			},
+			FnGetVersion: func(key string, version int64) (string, error) {
+				if version != 2 {
+					return "", gcli.ErrVersionNotFound
+				}
+				return "old", nil
+			},
+		},
+	}
+
+	result, err := rollback(newContext("key", "2"), &s)
+	is.NoErr(err)
+	is.Equal(got_value, "old")
+	is.Equal(result.Version, int64(2))
+
+	// With missing version
+	_, err = rollback(newContext("key", "9"), &s)
+	is.True(errors.Is(err, gcli.ErrVersionNotFound))
+
+	// With invalid version
+	_, err = rollback(newContext("key", "latest"), &s)
+	is.Equal(err.Error(), "invalid version: latest")
+
+	// With unsupported backend
+	s = secretConfig{
+		provider: &mocks.MockSecretProvider{},
+	}
+
+	_, err = rollback(newContext("key", "2"), &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestDescribe(t *testing.T) {
+	is := is.New(t)
+
+	flagSet := flag.NewFlagSet("", 0)
+	_ = flagSet.Parse([]string{"key"})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	// With no error
+	s := secretConfig{
+		provider: &mocks.MockSecretAnnotator{
+			FnDescribe: func(key string) (gcli.SecretMetadata, error) {
+				return gcli.SecretMetadata{Key: key, Description: "test"}, nil
+			},
+		},
+	}
+
+	result, err := describe(ctx, &s)
+	is.NoErr(err)
+	is.Equal(result.Key, "key")
+	is.Equal(result.Description, "test")
+
+	// With unsupported backend
+	s = secretConfig{
+		provider: &mocks.MockSecretProvider{},
+	}
+
+	_, err = describe(ctx, &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestSetAnnotated(t *testing.T) {
+	is := is.New(t)
+
+	newContext := func(args ...string) *cli.Context {
+		flagSet := flag.NewFlagSet("", 0)
+		flagSet.String(flag_secret_desc, "", "")
+		flagSet.Var(&cli.StringSlice{}, flag_secret_tag, "")
+		flagSet.String(flag_secret_policy, gen.DefaultPolicy, "")
+		_ = flagSet.Parse(args)
+		return cli.NewContext(&cli.App{}, flagSet, nil)
+	}
+
+	// With set
+	var got_value string
+	var got_description string
+	var got_tags map[string]string
+	s := secretConfig{
+		provider: &mocks.MockSecretAnnotator{
+			FnSetAnnotated: func(key string, value string, description string, tags map[string]string) error {
+				got_value = value
+				got_description = description
+				got_tags = tags
+				return nil
+			},
+		},
+	}
+
+	_, err := set(newContext("--description", "vmrest password", "--tag", "owner=ops", "key", "value"), &s)
+	is.NoErr(err)
+	is.Equal(got_value, "value")
+	is.Equal(got_description, "vmrest password")
+	is.Equal(got_tags, map[string]string{"owner": "ops"})
+
+	// With generate
+	_, err = generate(newContext("--tag", "owner=ops", "key"), &s)
+	is.NoErr(err)
+	is.Equal(len(got_value), 16)
+	is.Equal(got_tags, map[string]string{"owner": "ops"})
+
+	// With invalid tag
+	_, err = set(newContext("--tag", "owner", "key", "value"), &s)
+	is.Equal(err.Error(), "invalid tag: owner")
+
+	// With unsupported backend
+	s = secretConfig{
+		provider: &mocks.MockSecretProvider{},
+	}
+
+	_, err = set(newContext("--description", "test", "key", "value"), &s)
+	is.True(errors.Is(err, gcli.ErrUnsupported))
+}
+
+func TestListTagged(t *testing.T) {
+	is := is.New(t)
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.Bool(flag_secret_recurse, false, "")
+	flagSet.Bool(flag_secret_values, false, "")
+	flagSet.Var(&cli.StringSlice{}, flag_secret_tag, "")
+	_ = flagSet.Parse([]string{"--tag", "owner=ops", "/glab"})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	tags := map[string]map[string]string{
+		"/glab/a": {"owner": "ops", "env": "dev"},
+		"/glab/b": {"owner": "dev"},
+		"/glab/c": nil,
+	}
+	s := secretConfig{
+		provider: &mocks.MockSecretAnnotator{
+			MockSecretLister: mocks.MockSecretLister{
+				FnList: func(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+					return []gcli.SecretMetadata{{Key: "/glab/a"}, {Key: "/glab/b"}, {Key: "/glab/c"}}, nil
+				},
+			},
+			FnDescribe: func(key string) (gcli.SecretMetadata, error) {
+				return gcli.SecretMetadata{Key: key, Tags: tags[key]}, nil
+			},
+		},
+	}
+
+	result, err := list(ctx, &s)
+	is.NoErr(err)
+	is.Equal(len(result.Secrets), 1)
+	is.Equal(result.Secrets[0].Key, "/glab/a")
+	is.Equal(result.Secrets[0].Tags, tags["/glab/a"])
+
+	// With filtering by the provider
+	var got_tags map[string]string
+	s = secretConfig{
+		provider: &mocks.MockSecretTagFilter{
+			MockSecretLister: mocks.MockSecretLister{
+				FnList: func(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+					return nil, fmt.Errorf("unfiltered list")
+				},
+			},
+			FnListTagged: func(prefix string, recursive bool, tags map[string]string) ([]gcli.SecretMetadata, error) {
+				got_tags = tags
+				return []gcli.SecretMetadata{{Key: "/glab/a", Tags: tags}}, nil
+			},
+		},
+	}
+
+	result, err = list(ctx, &s)
+	is.NoErr(err)
+	is.Equal(got_tags, map[string]string{"owner": "ops"})
+	is.Equal(len(result.Secrets), 1)
+	is.Equal(result.Secrets[0].Key, "/glab/a")
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
+	"github.com/HomeOperations/jmgilman/cli/sshca"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	flag_sshca_bits            = "bits"
+	flag_sshca_critical_option = "critical-option"
+	flag_sshca_extension       = "extension"
+	flag_sshca_force           = "force"
+	flag_sshca_key_id          = "key-id"
+	flag_sshca_no_extensions   = "no-default-extensions"
+	flag_sshca_prefix          = "prefix"
+	flag_sshca_principal       = "principal"
+	flag_sshca_ttl             = "ttl"
+	flag_sshca_type            = "type"
+	flag_sshca_valid_from      = "valid-from"
+)
+
+// sshCAName is the name the CA key is stored under beneath the prefix.
+const sshCAName = "ca"
+
+// sshCAConfig holds dependencies utilized by the ssh-ca subcommand.
+type sshCAConfig struct {
+	fs       afero.Fs
+	provider gcli.SecretProvider
+}
+
+// newSSHCAConfig returns a sshCAConfig configured with default dependencies.
+func newSSHCAConfig(c *cli.Context) (*sshCAConfig, error) {
+	provider, err := newSecretProvider(c, c.String(flag_secret_backend))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sshCAConfig{fs: afero.NewOsFs(), provider: provider}, nil
+}
+
+// sshCACmd returns the ssh-ca subcommand.
+func sshCACmd(a gcli.App) *cli.Command {
+	flags := append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_sshca_prefix,
+			Value: "/glab/ssh",
+			Usage: "path prefix the CA key is stored under",
+		},
+	}, secretBackendFlags()...)
+
+	signFlags := func(ttl time.Duration) []cli.Flag {
+		return append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     flag_sshca_principal,
+				Aliases:  []string{"n"},
+				Usage:    "hostname or username the certificate is valid for (may be repeated)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  flag_sshca_key_id,
+				Usage: "identifier logged when the certificate is used (defaults to the first principal)",
+			},
+			&cli.DurationFlag{
+				Name:  flag_sshca_ttl,
+				Value: ttl,
+				Usage: "how long the certificate is valid for",
+			},
+			&cli.TimestampFlag{
+				Name:   flag_sshca_valid_from,
+				Layout: time.RFC3339,
+				Usage:  "time the certificate becomes valid (defaults to now)",
+			},
+		}, flags...)
+	}
+
+	initCmd := &cli.Command{
+		Name:  "init",
+		Usage: "Generates the CA key and prints its public key",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    flag_sshca_type,
+				Aliases: []string{"t"},
+				Value:   gen.SSHKeyED25519,
+				Usage:   "type of key to generate (ed25519, rsa, or ecdsa)",
+			},
+			&cli.IntFlag{
+				Name:  flag_sshca_bits,
+				Usage: "size of RSA keys (default 4096) or curve size of ECDSA keys (default 256)",
+			},
+			&cli.BoolFlag{
+				Name:  flag_sshca_force,
+				Usage: "replace an existing CA key",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			s, err := newSSHCAConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := initSSHCA(c, s)
+			return a.Exit(c, data, err)
+		},
+	}
+	signHost := &cli.Command{
+		Name:      "sign-host",
+		Usage:     "Signs a host public key and prints the certificate",
+		ArgsUsage: "<PUBLIC_KEY_FILE>",
+		Flags:     signFlags(52 * 7 * 24 * time.Hour),
+		Action: func(c *cli.Context) error {
+			s, err := newSSHCAConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := signSSH(c, s, ssh.HostCert)
+			return a.Exit(c, data, err)
+		},
+	}
+	signUser := &cli.Command{
+		Name:      "sign-user",
+		Usage:     "Signs a user public key and prints the certificate",
+		ArgsUsage: "<PUBLIC_KEY_FILE>",
+		Flags: append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  flag_sshca_extension,
+				Usage: "extension to grant in addition to the defaults (NAME or NAME=VALUE)",
+			},
+			&cli.BoolFlag{
+				Name:  flag_sshca_no_extensions,
+				Usage: "don't grant the default extensions (permit-pty, permit-port-forwarding, etc.)",
+			},
+			&cli.StringSliceFlag{
+				Name:  flag_sshca_critical_option,
+				Usage: "critical option restricting the certificate (NAME=VALUE)",
+			},
+		}, signFlags(24*time.Hour)...),
+		Action: func(c *cli.Context) error {
+			s, err := newSSHCAConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := signSSH(c, s, ssh.UserCert)
+			return a.Exit(c, data, err)
+		},
+	}
+
+	return &cli.Command{
+		Name:        "ssh-ca",
+		Usage:       "Manages the bootstrap SSH certificate authority",
+		Subcommands: []*cli.Command{initCmd, signHost, signUser},
+	}
+}
+
+// initSSHCA generates the CA key and stores it along with its public key.
+func initSSHCA(c *cli.Context, s *sshCAConfig) (generateSSHResult, error) {
+	name := path.Join(c.String(flag_sshca_prefix), sshCAName)
+	if err := ensureNoSecret(s.provider, name, c.Bool(flag_sshca_force)); err != nil {
+		return generateSSHResult{}, err
+	}
+
+	key := gen.SSHKey{
+		Type:    c.String(flag_sshca_type),
+		Bits:    c.Int(flag_sshca_bits),
+		Comment: "GLab SSH CA",
+	}
+	pair, err := key.Generate()
+	if err != nil {
+		return generateSSHResult{}, err
+	}
+
+	chunks, err := setChunked(s.provider, nil, name, string(pair.PrivateKey), defaultChunkSize, "", nil)
+	if err != nil {
+		return generateSSHResult{}, err
+	}
+
+	if err := s.provider.Set(name+".pub", string(pair.PublicKey)); err != nil {
+		return generateSSHResult{}, err
+	}
+
+	log.Infof("Generated SSH CA %s with fingerprint %s", name, pair.Fingerprint)
+	return generateSSHResult{
+		Chunks:      chunks,
+		Fingerprint: pair.Fingerprint,
+		Key:         name,
+		PublicKey:   string(pair.PublicKey),
+		Type:        key.Type,
+	}, nil
+}
+
+// sshCertResult is the result from calling signSSH().
+type sshCertResult struct {
+	Certificate string
+}
+
+// Raw returns the certificate in the format read by sshd and ssh.
+func (s sshCertResult) Raw() []byte {
+	return []byte(s.Certificate)
+}
+
+// signSSH signs the public key in the given file with the stored CA key.
+func signSSH(c *cli.Context, s *sshCAConfig, certType uint32) (sshCertResult, error) {
+	if c.NArg() < 1 {
+		return sshCertResult{}, fmt.Errorf("must provide a public key file")
+	}
+
+	data, err := afero.ReadFile(s.fs, c.Args().First())
+	if err != nil {
+		return sshCertResult{}, err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return sshCertResult{}, fmt.Errorf("error parsing public key: %s", err)
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		return sshCertResult{}, fmt.Errorf("%s is already a certificate", c.Args().First())
+	}
+
+	name := path.Join(c.String(flag_sshca_prefix), sshCAName)
+	private, err := getChunked(s.provider, name)
+	if err != nil {
+		return sshCertResult{}, fmt.Errorf("error fetching CA key %s: %w", name, err)
+	}
+	ca, err := ssh.ParsePrivateKey([]byte(private))
+	if err != nil {
+		return sshCertResult{}, fmt.Errorf("error parsing CA key: %s", err)
+	}
+
+	// Allow for clocks which are slightly behind unless a time is given
+	validFrom := time.Now().Add(-time.Minute)
+	if ts := c.Timestamp(flag_sshca_valid_from); ts != nil {
+		validFrom = *ts
+	}
+
+	req := sshca.Request{
+		CertType:    certType,
+		KeyID:       c.String(flag_sshca_key_id),
+		Principals:  c.StringSlice(flag_sshca_principal),
+		ValidAfter:  validFrom,
+		ValidBefore: validFrom.Add(c.Duration(flag_sshca_ttl)),
+	}
+	if req.KeyID == "" && len(req.Principals) > 0 {
+		req.KeyID = req.Principals[0]
+	}
+
+	if certType == ssh.UserCert {
+		req.Extensions = sshca.DefaultUserExtensions()
+		if c.Bool(flag_sshca_no_extensions) {
+			req.Extensions = make(map[string]string)
+		}
+		for _, ext := range c.StringSlice(flag_sshca_extension) {
+			parts := strings.SplitN(ext, "=", 2)
+			req.Extensions[parts[0]] = ""
+			if len(parts) == 2 {
+				req.Extensions[parts[0]] = parts[1]
+			}
+		}
+
+		req.CriticalOptions, err = parseOptions(c.StringSlice(flag_sshca_critical_option))
+		if err != nil {
+			return sshCertResult{}, err
+		}
+	}
+
+	cert, err := sshca.Sign(ca, key, req)
+	if err != nil {
+		return sshCertResult{}, err
+	}
+
+	log.Infof("Signed certificate %s with serial %d valid until %s", cert.KeyId, cert.Serial, req.ValidBefore)
+	return sshCertResult{Certificate: string(ssh.MarshalAuthorizedKey(cert))}, nil
+}
+
+// parseOptions parses critical options in the form NAME=VALUE.
+func parseOptions(values []string) (map[string]string, error) {
+	options := make(map[string]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid critical option: %s", value)
+		}
+		options[parts[0]] = parts[1]
+	}
+
+	return options, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
+	"github.com/HomeOperations/jmgilman/cli/sshca"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshCAFlags returns the flags used by the ssh-ca commands.
+func sshCAFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{Name: flag_sshca_bits},
+		&cli.StringSliceFlag{Name: flag_sshca_critical_option},
+		&cli.StringSliceFlag{Name: flag_sshca_extension},
+		&cli.BoolFlag{Name: flag_sshca_force},
+		&cli.StringFlag{Name: flag_sshca_key_id},
+		&cli.BoolFlag{Name: flag_sshca_no_extensions},
+		&cli.StringFlag{Name: flag_sshca_prefix, Value: "/glab/ssh"},
+		&cli.StringSliceFlag{Name: flag_sshca_principal},
+		&cli.DurationFlag{Name: flag_sshca_ttl, Value: time.Hour},
+		&cli.StringFlag{Name: flag_sshca_type, Value: gen.SSHKeyED25519},
+		&cli.TimestampFlag{Name: flag_sshca_valid_from, Layout: time.RFC3339},
+	}
+}
+
+// parseCertificate parses the certificate printed by signSSH.
+func parseCertificate(t *testing.T, result sshCertResult) *ssh.Certificate {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(result.Raw())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		t.Fatalf("expected certificate, got %T", key)
+	}
+
+	return cert
+}
+
+func TestSSHCA(t *testing.T) {
+	is := is.New(t)
+	secrets := make(map[string]string)
+	s := sshCAConfig{
+		fs:       afero.NewMemMapFs(),
+		provider: newMapProvider(secrets),
+	}
+
+	// With no CA
+	_, err := signSSH(newTestContext(sshCAFlags(), "--principal", "node1", "host.pub"), &s, ssh.HostCert)
+	is.True(err != nil)
+
+	// With init
+	ca, err := initSSHCA(newTestContext(sshCAFlags()), &s)
+	is.NoErr(err)
+	is.Equal(ca.Key, "/glab/ssh/ca")
+	is.Equal(secrets["/glab/ssh/ca.pub"], ca.PublicKey)
+
+	_, err = initSSHCA(newTestContext(sshCAFlags()), &s)
+	is.Equal(err.Error(), "/glab/ssh/ca already exists; pass --force to replace it")
+
+	authority, _, _, _, err := ssh.ParseAuthorizedKey([]byte(ca.PublicKey))
+	is.NoErr(err)
+	pair, err := gen.SSHKey{Type: gen.SSHKeyED25519}.Generate()
+	is.NoErr(err)
+	is.NoErr(afero.WriteFile(s.fs, "key.pub", pair.PublicKey, 0644))
+
+	// With host certificate
+	result, err := signSSH(newTestContext(sshCAFlags(), "--principal", "node1.glab.lan", "--valid-from", "2030-01-01T00:00:00Z", "key.pub"), &s, ssh.HostCert)
+	is.NoErr(err)
+	cert := parseCertificate(t, result)
+	is.Equal(cert.CertType, uint32(ssh.HostCert))
+	is.Equal(cert.KeyId, "node1.glab.lan")
+	is.Equal(cert.ValidPrincipals, []string{"node1.glab.lan"})
+	is.Equal(cert.ValidAfter, uint64(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Unix()))
+	is.Equal(cert.ValidBefore, cert.ValidAfter+3600)
+	is.Equal(cert.SignatureKey.Marshal(), authority.Marshal())
+	is.Equal(len(cert.Extensions), 0)
+
+	// With user certificate
+	result, err = signSSH(newTestContext(sshCAFlags(), "--principal", "ops", "--principal", "core", "--key-id", "ops@glab", "--extension", "permit-agent-forwarding", "--critical-option", "source-address=10.0.0.0/8", "key.pub"), &s, ssh.UserCert)
+	is.NoErr(err)
+	cert = parseCertificate(t, result)
+	is.Equal(cert.KeyId, "ops@glab")
+	is.Equal(cert.ValidPrincipals, []string{"ops", "core"})
+	is.Equal(cert.Extensions, sshca.DefaultUserExtensions())
+	is.Equal(cert.CriticalOptions, map[string]string{"source-address": "10.0.0.0/8"})
+
+	checker := ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(authority.Marshal())
+		},
+	}
+	_, err = checker.Authenticate(testConnMetadata("core"), cert)
+	is.NoErr(err)
+
+	result, err = signSSH(newTestContext(sshCAFlags(), "--principal", "ops", "--no-default-extensions", "--extension", "permit-pty", "key.pub"), &s, ssh.UserCert)
+	is.NoErr(err)
+	is.Equal(parseCertificate(t, result).Extensions, map[string]string{"permit-pty": ""})
+
+	// With invalid input
+	_, err = signSSH(newTestContext(sshCAFlags(), "--principal", "ops", "--critical-option", "force-command", "key.pub"), &s, ssh.UserCert)
+	is.Equal(err.Error(), "invalid critical option: force-command")
+
+	_, err = signSSH(newTestContext(sshCAFlags(), "key.pub"), &s, ssh.HostCert)
+	is.Equal(err.Error(), "certificate must have at least one principal")
+
+	is.NoErr(afero.WriteFile(s.fs, "cert.pub", result.Raw(), 0644))
+	_, err = signSSH(newTestContext(sshCAFlags(), "--principal", "ops", "cert.pub"), &s, ssh.UserCert)
+	is.Equal(err.Error(), "cert.pub is already a certificate")
+
+	is.NoErr(afero.WriteFile(s.fs, "invalid.pub", []byte("invalid"), 0644))
+	_, err = signSSH(newTestContext(sshCAFlags(), "--principal", "ops", "invalid.pub"), &s, ssh.UserCert)
+	is.True(strings.HasPrefix(err.Error(), "error parsing public key"))
+}
+
+// testConnMetadata implements ssh.ConnMetadata for authenticating a user.
+type testConnMetadata string
+
+func (t testConnMetadata) User() string          { return string(t) }
+func (t testConnMetadata) SessionID() []byte     { return nil }
+func (t testConnMetadata) ClientVersion() []byte { return nil }
+func (t testConnMetadata) ServerVersion() []byte { return nil }
+func (t testConnMetadata) RemoteAddr() net.Addr  { return nil }
+func (t testConnMetadata) LocalAddr() net.Addr   { return nil }
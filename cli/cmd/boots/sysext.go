@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/lock"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
+	"github.com/HomeOperations/jmgilman/cli/sysext"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_sysext_arch            = "architecture"
+	flag_sysext_binary          = "binary"
+	flag_sysext_format          = "format"
+	flag_sysext_id              = "id"
+	flag_sysext_level           = "sysext-level"
+	flag_sysext_name            = "name"
+	flag_sysext_output          = "output"
+	flag_sysext_sign_key        = "sign-key"
+	flag_sysext_sign_passphrase = "sign-passphrase"
+	flag_sysext_unit            = "unit"
+)
+
+// sysextConfig holds dependencies utilized by the sysext subcommand.
+type sysextConfig struct {
+	fs     afero.Fs
+	packer sysext.Packer
+}
+
+// newSysextConfig returns a sysextConfig configured with default dependencies.
+func newSysextConfig(c *cli.Context) (sysextConfig, error) {
+	packer, err := sysext.NewPacker(c.String(flag_sysext_format))
+	if err != nil {
+		return sysextConfig{}, err
+	}
+
+	return sysextConfig{
+		fs:     afero.NewOsFs(),
+		packer: packer,
+	}, nil
+}
+
+// sysextCmd returns the sysext subcommand.
+func sysextCmd(a gcli.App) *cli.Command {
+	build := &cli.Command{
+		Name:  "build",
+		Usage: "Builds a systemd-sysext image from local binaries and unit files",
+		Action: func(c *cli.Context) error {
+			sc, err := newSysextConfig(c)
+			if err != nil {
+				return a.Exit(c, nil, err)
+			}
+
+			data, err := buildSysext(c, sc)
+			return a.Exit(c, data, err)
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     flag_sysext_name,
+				Aliases:  []string{"n"},
+				Usage:    "Name of the extension",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:    flag_sysext_binary,
+				Aliases: []string{"b"},
+				Usage:   "Binary to install under /usr/bin (may be repeated)",
+			},
+			&cli.StringSliceFlag{
+				Name:    flag_sysext_unit,
+				Aliases: []string{"u"},
+				Usage:   "Unit file to install under /usr/lib/systemd/system (may be repeated)",
+			},
+			&cli.StringFlag{
+				Name:  flag_sysext_id,
+				Usage: "ID of the target OS",
+				Value: "flatcar",
+			},
+			&cli.StringFlag{
+				Name:  flag_sysext_level,
+				Usage: "SYSEXT_LEVEL of the target OS",
+				Value: "1.0",
+			},
+			&cli.StringFlag{
+				Name:    flag_sysext_arch,
+				Aliases: []string{"a"},
+				Usage:   "Target architecture (i.e. x86-64, arm64)",
+			},
+			&cli.StringFlag{
+				Name:  flag_sysext_format,
+				Usage: "Image format (squashfs or ext4)",
+				Value: "squashfs",
+			},
+			&cli.StringFlag{
+				Name:        flag_sysext_output,
+				Aliases:     []string{"o"},
+				Usage:       "Output filename",
+				DefaultText: "extension name with a .raw suffix",
+			},
+			&cli.StringFlag{
+				Name:  flag_sysext_sign_key,
+				Usage: "Path to an armored PGP private key used to sign the image",
+			},
+			&cli.StringFlag{
+				Name:    flag_sysext_sign_passphrase,
+				Usage:   "Passphrase for the PGP private key",
+				EnvVars: []string{"BOOTS_SIGN_PASSPHRASE"},
+			},
+		},
+	}
+
+	return &cli.Command{
+		Name:        "sysext",
+		Usage:       "Provides operations for working with systemd-sysext images",
+		Subcommands: []*cli.Command{build},
+	}
+}
+
+// buildSysextResult is the result from calling buildSysext().
+type buildSysextResult struct {
+	Path      string            `json:"path"`
+	Size      int64             `json:"size"`
+	Digests   map[string]string `json:"digests"`
+	Signature string            `json:"signature,omitempty"`
+	Signer    *gcli.Signer      `json:"signer,omitempty"`
+}
+
+// buildSysext stages the given binaries and unit files, packs them into a
+// systemd-sysext image, and optionally signs the resulting image.
+func buildSysext(c *cli.Context, sc sysextConfig) (buildSysextResult, error) {
+	image := sysext.Image{
+		Name:     c.String(flag_sysext_name),
+		ID:       c.String(flag_sysext_id),
+		Level:    c.String(flag_sysext_level),
+		Arch:     c.String(flag_sysext_arch),
+		Binaries: c.StringSlice(flag_sysext_binary),
+		Units:    c.StringSlice(flag_sysext_unit),
+	}
+
+	output_file := image.Name + ".raw"
+	if c.IsSet(flag_sysext_output) {
+		output_file = c.String(flag_sysext_output)
+	}
+
+	dir, err := afero.TempDir(sc.fs, "", "sysext-")
+	if err != nil {
+		return buildSysextResult{}, err
+	}
+	defer sc.fs.RemoveAll(dir)
+
+	if err := sysext.Stage(sc.fs, dir, image); err != nil {
+		return buildSysextResult{}, err
+	}
+
+	log.Infof("Packing %s into %s", dir, output_file)
+	if err := sc.packer.Pack(dir, output_file); err != nil {
+		return buildSysextResult{}, err
+	}
+
+	out, err := sc.fs.Open(output_file)
+	if err != nil {
+		return buildSysextResult{}, err
+	}
+	defer out.Close()
+
+	digester := lock.NewDigester()
+	size, err := io.Copy(digester, out)
+	if err != nil {
+		return buildSysextResult{}, err
+	}
+
+	result := buildSysextResult{
+		Path:    output_file,
+		Size:    size,
+		Digests: digester.Digests(),
+	}
+
+	if !c.IsSet(flag_sysext_sign_key) {
+		return result, nil
+	}
+
+	signer, err := signSysext(c, sc, out)
+	if err != nil {
+		return buildSysextResult{}, err
+	}
+
+	result.Signature = output_file + ".sig"
+	result.Signer = &signer
+	return result, nil
+}
+
+// signSysext writes a detached PGP signature of the given image next to the
+// output file.
+func signSysext(c *cli.Context, sc sysextConfig, image afero.File) (gcli.Signer, error) {
+	if _, err := image.Seek(0, io.SeekStart); err != nil {
+		return gcli.Signer{}, err
+	}
+
+	key, err := sc.fs.Open(c.String(flag_sysext_sign_key))
+	if err != nil {
+		return gcli.Signer{}, err
+	}
+	defer key.Close()
+
+	sig_file := image.Name() + ".sig"
+	sig, err := sc.fs.Create(sig_file)
+	if err != nil {
+		return gcli.Signer{}, err
+	}
+	defer sig.Close()
+
+	signer, err := pgp.Sign(key, c.String(flag_sysext_sign_passphrase), image, sig)
+	if err != nil {
+		sig.Close()
+		sc.fs.Remove(sig_file)
+		return gcli.Signer{}, fmt.Errorf("error signing image: %s", err)
+	}
+
+	return signer, nil
+}
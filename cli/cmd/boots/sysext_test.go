@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/HomeOperations/jmgilman/cli/mocks"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestBuildSysext(t *testing.T) {
+	is := is.New(t)
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String(flag_sysext_name, "consul", "")
+	flagSet.String(flag_sysext_id, "flatcar", "")
+	flagSet.String(flag_sysext_level, "1.0", "")
+	flagSet.String(flag_sysext_arch, "", "")
+	flagSet.String(flag_sysext_output, "", "")
+	flagSet.String(flag_sysext_sign_key, "", "")
+	flagSet.String(flag_sysext_sign_passphrase, "", "")
+	is.NoErr((&cli.StringSliceFlag{Name: flag_sysext_binary}).Apply(flagSet))
+	is.NoErr((&cli.StringSliceFlag{Name: flag_sysext_unit}).Apply(flagSet))
+	_ = flagSet.Parse([]string{
+		fmt.Sprintf("--%s", flag_sysext_binary), "bin/consul",
+		fmt.Sprintf("--%s", flag_sysext_unit), "consul.service",
+	})
+	ctx := cli.NewContext(&cli.App{}, flagSet, nil)
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "bin/consul", []byte("binary"), 0755)
+	afero.WriteFile(fs, "consul.service", []byte("unit"), 0644)
+
+	// With no error
+	var got_release string
+	var got_binary string
+	cfg := sysextConfig{
+		fs: fs,
+		packer: &mocks.MockPacker{
+			FnPack: func(dir string, output string) error {
+				data, _ := afero.ReadFile(fs, dir+"/usr/lib/extension-release.d/extension-release.consul")
+				got_release = string(data)
+				data, _ = afero.ReadFile(fs, dir+"/usr/bin/consul")
+				got_binary = string(data)
+				return afero.WriteFile(fs, output, []byte("image"), 0644)
+			},
+		},
+	}
+
+	result, err := buildSysext(ctx, cfg)
+	is.NoErr(err)
+	is.Equal(got_release, "ID=flatcar\nSYSEXT_LEVEL=1.0\n")
+	is.Equal(got_binary, "binary")
+	is.Equal(result.Path, "consul.raw")
+	is.Equal(result.Size, int64(len("image")))
+	is.Equal(result.Digests["sha256"], "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d")
+	is.Equal(result.Signature, "")
+
+	// With signing key
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	is.NoErr(err)
+
+	key := new(bytes.Buffer)
+	w, err := armor.Encode(key, openpgp.PrivateKeyType, nil)
+	is.NoErr(err)
+	is.NoErr(entity.SerializePrivate(w, nil))
+	is.NoErr(w.Close())
+	afero.WriteFile(fs, "key.asc", key.Bytes(), 0600)
+
+	ctx.Set(flag_sysext_sign_key, "key.asc")
+	ctx.Set(flag_sysext_output, "out/consul.raw")
+	fs.MkdirAll("out", 0755)
+
+	result, err = buildSysext(ctx, cfg)
+	is.NoErr(err)
+	is.Equal(result.Path, "out/consul.raw")
+	is.Equal(result.Signature, "out/consul.raw.sig")
+	is.Equal(*result.Signer, pgp.NewSigner(entity))
+
+	sig, err := fs.Open("out/consul.raw.sig")
+	is.NoErr(err)
+	signer, err := openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, strings.NewReader("image"), sig)
+	is.NoErr(err)
+	is.Equal(signer, entity)
+
+	// With invalid name
+	ctx.Set(flag_sysext_name, "../consul")
+	_, err = buildSysext(ctx, cfg)
+	is.Equal(err.Error(), `invalid extension name: "../consul"`)
+}
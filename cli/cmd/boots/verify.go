@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/sigstore"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_verify = "verify"
+)
+
+// verifyFlags returns the flags used by subcommands which validate fetched
+// artifacts.
+func verifyFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_verify,
+			Value: "pgp",
+			Usage: "signature verification strategy to use (pgp or sigstore)",
+		},
+	}, sigstore.Flags()...)
+}
+
+// newVerifier returns the verifier selected by the verify flag. A nil verifier
+// is returned for PGP so that providers fall back to their default key.
+func newVerifier(c *cli.Context) (gcli.Verifier, error) {
+	switch c.String(flag_verify) {
+	case "", "pgp":
+		return nil, nil
+	case "sigstore":
+		config, err := sigstore.NewVerifierConfig(c)
+		if err != nil {
+			return nil, err
+		}
+
+		return sigstore.NewVerifier(config)
+	default:
+		return nil, fmt.Errorf("invalid verification strategy: %s", c.String(flag_verify))
+	}
+}
@@ -0,0 +1,456 @@
+package consul
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_address     = "consul-address"
+	flag_ca_cert     = "consul-ca-cert"
+	flag_cas         = "consul-cas"
+	flag_cas_index   = "consul-cas-index"
+	flag_client_cert = "consul-client-cert"
+	flag_client_key  = "consul-client-key"
+	flag_datacenter  = "consul-datacenter"
+	flag_prefix      = "consul-prefix"
+	flag_token       = "consul-token"
+)
+
+// ErrConcurrentModification is returned by Set when CAS is enabled and the key
+// was modified since it was last read.
+var ErrConcurrentModification = errors.New("secret was modified concurrently")
+
+// httpClient is an interface for sending HTTP requests.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// SecretProvider implements bootstrap.SecretProvider using the Consul KV store
+// as the backend. When CAS is enabled, the modify index of each key is cached
+// when read and Set only succeeds if the key hasn't changed since. A single CLI
+// invocation rarely reads a key before setting it, in which case the index is
+// fetched immediately before the write and only that short window is
+// protected. Callers which need to guard a longer read-modify-write cycle can
+// supply the modify index they read earlier as an explicit CAS index.
+type SecretProvider struct {
+	address    string
+	cas        bool
+	casIndex   *uint64
+	client     httpClient
+	datacenter string
+	indexes    map[string]uint64
+	prefix     string
+	token      string
+}
+
+// kvPair is an entry returned by the Consul KV API.
+type kvPair struct {
+	Key         string `json:"Key"`
+	Value       []byte `json:"Value"`
+	ModifyIndex uint64 `json:"ModifyIndex"`
+}
+
+// Delete deletes the secret with the given key.
+func (s *SecretProvider) Delete(key string) error {
+	log.Infof("Sending delete request for key: %s", key)
+
+	// Consul doesn't report deleting a missing key as an error
+	if _, err := s.get(key); err != nil {
+		return err
+	}
+
+	resp, err := s.request(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	delete(s.indexes, key)
+	return nil
+}
+
+// Get returns the value of the secret with the given key.
+func (s *SecretProvider) Get(key string) (string, error) {
+	log.Infof("Sending get request for key: %s", key)
+
+	pair, err := s.get(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pair.Value), nil
+}
+
+// List returns metadata for the keys under the given path prefix. The version
+// of each key is its modify index. Consul stores keys without a leading slash,
+// so listed keys are given one if the prefix has one in order that they can be
+// passed back to Get as they were given to Set.
+func (s *SecretProvider) List(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+	log.Infof("Sending list request for prefix: %s", prefix)
+
+	var lead string
+	if strings.HasPrefix(prefix, "/") {
+		lead = "/"
+	}
+	match := strings.TrimPrefix(prefix, "/")
+
+	// Querying with a trailing slash excludes siblings which merely share the
+	// prefix, such as app2/ when listing app/
+	path := prefix
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	resp, err := s.request(http.MethodGet, path, url.Values{"recurse": []string{""}}, nil)
+	if err == gcli.ErrSecretNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var pairs []kvPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, fmt.Errorf("error parsing Consul response: %s", err)
+	}
+
+	var secrets []gcli.SecretMetadata
+	root := s.keyPath("/")
+	for _, pair := range pairs {
+		if !strings.HasPrefix(pair.Key, root) {
+			continue
+		}
+
+		key := strings.TrimPrefix(pair.Key, root)
+		if strings.HasSuffix(key, "/") || !gcli.MatchSecretPath(key, match, recursive) {
+			continue
+		}
+
+		secrets = append(secrets, gcli.SecretMetadata{
+			Key:     lead + key,
+			Version: int64(pair.ModifyIndex),
+		})
+	}
+
+	return secrets, nil
+}
+
+// Set sets the value of the secret with the given key. Overwrites any previous
+// value that existed with the key. If CAS is enabled, ErrConcurrentModification
+// is returned when the key has changed since it was last read, or since the
+// explicit CAS index if one was given.
+func (s *SecretProvider) Set(key string, value string) error {
+	log.Infof("Sending set request for key: %s", key)
+
+	query := url.Values{}
+	if s.casIndex != nil {
+		log.Debugf("Using explicit CAS index %d for key: %s", *s.casIndex, key)
+		query.Set("cas", strconv.FormatUint(*s.casIndex, 10))
+	} else if s.cas {
+		index, ok := s.indexes[key]
+		if !ok {
+			// Without a prior read, compare against the current index
+			pair, err := s.get(key)
+			if err != nil && err != gcli.ErrSecretNotFound {
+				return err
+			}
+			index = pair.ModifyIndex
+		}
+
+		log.Debugf("Using CAS index %d for key: %s", index, key)
+		query.Set("cas", strconv.FormatUint(index, 10))
+	}
+
+	ok, err := s.put(key, value, query)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrConcurrentModification
+	}
+
+	return nil
+}
+
+// Create sets the value of the secret with the given key only if it doesn't
+// already exist, using a CAS index of zero.
+func (s *SecretProvider) Create(key string, value string) error {
+	log.Infof("Sending create request for key: %s", key)
+
+	ok, err := s.put(key, value, url.Values{"cas": []string{"0"}})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gcli.ErrSecretExists
+	}
+
+	return nil
+}
+
+// put writes the value of the given key and returns whether Consul accepted
+// the write.
+func (s *SecretProvider) put(key string, value string, query url.Values) (bool, error) {
+	resp, err := s.request(http.MethodPut, key, query, []byte(value))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var ok bool
+	if err := json.NewDecoder(resp.Body).Decode(&ok); err != nil {
+		return false, fmt.Errorf("error parsing Consul response: %s", err)
+	}
+
+	// The new index is unknown until the key is read again
+	if ok {
+		delete(s.indexes, key)
+	}
+
+	return ok, nil
+}
+
+// get fetches the KV pair for the given key and caches its modify index.
+func (s *SecretProvider) get(key string) (kvPair, error) {
+	resp, err := s.request(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return kvPair{}, err
+	}
+	defer resp.Body.Close()
+
+	var pairs []kvPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return kvPair{}, fmt.Errorf("error parsing Consul response: %s", err)
+	}
+	if len(pairs) == 0 {
+		return kvPair{}, gcli.ErrSecretNotFound
+	}
+
+	s.indexes[key] = pairs[0].ModifyIndex
+	return pairs[0], nil
+}
+
+// request sends a request for the given key to the KV API. A 404 response is
+// returned as ErrSecretNotFound. The caller must close the response body.
+func (s *SecretProvider) request(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if s.datacenter != "" {
+		query.Set("dc", s.datacenter)
+	}
+
+	u := fmt.Sprintf("%s/v1/kv/%s", strings.TrimRight(s.address, "/"), s.keyPath(key))
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	log.Debugf("Sending %s request to %s", method, u)
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying Consul: %s", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, gcli.ErrSecretNotFound
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error querying Consul: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// keyPath returns the full KV path for the given key. A trailing slash is kept
+// so that prefix queries stop at a path segment boundary.
+func (s *SecretProvider) keyPath(key string) string {
+	p := strings.TrimPrefix(path.Join(s.prefix, key), "/")
+	if p != "" && strings.HasSuffix(key, "/") {
+		p += "/"
+	}
+
+	return p
+}
+
+// NewSecretProvider creates a new instance of SecretProvider using the given
+// configuration.
+func NewSecretProvider(config SecretProviderConfig) SecretProvider {
+	client := http.DefaultClient
+	if config.tls != nil {
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: config.tls,
+			},
+		}
+	}
+
+	return SecretProvider{
+		address:    config.address,
+		cas:        config.cas,
+		casIndex:   config.casIndex,
+		client:     client,
+		datacenter: config.datacenter,
+		indexes:    make(map[string]uint64),
+		prefix:     config.prefix,
+		token:      config.token,
+	}
+}
+
+// SecretProviderConfig provides the configuration details needed for
+// instantiating a new SecretProvider.
+type SecretProviderConfig struct {
+	address    string
+	cas        bool
+	casIndex   *uint64
+	datacenter string
+	prefix     string
+	tls        *tls.Config
+	token      string
+}
+
+// Flags returns the CLI flags that can be used to configure the Consul secret
+// provider.
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    flag_address,
+			Usage:   "Consul server address",
+			Value:   "http://127.0.0.1:8500",
+			EnvVars: []string{"CONSUL_HTTP_ADDR"},
+		},
+		&cli.StringFlag{
+			Name:    flag_token,
+			Usage:   "Consul ACL token",
+			EnvVars: []string{"CONSUL_HTTP_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:  flag_datacenter,
+			Usage: "Consul datacenter (defaults to the agent's datacenter)",
+		},
+		&cli.StringFlag{
+			Name:  flag_prefix,
+			Usage: "Prefix prepended to all Consul keys",
+		},
+		&cli.StringFlag{
+			Name:    flag_ca_cert,
+			Usage:   "Path to a CA certificate for verifying the Consul server",
+			EnvVars: []string{"CONSUL_CACERT"},
+		},
+		&cli.StringFlag{
+			Name:    flag_client_cert,
+			Usage:   "Path to a client certificate for authenticating with Consul",
+			EnvVars: []string{"CONSUL_CLIENT_CERT"},
+		},
+		&cli.StringFlag{
+			Name:    flag_client_key,
+			Usage:   "Path to a client key for authenticating with Consul",
+			EnvVars: []string{"CONSUL_CLIENT_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:  flag_cas,
+			Usage: "Fail when setting a key which was modified concurrently",
+		},
+		&cli.Uint64Flag{
+			Name:  flag_cas_index,
+			Usage: "Only set the key if its modify index still matches this value (0 to only create it)",
+		},
+	}
+}
+
+// NewSecretProviderConfig creates a new SecretProviderConfig by parsing CLI
+// flags contained within the passed cli.Context.
+func NewSecretProviderConfig(c *cli.Context) (SecretProviderConfig, error) {
+	config := SecretProviderConfig{
+		address:    c.String(flag_address),
+		cas:        c.Bool(flag_cas),
+		datacenter: c.String(flag_datacenter),
+		prefix:     c.String(flag_prefix),
+		token:      c.String(flag_token),
+	}
+	if config.address == "" {
+		return SecretProviderConfig{}, fmt.Errorf("must supply a Consul address")
+	}
+
+	if c.IsSet(flag_cas_index) {
+		index := c.Uint64(flag_cas_index)
+		config.casIndex = &index
+	}
+
+	if c.String(flag_ca_cert) != "" || c.String(flag_client_cert) != "" || c.String(flag_client_key) != "" {
+		tlsConfig, err := newTLSConfig(c.String(flag_ca_cert), c.String(flag_client_cert), c.String(flag_client_key))
+		if err != nil {
+			return SecretProviderConfig{}, err
+		}
+		config.tls = tlsConfig
+	}
+
+	log.Infof("Using Consul at %s", config.address)
+	return config, nil
+}
+
+// newTLSConfig returns a tls.Config which trusts the given CA certificate and
+// presents the given client certificate.
+func newTLSConfig(caCert string, clientCert string, clientKey string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caCert != "" {
+		data, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		config.RootCAs = pool
+	}
+
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("must supply both client certificate and key")
+		}
+
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
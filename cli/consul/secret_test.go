@@ -0,0 +1,301 @@
+package consul
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+)
+
+// devConsul is a minimal stand-in for the Consul KV HTTP API.
+type devConsul struct {
+	mu          sync.Mutex
+	datacenters []string
+	index       uint64
+	pairs       map[string]kvPair
+	token       string
+}
+
+func (d *devConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if r.Header.Get("X-Consul-Token") != d.token {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Permission denied")
+		return
+	}
+
+	d.datacenters = append(d.datacenters, r.URL.Query().Get("dc"))
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		if _, ok := r.URL.Query()["recurse"]; ok {
+			var pairs []kvPair
+			for k, pair := range d.pairs {
+				if strings.HasPrefix(k, key) {
+					pairs = append(pairs, pair)
+				}
+			}
+			if len(pairs) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+			json.NewEncoder(w).Encode(pairs)
+			return
+		}
+
+		pair, ok := d.pairs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]kvPair{pair})
+	case http.MethodPut:
+		if cas := r.URL.Query().Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if index != d.pairs[key].ModifyIndex {
+				fmt.Fprint(w, "false")
+				return
+			}
+		}
+		value, _ := io.ReadAll(r.Body)
+		d.index++
+		d.pairs[key] = kvPair{Key: key, Value: value, ModifyIndex: d.index}
+		fmt.Fprint(w, "true")
+	case http.MethodDelete:
+		delete(d.pairs, key)
+		fmt.Fprint(w, "true")
+	}
+}
+
+func newTestProvider(address string) SecretProvider {
+	return SecretProvider{
+		address: address,
+		client:  http.DefaultClient,
+		indexes: make(map[string]uint64),
+		prefix:  "glab/bootstrap",
+		token:   "token",
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	is := is.New(t)
+	server := &devConsul{pairs: make(map[string]kvPair), token: "token"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	provider := newTestProvider(ts.URL)
+	provider.datacenter = "dc1"
+
+	// With missing key
+	_, err := provider.Get("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	err = provider.Delete("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With set key
+	is.NoErr(provider.Set("test", "value"))
+	is.Equal(string(server.pairs["glab/bootstrap/test"].Value), "value")
+	is.Equal(server.datacenters[len(server.datacenters)-1], "dc1")
+
+	value, err := provider.Get("test")
+	is.NoErr(err)
+	is.Equal(value, "value")
+
+	// With created key
+	is.NoErr(provider.Create("generated", "generated"))
+	err = provider.Create("generated", "other")
+	is.True(errors.Is(err, gcli.ErrSecretExists))
+	is.Equal(string(server.pairs["glab/bootstrap/generated"].Value), "generated")
+
+	// With listed keys
+	is.NoErr(provider.Set("nested/test", "value"))
+	server.pairs["glab/bootstrapped/other"] = kvPair{Key: "glab/bootstrapped/other"}
+	secrets, err := provider.List("", false)
+	is.NoErr(err)
+	is.Equal(secrets, []gcli.SecretMetadata{
+		{Key: "generated", Version: int64(server.pairs["glab/bootstrap/generated"].ModifyIndex)},
+		{Key: "test", Version: int64(server.pairs["glab/bootstrap/test"].ModifyIndex)},
+	})
+
+	secrets, err = provider.List("", true)
+	is.NoErr(err)
+	is.Equal(len(secrets), 3)
+	is.Equal(secrets[1].Key, "nested/test")
+
+	server.pairs["glab/bootstrap/nestedother"] = kvPair{Key: "glab/bootstrap/nestedother"}
+	secrets, err = provider.List("nested", true)
+	is.NoErr(err)
+	is.Equal(len(secrets), 1)
+	is.Equal(secrets[0].Key, "nested/test")
+
+	// With slash prefixed keys
+	is.NoErr(provider.Set("/glab/x", "value"))
+	is.Equal(string(server.pairs["glab/bootstrap/glab/x"].Value), "value")
+	secrets, err = provider.List("/glab", false)
+	is.NoErr(err)
+	is.Equal(len(secrets), 1)
+	is.Equal(secrets[0].Key, "/glab/x")
+
+	value, err = provider.Get(secrets[0].Key)
+	is.NoErr(err)
+	is.Equal(value, "value")
+
+	secrets, err = provider.List("/", true)
+	is.NoErr(err)
+	is.Equal(len(secrets), 5)
+	is.Equal(secrets[0].Key, "/generated")
+
+	secrets, err = provider.List("missing", true)
+	is.NoErr(err)
+	is.Equal(len(secrets), 0)
+
+	// With deleted key
+	is.NoErr(provider.Delete("test"))
+	_, ok := server.pairs["glab/bootstrap/test"]
+	is.True(!ok)
+
+	// With invalid token
+	provider.token = "invalid"
+	_, err = provider.Get("generated")
+	is.Equal(err.Error(), "error querying Consul: 403: Permission denied")
+}
+
+func TestSetCAS(t *testing.T) {
+	is := is.New(t)
+	server := &devConsul{pairs: make(map[string]kvPair), token: "token"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	provider := newTestProvider(ts.URL)
+	provider.cas = true
+
+	// With new key
+	is.NoErr(provider.Set("test", "value"))
+
+	// With unmodified key
+	_, err := provider.Get("test")
+	is.NoErr(err)
+	is.NoErr(provider.Set("test", "updated"))
+
+	// With concurrently modified key
+	_, err = provider.Get("test")
+	is.NoErr(err)
+
+	other := newTestProvider(ts.URL)
+	is.NoErr(other.Set("test", "other"))
+
+	err = provider.Set("test", "stale")
+	is.True(errors.Is(err, ErrConcurrentModification))
+	is.Equal(string(server.pairs["glab/bootstrap/test"].Value), "other")
+
+	// With explicit CAS index from an earlier read
+	index := server.pairs["glab/bootstrap/test"].ModifyIndex
+	explicit := newTestProvider(ts.URL)
+	explicit.casIndex = &index
+	is.NoErr(other.Set("test", "other"))
+
+	err = explicit.Set("test", "stale")
+	is.True(errors.Is(err, ErrConcurrentModification))
+
+	index = server.pairs["glab/bootstrap/test"].ModifyIndex
+	is.NoErr(explicit.Set("test", "current"))
+	is.Equal(string(server.pairs["glab/bootstrap/test"].Value), "current")
+
+	// With CAS disabled
+	provider.cas = false
+	is.NoErr(provider.Set("test", "forced"))
+	is.Equal(string(server.pairs["glab/bootstrap/test"].Value), "forced")
+}
+
+func TestNewSecretProviderConfig(t *testing.T) {
+	is := is.New(t)
+	for _, env := range []string{"CONSUL_HTTP_ADDR", "CONSUL_HTTP_TOKEN", "CONSUL_CACERT", "CONSUL_CLIENT_CERT", "CONSUL_CLIENT_KEY"} {
+		t.Setenv(env, "") // Restores the environment after the test
+		os.Unsetenv(env)
+	}
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", 0)
+		for _, f := range Flags() {
+			is.NoErr(f.Apply(set))
+		}
+		is.NoErr(set.Parse(args))
+		return cli.NewContext(&cli.App{}, set, nil)
+	}
+
+	// With defaults
+	config, err := NewSecretProviderConfig(newContext())
+	is.NoErr(err)
+	is.Equal(config.address, "http://127.0.0.1:8500")
+	is.True(config.tls == nil)
+
+	// With options
+	config, err = NewSecretProviderConfig(newContext(
+		"--consul-token", "token",
+		"--consul-datacenter", "dc1",
+		"--consul-prefix", "glab",
+		"--consul-cas",
+	))
+	is.NoErr(err)
+	is.Equal(config.token, "token")
+	is.Equal(config.datacenter, "dc1")
+	is.Equal(config.prefix, "glab")
+	is.True(config.cas)
+	is.True(config.casIndex == nil)
+
+	// With explicit CAS index
+	config, err = NewSecretProviderConfig(newContext("--consul-cas-index", "0"))
+	is.NoErr(err)
+	is.Equal(*config.casIndex, uint64(0))
+
+	// With CA certificate
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	is.NoErr(err)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	is.NoErr(os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+
+	config, err = NewSecretProviderConfig(newContext("--consul-ca-cert", ca))
+	is.NoErr(err)
+	is.True(config.tls.RootCAs != nil)
+
+	// With client certificate and no key
+	_, err = NewSecretProviderConfig(newContext("--consul-client-cert", ca))
+	is.Equal(err.Error(), "must supply both client certificate and key")
+}
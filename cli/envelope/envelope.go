@@ -0,0 +1,152 @@
+// Package envelope provides symmetric encryption of small payloads using NaCl
+// secretbox with a key derived from a passphrase or a keyfile. Sealed payloads
+// are prefixed with a versioned header so that the format can be migrated in
+// the future.
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// Version is the current version of the envelope format.
+	Version = 1
+
+	kdfScrypt  = 1
+	kdfKeyfile = 2
+
+	keySize   = 32
+	nonceSize = 24
+	saltSize  = 16
+
+	// Recommended scrypt parameters for interactive logins as of 2017
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+)
+
+// magic identifies sealed envelopes.
+var magic = []byte("BOOTSENC")
+
+var (
+	ErrDecrypt            = errors.New("unable to decrypt: wrong key or corrupted data")
+	ErrInvalidFormat      = errors.New("data is not a sealed envelope")
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+)
+
+// Secret is the secret material which keys are derived from.
+type Secret struct {
+	kdf   byte
+	value []byte
+}
+
+// Passphrase returns a Secret which derives keys from the given passphrase
+// using scrypt.
+func Passphrase(passphrase string) Secret {
+	return Secret{kdf: kdfScrypt, value: []byte(passphrase)}
+}
+
+// Keyfile returns a Secret which derives keys from the contents of a keyfile.
+// Keyfiles are expected to contain high entropy data and are only hashed.
+func Keyfile(data []byte) Secret {
+	return Secret{kdf: kdfKeyfile, value: data}
+}
+
+// key derives the encryption key for the given salt.
+func (s Secret) key(kdf byte, salt []byte) (*[keySize]byte, error) {
+	if kdf != s.kdf {
+		return nil, ErrDecrypt
+	}
+
+	var key [keySize]byte
+	switch kdf {
+	case kdfScrypt:
+		derived, err := scrypt.Key(s.value, salt, scryptN, scryptR, scryptP, keySize)
+		if err != nil {
+			return nil, err
+		}
+		copy(key[:], derived)
+	case kdfKeyfile:
+		key = sha256.Sum256(append(append([]byte{}, salt...), s.value...))
+	default:
+		return nil, fmt.Errorf("unknown key derivation function: %d", kdf)
+	}
+
+	return &key, nil
+}
+
+// Seal encrypts the given plaintext using a key derived from the given secret.
+func Seal(secret Secret, plaintext []byte) ([]byte, error) {
+	if len(secret.value) == 0 {
+		return nil, errors.New("must supply a passphrase or keyfile")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	key, err := secret.key(secret.kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(magic[:len(magic):len(magic)])
+	out.WriteByte(Version)
+	out.WriteByte(secret.kdf)
+	out.Write(salt)
+	out.Write(nonce[:])
+
+	return secretbox.Seal(out.Bytes(), plaintext, &nonce, key), nil
+}
+
+// Open decrypts the given envelope using a key derived from the given secret.
+func Open(secret Secret, data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return nil, ErrInvalidFormat
+	}
+
+	header := len(magic) + 2
+	if data[len(magic)] != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[len(magic)])
+	}
+	if len(data) < header+saltSize+nonceSize+secretbox.Overhead {
+		return nil, ErrInvalidFormat
+	}
+
+	kdf := data[len(magic)+1]
+	salt := data[header : header+saltSize]
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], data[header+saltSize:header+saltSize+nonceSize])
+
+	key, err := secret.key(kdf, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, ok := secretbox.Open(nil, data[header+saltSize+nonceSize:], &nonce, key)
+	if !ok {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
+
+// IsSealed returns whether the given data begins with an envelope header.
+func IsSealed(data []byte) bool {
+	return len(data) > len(magic)+1 && bytes.Equal(data[:len(magic)], magic)
+}
@@ -0,0 +1,57 @@
+package envelope
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSealOpen(t *testing.T) {
+	is := is.New(t)
+	expected := []byte("test")
+
+	// With passphrase
+	sealed, err := Seal(Passphrase("passphrase"), expected)
+	is.NoErr(err)
+	is.True(IsSealed(sealed))
+	is.Equal(int(sealed[len(magic)]), Version)
+
+	got, err := Open(Passphrase("passphrase"), sealed)
+	is.NoErr(err)
+	is.Equal(got, expected)
+
+	// With wrong passphrase
+	_, err = Open(Passphrase("wrong"), sealed)
+	is.True(errors.Is(err, ErrDecrypt))
+
+	// With keyfile
+	sealed, err = Seal(Keyfile([]byte("keyfile")), expected)
+	is.NoErr(err)
+
+	got, err = Open(Keyfile([]byte("keyfile")), sealed)
+	is.NoErr(err)
+	is.Equal(got, expected)
+
+	// With mismatched secret type
+	_, err = Open(Passphrase("keyfile"), sealed)
+	is.True(errors.Is(err, ErrDecrypt))
+
+	// With tampered data
+	sealed[len(sealed)-1] ^= 0xFF
+	_, err = Open(Keyfile([]byte("keyfile")), sealed)
+	is.True(errors.Is(err, ErrDecrypt))
+
+	// With unsupported version
+	sealed[len(magic)] = Version + 1
+	_, err = Open(Keyfile([]byte("keyfile")), sealed)
+	is.True(errors.Is(err, ErrUnsupportedVersion))
+
+	// With plaintext
+	_, err = Open(Keyfile([]byte("keyfile")), expected)
+	is.True(errors.Is(err, ErrInvalidFormat))
+
+	// With no secret
+	_, err = Seal(Passphrase(""), expected)
+	is.Equal(err.Error(), "must supply a passphrase or keyfile")
+}
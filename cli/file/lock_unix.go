@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock acquires an exclusive advisory lock on the given lock file, blocking
+// until it becomes available. The returned function releases the lock.
+func lock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
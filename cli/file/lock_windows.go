@@ -0,0 +1,35 @@
+//go:build windows
+// +build windows
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	lockRetries = 100
+	lockDelay   = 100 * time.Millisecond
+)
+
+// lock acquires an exclusive lock by creating the given lock file, retrying
+// until it no longer exists. The returned function releases the lock.
+func lock(path string) (func(), error) {
+	for i := 0; i < lockRetries; i++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		time.Sleep(lockDelay)
+	}
+
+	return nil, fmt.Errorf("timed out waiting for lock: %s", path)
+}
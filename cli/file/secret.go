@@ -0,0 +1,287 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/envelope"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_keyfile    = "file-keyfile"
+	flag_passphrase = "file-passphrase"
+	flag_path       = "file-path"
+
+	// Filename is the default name of the encrypted secrets file.
+	Filename = "boots.secrets"
+)
+
+// SecretProvider implements bootstrap.SecretProvider using a single local file
+// as the backend. The file contains a JSON map of keys to values which is
+// sealed using the envelope package. Every operation holds an exclusive lock
+// on a sibling lock file and writes are performed atomically by renaming a
+// temporary file over the original.
+type SecretProvider struct {
+	fs     afero.Fs
+	path   string
+	secret envelope.Secret
+}
+
+// Delete deletes the secret with the given key.
+func (s *SecretProvider) Delete(key string) error {
+	log.Infof("Deleting key: %s", key)
+	return s.update(func(secrets map[string]string) error {
+		if _, ok := secrets[key]; !ok {
+			return gcli.ErrSecretNotFound
+		}
+
+		delete(secrets, key)
+		return nil
+	})
+}
+
+// Get returns the value of the secret with the given key.
+func (s *SecretProvider) Get(key string) (string, error) {
+	log.Infof("Getting key: %s", key)
+
+	var value string
+	err := s.view(func(secrets map[string]string) error {
+		var ok bool
+		if value, ok = secrets[key]; !ok {
+			return gcli.ErrSecretNotFound
+		}
+
+		return nil
+	})
+
+	return value, err
+}
+
+// List returns the keys under the given path prefix. The file backend doesn't
+// track any additional metadata.
+func (s *SecretProvider) List(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+	log.Infof("Listing keys under: %s", prefix)
+
+	var secrets []gcli.SecretMetadata
+	err := s.view(func(values map[string]string) error {
+		for key := range values {
+			if gcli.MatchSecretPath(key, prefix, recursive) {
+				secrets = append(secrets, gcli.SecretMetadata{Key: key})
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Key < secrets[j].Key })
+	return secrets, err
+}
+
+// Create sets the value of the secret with the given key only if it doesn't
+// already exist.
+func (s *SecretProvider) Create(key string, value string) error {
+	log.Infof("Creating key: %s", key)
+	return s.update(func(secrets map[string]string) error {
+		if _, ok := secrets[key]; ok {
+			return gcli.ErrSecretExists
+		}
+
+		secrets[key] = value
+		return nil
+	})
+}
+
+// Set sets the value of the secret with the given key. Overwrites any previous
+// value that existed with the key.
+func (s *SecretProvider) Set(key string, value string) error {
+	log.Infof("Setting key: %s", key)
+	return s.update(func(secrets map[string]string) error {
+		secrets[key] = value
+		return nil
+	})
+}
+
+// view calls fn with the current contents of the secrets file while holding
+// the lock.
+func (s *SecretProvider) view(fn func(secrets map[string]string) error) error {
+	unlock, err := lock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("error locking secrets file: %s", err)
+	}
+	defer unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	return fn(secrets)
+}
+
+// update calls fn with the current contents of the secrets file while holding
+// the lock and then saves any changes made by fn.
+func (s *SecretProvider) update(fn func(secrets map[string]string) error) error {
+	unlock, err := lock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("error locking secrets file: %s", err)
+	}
+	defer unlock()
+
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(secrets); err != nil {
+		return err
+	}
+
+	return s.save(secrets)
+}
+
+// load reads and decrypts the secrets file. A missing file is treated as
+// empty.
+func (s *SecretProvider) load() (map[string]string, error) {
+	secrets := make(map[string]string)
+
+	data, err := afero.ReadFile(s.fs, s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Debugf("Secrets file %s does not exist", s.path)
+		return secrets, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := envelope.Open(s.secret, data)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secrets file: %w", err)
+	}
+
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("error parsing secrets file: %s", err)
+	}
+
+	return secrets, nil
+}
+
+// save encrypts and atomically writes the secrets file. The data is written to
+// a uniquely named temporary file and synced to disk before it replaces the
+// original, so a crash leaves either the old or the new file intact.
+func (s *SecretProvider) save(secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	data, err := envelope.Seal(s.secret, plaintext)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	tmp, err := afero.TempFile(s.fs, dir, "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := writeSynced(tmp, data); err != nil {
+		s.fs.Remove(tmp.Name())
+		return err
+	}
+
+	if err := s.fs.Rename(tmp.Name(), s.path); err != nil {
+		s.fs.Remove(tmp.Name())
+		return err
+	}
+
+	return syncDir(s.fs, dir)
+}
+
+// writeSynced writes data to the given file, flushes it to disk, and closes
+// it.
+func writeSynced(f afero.File, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// NewSecretProvider creates a new instance of SecretProvider using the given
+// configuration.
+func NewSecretProvider(config SecretProviderConfig) SecretProvider {
+	return SecretProvider{
+		fs:     afero.NewOsFs(),
+		path:   config.path,
+		secret: config.secret,
+	}
+}
+
+// SecretProviderConfig provides the configuration details needed for
+// instantiating a new SecretProvider.
+type SecretProviderConfig struct {
+	path   string
+	secret envelope.Secret
+}
+
+// Flags returns the CLI flags that can be used to configure the file secret
+// provider.
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_path,
+			Usage: "Path to the encrypted secrets file",
+			Value: Filename,
+		},
+		&cli.StringFlag{
+			Name:    flag_passphrase,
+			Usage:   "Passphrase used to encrypt the secrets file",
+			EnvVars: []string{"BOOTS_FILE_PASSPHRASE"},
+		},
+		&cli.StringFlag{
+			Name:  flag_keyfile,
+			Usage: "Path to a keyfile used to encrypt the secrets file",
+		},
+	}
+}
+
+// NewSecretProviderConfig creates a new SecretProviderConfig by parsing CLI
+// flags contained within the passed cli.Context.
+func NewSecretProviderConfig(c *cli.Context) (SecretProviderConfig, error) {
+	config := SecretProviderConfig{
+		path: c.String(flag_path),
+	}
+	if config.path == "" {
+		config.path = Filename
+	}
+
+	switch {
+	case c.String(flag_passphrase) != "" && c.String(flag_keyfile) != "":
+		return SecretProviderConfig{}, fmt.Errorf("must supply only one of a passphrase or keyfile")
+	case c.String(flag_passphrase) != "":
+		config.secret = envelope.Passphrase(c.String(flag_passphrase))
+	case c.String(flag_keyfile) != "":
+		data, err := os.ReadFile(c.String(flag_keyfile))
+		if err != nil {
+			return SecretProviderConfig{}, err
+		}
+		config.secret = envelope.Keyfile(data)
+	default:
+		return SecretProviderConfig{}, fmt.Errorf("must supply a passphrase or keyfile")
+	}
+
+	return config, nil
+}
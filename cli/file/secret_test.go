@@ -0,0 +1,176 @@
+package file
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/envelope"
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v2"
+)
+
+func newTestProvider(dir string, secret envelope.Secret) SecretProvider {
+	return SecretProvider{
+		fs:     afero.NewOsFs(),
+		path:   filepath.Join(dir, Filename),
+		secret: secret,
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	is := is.New(t)
+	provider := newTestProvider(t.TempDir(), envelope.Passphrase("test"))
+
+	// With missing file
+	_, err := provider.Get("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	err = provider.Delete("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With set key
+	is.NoErr(provider.Set("test", "value"))
+	value, err := provider.Get("test")
+	is.NoErr(err)
+	is.Equal(value, "value")
+
+	data, err := os.ReadFile(provider.path)
+	is.NoErr(err)
+	is.True(envelope.IsSealed(data))
+
+	tmps, err := filepath.Glob(filepath.Join(filepath.Dir(provider.path), "*.tmp"))
+	is.NoErr(err)
+	is.Equal(len(tmps), 0)
+
+	// With multiple keys
+	is.NoErr(provider.Set("generated", "generated"))
+	value, err = provider.Get("generated")
+	is.NoErr(err)
+	is.Equal(value, "generated")
+
+	// With created key
+	is.NoErr(provider.Create("created", "created"))
+	err = provider.Create("created", "other")
+	is.True(errors.Is(err, gcli.ErrSecretExists))
+	value, err = provider.Get("created")
+	is.NoErr(err)
+	is.Equal(value, "created")
+
+	// With listed keys
+	is.NoErr(provider.Set("glab/nested/test", "value"))
+	secrets, err := provider.List("", false)
+	is.NoErr(err)
+	is.Equal(secrets, []gcli.SecretMetadata{{Key: "created"}, {Key: "generated"}, {Key: "test"}})
+
+	secrets, err = provider.List("glab", true)
+	is.NoErr(err)
+	is.Equal(secrets, []gcli.SecretMetadata{{Key: "glab/nested/test"}})
+
+	// With deleted key
+	is.NoErr(provider.Delete("test"))
+	_, err = provider.Get("test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With wrong passphrase
+	provider.secret = envelope.Passphrase("wrong")
+	_, err = provider.Get("generated")
+	is.True(errors.Is(err, envelope.ErrDecrypt))
+}
+
+// failingRenameFs is a filesystem which can't rename files.
+type failingRenameFs struct {
+	afero.Fs
+}
+
+func (f failingRenameFs) Rename(oldname string, newname string) error {
+	return errors.New("rename failed")
+}
+
+func TestSaveFailure(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	provider := newTestProvider(dir, envelope.Passphrase("test"))
+	is.NoErr(provider.Set("test", "value"))
+
+	// With failed rename
+	provider.fs = failingRenameFs{Fs: provider.fs}
+	err := provider.Set("test", "other")
+	is.Equal(err.Error(), "rename failed")
+
+	tmps, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	is.NoErr(err)
+	is.Equal(len(tmps), 0)
+
+	value, err := provider.Get("test")
+	is.NoErr(err)
+	is.Equal(value, "value")
+}
+
+func TestConcurrentSet(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			provider := newTestProvider(dir, envelope.Keyfile([]byte("test")))
+			if err := provider.Set(fmt.Sprintf("key%d", i), "value"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	provider := newTestProvider(dir, envelope.Keyfile([]byte("test")))
+	for i := 0; i < 10; i++ {
+		_, err := provider.Get(fmt.Sprintf("key%d", i))
+		is.NoErr(err)
+	}
+}
+
+func TestNewSecretProviderConfig(t *testing.T) {
+	is := is.New(t)
+	t.Setenv("BOOTS_FILE_PASSPHRASE", "") // Restores the environment after the test
+	os.Unsetenv("BOOTS_FILE_PASSPHRASE")
+
+	keyfile := filepath.Join(t.TempDir(), "key")
+	is.NoErr(os.WriteFile(keyfile, []byte("test"), 0600))
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", 0)
+		for _, f := range Flags() {
+			is.NoErr(f.Apply(set))
+		}
+		is.NoErr(set.Parse(args))
+		return cli.NewContext(&cli.App{}, set, nil)
+	}
+
+	// With passphrase
+	config, err := NewSecretProviderConfig(newContext("--file-passphrase", "test"))
+	is.NoErr(err)
+	is.Equal(config.path, Filename)
+	is.Equal(config.secret, envelope.Passphrase("test"))
+
+	// With keyfile
+	config, err = NewSecretProviderConfig(newContext("--file-keyfile", keyfile, "--file-path", "dev.secrets"))
+	is.NoErr(err)
+	is.Equal(config.path, "dev.secrets")
+	is.Equal(config.secret, envelope.Keyfile([]byte("test")))
+
+	// With both
+	_, err = NewSecretProviderConfig(newContext("--file-keyfile", keyfile, "--file-passphrase", "test"))
+	is.Equal(err.Error(), "must supply only one of a passphrase or keyfile")
+
+	// With neither
+	_, err = NewSecretProviderConfig(newContext())
+	is.Equal(err.Error(), "must supply a passphrase or keyfile")
+}
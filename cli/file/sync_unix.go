@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import "github.com/spf13/afero"
+
+// syncDir flushes the entries of the given directory to disk so that a file
+// renamed into it survives a crash.
+func syncDir(fs afero.Fs, dir string) error {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package file
+
+import "github.com/spf13/afero"
+
+// syncDir is a no-op as directories can't be opened for syncing on Windows,
+// where a rename is flushed along with the file's metadata.
+func syncDir(fs afero.Fs, dir string) error {
+	return nil
+}
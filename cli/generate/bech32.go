@@ -0,0 +1,150 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bech32Charset maps 5-bit values to the characters of the bech32 alphabet.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Generator is used to compute the checksum of bech32 strings.
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// encodeBech32 encodes data with the given human-readable prefix using bech32
+// as described in BIP 173. Unlike BIP 173, the length of the result isn't
+// limited, matching the encoding used by age.
+func encodeBech32(hrp string, data []byte) (string, error) {
+	if hrp == "" {
+		return "", fmt.Errorf("bech32 prefix must not be empty")
+	}
+	for _, c := range hrp {
+		if c < 33 || c > 126 {
+			return "", fmt.Errorf("invalid character in bech32 prefix: %q", c)
+		}
+	}
+
+	// Mixed case isn't allowed, so the result takes the case of the prefix
+	upper := strings.ToUpper(hrp) == hrp
+	hrp = strings.ToLower(hrp)
+
+	values := convertBits(data, 8, 5, true)
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range append(values, bech32Checksum(hrp, values)...) {
+		b.WriteByte(bech32Charset[v])
+	}
+
+	if upper {
+		return strings.ToUpper(b.String()), nil
+	}
+
+	return b.String(), nil
+}
+
+// decodeBech32 returns the human-readable prefix and data of a bech32 string.
+func decodeBech32(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("bech32 string must not be mixed case")
+	}
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, fmt.Errorf("invalid bech32 separator position")
+	}
+
+	hrp := s[:pos]
+	values := make([]byte, 0, len(s)-pos-1)
+	for _, c := range s[pos+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character in bech32 data: %q", c)
+		}
+		values = append(values, byte(v))
+	}
+
+	if bech32Polymod(append(bech32ExpandPrefix(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid bech32 checksum")
+	}
+
+	data := convertBits(values[:len(values)-6], 5, 8, false)
+	if data == nil {
+		return "", nil, fmt.Errorf("invalid bech32 padding")
+	}
+
+	return hrp, data, nil
+}
+
+// bech32Checksum returns the six 5-bit values which make up the checksum of
+// the given prefix and data.
+func bech32Checksum(hrp string, values []byte) []byte {
+	input := append(bech32ExpandPrefix(hrp), values...)
+	mod := bech32Polymod(append(input, 0, 0, 0, 0, 0, 0)) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+
+	return checksum
+}
+
+// bech32ExpandPrefix returns the prefix expanded for computing the checksum.
+func bech32ExpandPrefix(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+
+	return expanded
+}
+
+// bech32Polymod returns the BCH checksum of the given 5-bit values.
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+
+	return chk
+}
+
+// convertBits regroups data from groups of from bits into groups of to bits.
+// If pad is false, returns nil when the input has leftover non-zero bits.
+func convertBits(data []byte, from uint, to uint, pad bool) []byte {
+	var acc uint32
+	var bits uint
+	result := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	max := uint32(1)<<to - 1
+
+	for _, b := range data {
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			result = append(result, byte(acc>>bits&max))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(to-bits)&max))
+		}
+	} else if bits >= from || acc<<(to-bits)&max != 0 {
+		return nil
+	}
+
+	return result
+}
@@ -0,0 +1,56 @@
+package generate
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestBech32(t *testing.T) {
+	is := is.New(t)
+
+	// Test vectors from BIP 173
+	tests := []struct {
+		hrp      string
+		data     string
+		expected string
+	}{
+		{"a", "", "a12uel5l"},
+		{"A", "", "A12UEL5L"},
+		{"abcdef", "00443214c74254b635cf84653a56d7c675be77df", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw"},
+		{"split", "c5f38b70305f519bf66d85fb6cf03058f3dde463ecd7918f2dc743918f2d", "split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w"},
+	}
+
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.data)
+		is.NoErr(err)
+
+		encoded, err := encodeBech32(test.hrp, data)
+		is.NoErr(err)
+		is.Equal(encoded, test.expected)
+
+		hrp, decoded, err := decodeBech32(encoded)
+		is.NoErr(err)
+		is.Equal(hrp, strings.ToLower(test.hrp))
+		is.Equal(hex.EncodeToString(decoded), test.data)
+	}
+
+	// With invalid strings
+	for _, s := range []string{
+		"A1G7SGD8",  // invalid checksum
+		"10a06t8",   // empty prefix
+		"1qzzfhee",  // empty prefix
+		"a12UEL5L",  // mixed case
+		"abc1ab1ef", // too short
+		"x1b4n0q5v", // invalid character
+		"li1dgmt3",  // too short checksum
+	} {
+		_, _, err := decodeBech32(s)
+		is.True(err != nil)
+	}
+
+	_, err := encodeBech32("", nil)
+	is.Equal(err.Error(), "bech32 prefix must not be empty")
+}
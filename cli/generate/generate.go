@@ -0,0 +1,308 @@
+// Package generate provides random secret generation driven by named
+// policies. A policy controls the length and alphabet of the generated value
+// along with how many characters from each class it must contain.
+package generate
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	LowerLetters = "abcdefghijklmnopqrstuvwxyz"
+	UpperLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits       = "0123456789"
+	Symbols      = "~!@#$%^&*()_+`-={}|[]\\:\"<>?,./"
+
+	// Ambiguous contains characters which are easily mistaken for one another.
+	Ambiguous = "0O1lI|`'\""
+
+	// DefaultPolicy is the name of the policy used when none is given.
+	DefaultPolicy = "default"
+)
+
+// The types of value which can be generated.
+const (
+	TypeAlnum      = "alnum"
+	TypeBase64     = "base64"
+	TypeHex        = "hex"
+	TypePassphrase = "passphrase"
+	TypePassword   = "password"
+	TypeUUID       = "uuid"
+)
+
+// Generator is implemented by each type of generated value.
+type Generator interface {
+	// Returns the bits of entropy of a generated value
+	Entropy() float64
+
+	// Returns a new random value
+	Generate() (string, error)
+}
+
+// Policy describes how a random secret is generated.
+type Policy struct {
+	// Length is the number of characters to generate.
+	Length int `yaml:"length"`
+
+	// Alphabet replaces the character classes below with a custom set of
+	// characters, any of which aren't letters or digits counting as symbols.
+	// Required counts must be satisfiable from the alphabet.
+	Alphabet string `yaml:"alphabet"`
+
+	// AllowedSymbols replaces the default symbol set. Useful for consumers
+	// which can't handle certain symbols.
+	AllowedSymbols string `yaml:"allowed_symbols"`
+
+	// NoDigits excludes digits from the alphabet.
+	NoDigits bool `yaml:"no_digits"`
+
+	// NoSymbols excludes symbols from the alphabet.
+	NoSymbols bool `yaml:"no_symbols"`
+
+	// ExcludeAmbiguous removes easily confused characters from the alphabet.
+	ExcludeAmbiguous bool `yaml:"exclude_ambiguous"`
+
+	// The minimum number of characters required from each class.
+	MinLower   int `yaml:"min_lower"`
+	MinUpper   int `yaml:"min_upper"`
+	MinDigits  int `yaml:"min_digits"`
+	MinSymbols int `yaml:"min_symbols"`
+
+	// MinEntropy is the minimum number of bits of entropy the policy must
+	// provide.
+	MinEntropy float64 `yaml:"min_entropy"`
+}
+
+// Policies are the built-in named policies.
+var Policies = map[string]Policy{
+	DefaultPolicy: {
+		Length:     16,
+		MinDigits:  1,
+		MinSymbols: 1,
+	},
+	"alphanumeric": {
+		Length:    32,
+		NoSymbols: true,
+	},
+	"strong": {
+		Length:     32,
+		MinLower:   1,
+		MinUpper:   1,
+		MinDigits:  1,
+		MinSymbols: 1,
+		MinEntropy: 128,
+	},
+	"url-safe": {
+		Length:         32,
+		AllowedSymbols: "-_",
+		MinEntropy:     128,
+	},
+	"human": {
+		Length:           20,
+		ExcludeAmbiguous: true,
+		NoSymbols:        true,
+	},
+}
+
+// LoadPolicies parses named policies from YAML. The returned map includes the
+// built-in policies, which may be overridden by the parsed policies.
+func LoadPolicies(data []byte) (map[string]Policy, error) {
+	var custom map[string]Policy
+	if err := yaml.UnmarshalStrict(data, &custom); err != nil {
+		return nil, fmt.Errorf("error parsing policies: %s", err)
+	}
+
+	policies := make(map[string]Policy, len(Policies)+len(custom))
+	for name, policy := range Policies {
+		policies[name] = policy
+	}
+	for name, policy := range custom {
+		policies[name] = policy
+	}
+
+	return policies, nil
+}
+
+// classes returns the character classes used by the policy along with the
+// number of characters required from each. With a custom alphabet, any of its
+// characters which aren't letters or digits are treated as symbols.
+func (p Policy) classes() (classes []string, required []int) {
+	symbols := Symbols
+	if p.Alphabet != "" {
+		symbols = filter(p.Alphabet, LowerLetters+UpperLetters+Digits, false)
+	}
+	if p.AllowedSymbols != "" {
+		symbols = p.AllowedSymbols
+	}
+	if p.NoSymbols {
+		symbols = ""
+	}
+	digits := Digits
+	if p.NoDigits {
+		digits = ""
+	}
+
+	sets := []string{LowerLetters, UpperLetters, digits, symbols}
+	mins := []int{p.MinLower, p.MinUpper, p.MinDigits, p.MinSymbols}
+	for i, set := range sets {
+		// A custom alphabet restricts each class to the characters it contains
+		if p.Alphabet != "" {
+			set = filter(set, p.Alphabet, true)
+		}
+		if p.ExcludeAmbiguous {
+			set = filter(set, Ambiguous, false)
+		}
+		classes = append(classes, set)
+		required = append(required, mins[i])
+	}
+
+	return classes, required
+}
+
+// alphabet returns the deduplicated set of characters the policy draws from,
+// which is the union of its character classes.
+func (p Policy) alphabet() []rune {
+	classes, _ := p.classes()
+
+	seen := make(map[rune]bool)
+	var alphabet []rune
+	for _, r := range strings.Join(classes, "") {
+		if !seen[r] {
+			seen[r] = true
+			alphabet = append(alphabet, r)
+		}
+	}
+	sort.Slice(alphabet, func(i, j int) bool { return alphabet[i] < alphabet[j] })
+
+	return alphabet
+}
+
+// Entropy returns the bits of entropy of a value generated by the policy,
+// assuming each character is drawn uniformly from the alphabet.
+func (p Policy) Entropy() float64 {
+	size := len(p.alphabet())
+	if size < 2 {
+		return 0
+	}
+
+	return float64(p.Length) * math.Log2(float64(size))
+}
+
+// Validate returns an error if the policy can't generate a value.
+func (p Policy) Validate() error {
+	if p.Length < 1 {
+		return fmt.Errorf("length must be greater than zero")
+	}
+
+	if len(p.alphabet()) < 2 {
+		return fmt.Errorf("alphabet must contain at least two characters")
+	}
+
+	names := []string{"lowercase letters", "uppercase letters", "digits", "symbols"}
+	classes, required := p.classes()
+	total := 0
+	for i, class := range classes {
+		if required[i] < 0 {
+			return fmt.Errorf("minimum %s must not be negative", names[i])
+		}
+		if required[i] > 0 && class == "" {
+			return fmt.Errorf("policy requires %s but its alphabet contains none", names[i])
+		}
+		total += required[i]
+	}
+	if total > p.Length {
+		return fmt.Errorf("required characters (%d) exceed length (%d)", total, p.Length)
+	}
+
+	if entropy := p.Entropy(); entropy < p.MinEntropy {
+		return fmt.Errorf("policy provides %.1f bits of entropy, below the minimum of %.1f", entropy, p.MinEntropy)
+	}
+
+	return nil
+}
+
+// Generate returns a new random value using the policy.
+func (p Policy) Generate() (string, error) {
+	return p.generate(rand.Reader)
+}
+
+// generate returns a new random value using randomness read from r. Required
+// characters are drawn from their classes first and the remainder from the
+// full alphabet before the result is shuffled.
+func (p Policy) generate(r io.Reader) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	var result []rune
+	classes, required := p.classes()
+	for i, class := range classes {
+		chars := []rune(class)
+		for j := 0; j < required[i]; j++ {
+			c, err := choose(r, chars)
+			if err != nil {
+				return "", err
+			}
+			result = append(result, c)
+		}
+	}
+
+	alphabet := p.alphabet()
+	for len(result) < p.Length {
+		c, err := choose(r, alphabet)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, c)
+	}
+
+	// Fisher-Yates shuffle so required characters aren't always first
+	for i := len(result) - 1; i > 0; i-- {
+		j, err := randInt(r, i+1)
+		if err != nil {
+			return "", err
+		}
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return string(result), nil
+}
+
+// filter returns the characters of chars which are (or, if keep is false,
+// aren't) contained in set.
+func filter(chars string, set string, keep bool) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(set, r) == keep {
+			return r
+		}
+		return -1
+	}, chars)
+}
+
+// choose returns a uniformly random element of chars.
+func choose(r io.Reader, chars []rune) (rune, error) {
+	i, err := randInt(r, len(chars))
+	if err != nil {
+		return 0, err
+	}
+
+	return chars[i], nil
+}
+
+// randInt returns a uniformly random integer in [0, max).
+func randInt(r io.Reader, max int) (int, error) {
+	n, err := rand.Int(r, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	return int(n.Int64()), nil
+}
@@ -0,0 +1,133 @@
+package generate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// count returns the number of characters of value contained in set.
+func count(value string, set string) int {
+	n := 0
+	for _, r := range value {
+		if strings.ContainsRune(set, r) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGenerate(t *testing.T) {
+	is := is.New(t)
+
+	// With required classes
+	policy := Policy{Length: 12, MinLower: 2, MinUpper: 2, MinDigits: 3, MinSymbols: 4, AllowedSymbols: "-_"}
+	for i := 0; i < 50; i++ {
+		value, err := policy.Generate()
+		is.NoErr(err)
+		is.Equal(len(value), 12)
+		is.True(count(value, LowerLetters) >= 2)
+		is.True(count(value, UpperLetters) >= 2)
+		is.True(count(value, Digits) >= 3)
+		is.True(count(value, "-_") >= 4)
+		is.Equal(count(value, filter(Symbols, "-_", false)), 0)
+	}
+
+	// With custom alphabet
+	policy = Policy{Length: 64, Alphabet: "abc123", MinDigits: 1}
+	value, err := policy.Generate()
+	is.NoErr(err)
+	is.Equal(count(value, "abc123"), 64)
+	is.True(count(value, "123") >= 1)
+
+	// With custom alphabet and classes excluded
+	policy = Policy{Length: 256, Alphabet: "abc123;-", NoDigits: true}
+	value, err = policy.Generate()
+	is.NoErr(err)
+	is.Equal(count(value, "abc;-"), 256)
+
+	policy = Policy{Length: 256, Alphabet: "abc123;-", NoSymbols: true}
+	value, err = policy.Generate()
+	is.NoErr(err)
+	is.Equal(count(value, "abc123"), 256)
+
+	policy = Policy{Length: 256, Alphabet: "abc123;-", AllowedSymbols: "-_"}
+	value, err = policy.Generate()
+	is.NoErr(err)
+	is.Equal(count(value, "abc123-"), 256)
+
+	// With digits excluded
+	policy = Policy{Length: 256, NoDigits: true}
+	value, err = policy.Generate()
+	is.NoErr(err)
+	is.Equal(count(value, Digits), 0)
+
+	// With ambiguous characters excluded
+	policy = Policy{Length: 256, ExcludeAmbiguous: true}
+	value, err = policy.Generate()
+	is.NoErr(err)
+	is.Equal(count(value, Ambiguous), 0)
+
+	// With exhausted randomness
+	policy = Policy{Length: 16}
+	_, err = policy.generate(bytes.NewReader(nil))
+	is.True(strings.HasPrefix(err.Error(), "failed reading random data"))
+}
+
+func TestEntropy(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(Policy{Length: 10, Alphabet: "01"}.Entropy(), 10.0)
+	is.Equal(Policy{Length: 4, Alphabet: "0123456789abcdef"}.Entropy(), 16.0)
+	is.Equal(Policy{Length: 4, Alphabet: "aaaa"}.Entropy(), 0.0)
+
+	for name, policy := range Policies {
+		if err := policy.Validate(); err != nil {
+			t.Errorf("built-in policy %s is invalid: %s", name, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	is := is.New(t)
+
+	err := Policy{}.Validate()
+	is.Equal(err.Error(), "length must be greater than zero")
+
+	err = Policy{Length: 8, Alphabet: "a"}.Validate()
+	is.Equal(err.Error(), "alphabet must contain at least two characters")
+
+	err = Policy{Length: 8, NoSymbols: true, MinSymbols: 1}.Validate()
+	is.Equal(err.Error(), "policy requires symbols but its alphabet contains none")
+
+	err = Policy{Length: 2, MinDigits: 2, MinUpper: 1}.Validate()
+	is.Equal(err.Error(), "required characters (3) exceed length (2)")
+
+	err = Policy{Length: 8, Alphabet: "01", MinEntropy: 64}.Validate()
+	is.Equal(err.Error(), "policy provides 8.0 bits of entropy, below the minimum of 64.0")
+}
+
+func TestLoadPolicies(t *testing.T) {
+	is := is.New(t)
+	data := `
+vmrest:
+  length: 12
+  allowed_symbols: "!@#"
+  min_symbols: 1
+default:
+  length: 24
+`
+
+	policies, err := LoadPolicies([]byte(data))
+	is.NoErr(err)
+	is.Equal(policies["vmrest"], Policy{Length: 12, AllowedSymbols: "!@#", MinSymbols: 1})
+	is.Equal(policies["default"].Length, 24)
+	is.Equal(policies["strong"], Policies["strong"])
+	is.Equal(Policies["default"].Length, 16)
+
+	// With unknown field
+	_, err = LoadPolicies([]byte("vmrest:\n  size: 12\n"))
+	is.True(strings.HasPrefix(err.Error(), "error parsing policies"))
+}
@@ -0,0 +1,113 @@
+package generate
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// The types of value used by the HashiCorp stack.
+const (
+	TypeACLToken               = "acl-token"
+	TypeConsulGossip           = "consul-gossip"
+	TypeNomadGossip            = "nomad-gossip"
+	TypeVaultUnsealPlaceholder = "vault-unseal-placeholder"
+)
+
+// VaultUnsealPlaceholder is stored in place of a Vault unseal key until Vault
+// is initialized and the real key is known.
+const VaultUnsealPlaceholder = "placeholder:vault-unseal"
+
+// uuidPattern matches a UUID in its canonical form.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// GossipKey generates keys for encrypting the gossip traffic of Consul and
+// Nomad agents: 32 random bytes encoded as padded standard base64.
+type GossipKey struct{}
+
+// Entropy returns the bits of entropy of a gossip key.
+func (g GossipKey) Entropy() float64 {
+	return 256
+}
+
+// Generate returns a new random gossip key.
+func (g GossipKey) Generate() (string, error) {
+	return g.generate(rand.Reader)
+}
+
+// generate returns a new gossip key using randomness read from r.
+func (g GossipKey) generate(r io.Reader) (string, error) {
+	var key [32]byte
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		return "", fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(key[:]), nil
+}
+
+// Placeholder generates a fixed value which marks a secret as not yet known.
+type Placeholder struct {
+	Value string
+}
+
+// Entropy returns zero as the value isn't random.
+func (p Placeholder) Entropy() float64 {
+	return 0
+}
+
+// Generate returns the placeholder value.
+func (p Placeholder) Generate() (string, error) {
+	return p.Value, nil
+}
+
+// ValidateValue returns an error if value isn't correctly formatted for the
+// given type. Types without a required format accept any value.
+func ValidateValue(typ string, value string) error {
+	switch typ {
+	case TypeACLToken, TypeUUID:
+		if !uuidPattern.MatchString(value) {
+			return fmt.Errorf("%s must be a UUID", typ)
+		}
+	case TypeConsulGossip:
+		// Consul accepts AES-128, AES-192, or AES-256 keys
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("%s must be base64 encoded: %s", typ, err)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return fmt.Errorf("%s must be 16, 24, or 32 bytes, got %d", typ, n)
+		}
+	case TypeNomadGossip:
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("%s must be base64 encoded: %s", typ, err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("%s must be 32 bytes, got %d", typ, len(key))
+		}
+	case TypeVaultUnsealPlaceholder:
+		// Shamir unseal keys are a 32 byte share followed by its index
+		if value == VaultUnsealPlaceholder {
+			return nil
+		}
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			key, err = hex.DecodeString(value)
+		}
+		if err != nil || len(key) != 33 {
+			return fmt.Errorf("%s must be the placeholder or a base64 or hex encoded unseal key", typ)
+		}
+	case TypeWireGuard:
+		return validateWireGuardKey(value)
+	case TypeAge:
+		return validateAgeIdentity(value)
+	case TypeAlnum, TypeBase64, TypeHex, TypePassphrase, TypePassword:
+	default:
+		return fmt.Errorf("unknown type: %s", typ)
+	}
+
+	return nil
+}
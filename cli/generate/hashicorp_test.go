@@ -0,0 +1,61 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestGossipKey(t *testing.T) {
+	is := is.New(t)
+
+	value, err := GossipKey{}.Generate()
+	is.NoErr(err)
+	key, err := base64.StdEncoding.DecodeString(value)
+	is.NoErr(err)
+	is.Equal(len(key), 32)
+	is.NoErr(ValidateValue(TypeConsulGossip, value))
+	is.NoErr(ValidateValue(TypeNomadGossip, value))
+
+	// With exhausted randomness
+	_, err = GossipKey{}.generate(bytes.NewReader(nil))
+	is.True(strings.HasPrefix(err.Error(), "failed reading random data"))
+}
+
+func TestValidateValue(t *testing.T) {
+	is := is.New(t)
+	key16 := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	unseal := make([]byte, 33)
+
+	tests := []struct {
+		typ   string
+		value string
+		err   string
+	}{
+		{TypeACLToken, "0d5b3a2e-9a8c-4c3f-8f51-6fb1f0a7b0c4", ""},
+		{TypeACLToken, "not-a-uuid", "acl-token must be a UUID"},
+		{TypeConsulGossip, key16, ""},
+		{TypeConsulGossip, base64.StdEncoding.EncodeToString(make([]byte, 20)), "consul-gossip must be 16, 24, or 32 bytes, got 20"},
+		{TypeConsulGossip, "p@ssw0rd!", "consul-gossip must be base64 encoded: illegal base64 data at input byte 1"},
+		{TypeNomadGossip, key16, "nomad-gossip must be 32 bytes, got 16"},
+		{TypeVaultUnsealPlaceholder, VaultUnsealPlaceholder, ""},
+		{TypeVaultUnsealPlaceholder, base64.StdEncoding.EncodeToString(unseal), ""},
+		{TypeVaultUnsealPlaceholder, hex.EncodeToString(unseal), ""},
+		{TypeVaultUnsealPlaceholder, key16, "vault-unseal-placeholder must be the placeholder or a base64 or hex encoded unseal key"},
+		{TypePassword, "anything", ""},
+		{"pin", "1234", "unknown type: pin"},
+	}
+
+	for _, test := range tests {
+		err := ValidateValue(test.typ, test.value)
+		if test.err == "" {
+			is.NoErr(err)
+		} else {
+			is.Equal(err.Error(), test.err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package generate
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// The types of keypair which can be generated.
+const (
+	TypeAge       = "age"
+	TypeWireGuard = "wireguard"
+)
+
+// The human-readable prefixes of bech32 encoded age keys.
+const (
+	ageIdentityPrefix  = "AGE-SECRET-KEY-"
+	ageRecipientPrefix = "age"
+)
+
+// KeyPair is a generated private and public key encoded as text.
+type KeyPair struct {
+	Private string
+	Public  string
+}
+
+// KeyPairGenerator is implemented by each type of generated keypair.
+type KeyPairGenerator interface {
+	// Returns the bits of entropy of a generated private key
+	Entropy() float64
+
+	// Returns a new random keypair
+	GenerateKeyPair() (KeyPair, error)
+}
+
+// WireGuardKey generates Curve25519 keypairs encoded as base64 in the same
+// way as wg genkey and wg pubkey.
+type WireGuardKey struct{}
+
+// Entropy returns the bits of entropy of a private key. Clamping fixes five
+// of its bits.
+func (w WireGuardKey) Entropy() float64 {
+	return 251
+}
+
+// GenerateKeyPair returns a new random WireGuard keypair.
+func (w WireGuardKey) GenerateKeyPair() (KeyPair, error) {
+	return w.generate(rand.Reader)
+}
+
+// generate returns a new WireGuard keypair using randomness read from r.
+func (w WireGuardKey) generate(r io.Reader) (KeyPair, error) {
+	private, public, err := newX25519Key(r)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	// wg stores the private key already clamped
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+
+	return KeyPair{
+		Private: base64.StdEncoding.EncodeToString(private),
+		Public:  base64.StdEncoding.EncodeToString(public),
+	}, nil
+}
+
+// AgeKey generates X25519 identities and recipients for age encoded as
+// bech32 in the same way as age-keygen.
+type AgeKey struct{}
+
+// Entropy returns the bits of entropy of an identity. Clamping fixes five of
+// its bits when it's used.
+func (a AgeKey) Entropy() float64 {
+	return 251
+}
+
+// GenerateKeyPair returns a new random age identity and its recipient.
+func (a AgeKey) GenerateKeyPair() (KeyPair, error) {
+	return a.generate(rand.Reader)
+}
+
+// generate returns a new age keypair using randomness read from r.
+func (a AgeKey) generate(r io.Reader) (KeyPair, error) {
+	private, public, err := newX25519Key(r)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	identity, err := encodeBech32(ageIdentityPrefix, private)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	recipient, err := encodeBech32(ageRecipientPrefix, public)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{Private: identity, Public: recipient}, nil
+}
+
+// newX25519Key returns a random X25519 private key and its public key.
+func newX25519Key(r io.Reader) ([]byte, []byte, error) {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(r, private); err != nil {
+		return nil, nil, fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return private, public, nil
+}
+
+// validateWireGuardKey returns an error if value isn't a base64 encoded
+// WireGuard key.
+func validateWireGuardKey(value string) error {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != curve25519.ScalarSize {
+		return fmt.Errorf("%s keys must be 32 bytes encoded as base64", TypeWireGuard)
+	}
+
+	return nil
+}
+
+// validateAgeIdentity returns an error if value isn't an age identity.
+func validateAgeIdentity(value string) error {
+	hrp, key, err := decodeBech32(value)
+	if err != nil || hrp != strings.ToLower(ageIdentityPrefix) || len(key) != curve25519.ScalarSize {
+		return fmt.Errorf("%s identities must be bech32 encoded and start with %s1", TypeAge, ageIdentityPrefix)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestWireGuardKey(t *testing.T) {
+	is := is.New(t)
+
+	// Private keys are stored clamped
+	pair, err := WireGuardKey{}.generate(bytes.NewReader(bytes.Repeat([]byte{1}, 32)))
+	is.NoErr(err)
+	is.Equal(pair.Private, "AAEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAUE=")
+	is.NoErr(ValidateValue(TypeWireGuard, pair.Private))
+
+	public, err := base64.StdEncoding.DecodeString(pair.Public)
+	is.NoErr(err)
+	is.Equal(len(public), 32)
+
+	// With random keys
+	first, err := WireGuardKey{}.GenerateKeyPair()
+	is.NoErr(err)
+	second, err := WireGuardKey{}.GenerateKeyPair()
+	is.NoErr(err)
+	is.True(first.Private != second.Private)
+
+	// With exhausted randomness
+	_, err = WireGuardKey{}.generate(bytes.NewReader(nil))
+	is.True(strings.HasPrefix(err.Error(), "failed reading random data"))
+
+	// With invalid keys
+	is.Equal(ValidateValue(TypeWireGuard, "AAEB").Error(), "wireguard keys must be 32 bytes encoded as base64")
+}
+
+func TestAgeKey(t *testing.T) {
+	is := is.New(t)
+
+	pair, err := AgeKey{}.GenerateKeyPair()
+	is.NoErr(err)
+	is.True(strings.HasPrefix(pair.Private, "AGE-SECRET-KEY-1"))
+	is.True(strings.HasPrefix(pair.Public, "age1"))
+	is.Equal(len(pair.Private), 74)
+	is.Equal(len(pair.Public), 62)
+	is.NoErr(ValidateValue(TypeAge, pair.Private))
+
+	// Test vector from RFC 7748
+	private, err := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	is.NoErr(err)
+	pair, err = AgeKey{}.generate(bytes.NewReader(private))
+	is.NoErr(err)
+	hrp, public, err := decodeBech32(pair.Public)
+	is.NoErr(err)
+	is.Equal(hrp, "age")
+	is.Equal(hex.EncodeToString(public), "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+
+	// The recipient is derived from the identity
+	hrp, private, err = decodeBech32(pair.Private)
+	is.NoErr(err)
+	is.Equal(hrp, "age-secret-key-")
+	expected, err := AgeKey{}.generate(bytes.NewReader(private))
+	is.NoErr(err)
+	is.Equal(expected, pair)
+
+	// With exhausted randomness
+	_, err = AgeKey{}.generate(bytes.NewReader(nil))
+	is.True(strings.HasPrefix(err.Error(), "failed reading random data"))
+
+	// With invalid identities
+	is.Equal(ValidateValue(TypeAge, pair.Public).Error(), "age identities must be bech32 encoded and start with AGE-SECRET-KEY-1")
+}
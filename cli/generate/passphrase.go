@@ -0,0 +1,83 @@
+package generate
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// DefaultWords is the default number of words in a generated passphrase.
+const DefaultWords = 6
+
+// effWordlist is the EFF large wordlist for generating passphrases with five
+// dice. Each line contains the dice roll followed by a tab and the word.
+//
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases
+//
+//go:embed eff_large_wordlist.txt
+var effWordlist string
+
+// Wordlist contains the words passphrases are drawn from.
+var Wordlist = parseWordlist(effWordlist)
+
+// Passphrase describes how a diceware passphrase is generated.
+type Passphrase struct {
+	// Words is the number of words in the passphrase.
+	Words int
+
+	// Separator is placed between each word.
+	Separator string
+}
+
+// Entropy returns the bits of entropy of a passphrase.
+func (p Passphrase) Entropy() float64 {
+	return float64(p.Words) * math.Log2(float64(len(Wordlist)))
+}
+
+// Validate returns an error if the passphrase can't be generated.
+func (p Passphrase) Validate() error {
+	if p.Words < 1 {
+		return fmt.Errorf("word count must be greater than zero")
+	}
+
+	return nil
+}
+
+// Generate returns a new random passphrase.
+func (p Passphrase) Generate() (string, error) {
+	return p.generate(rand.Reader)
+}
+
+// generate returns a new random passphrase using randomness read from r.
+func (p Passphrase) generate(r io.Reader) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	words := make([]string, p.Words)
+	for i := range words {
+		n, err := randInt(r, len(Wordlist))
+		if err != nil {
+			return "", err
+		}
+		words[i] = Wordlist[n]
+	}
+
+	return strings.Join(words, p.Separator), nil
+}
+
+// parseWordlist returns the words contained in a diceware wordlist.
+func parseWordlist(data string) []string {
+	var words []string
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			words = append(words, fields[1])
+		}
+	}
+
+	return words
+}
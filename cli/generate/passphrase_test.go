@@ -0,0 +1,37 @@
+package generate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestPassphrase(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(len(Wordlist), 7776)
+	is.Equal(Wordlist[0], "abacus")
+	is.Equal(Wordlist[7775], "zoom")
+
+	// With separator
+	value, err := Passphrase{Words: 5, Separator: "."}.Generate()
+	is.NoErr(err)
+	words := strings.Split(value, ".")
+	is.Equal(len(words), 5)
+	for _, word := range words {
+		is.True(word != "")
+	}
+
+	// With entropy
+	is.Equal(int(Passphrase{Words: DefaultWords}.Entropy()), 77)
+
+	// With no words
+	_, err = Passphrase{}.Generate()
+	is.Equal(err.Error(), "word count must be greater than zero")
+
+	// With exhausted randomness
+	_, err = Passphrase{Words: 4}.generate(bytes.NewReader(nil))
+	is.True(strings.HasPrefix(err.Error(), "failed reading random data"))
+}
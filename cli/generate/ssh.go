@@ -0,0 +1,168 @@
+package generate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The types of SSH key which can be generated.
+const (
+	SSHKeyECDSA   = "ecdsa"
+	SSHKeyED25519 = "ed25519"
+	SSHKeyRSA     = "rsa"
+)
+
+// SSHKey describes how an SSH keypair is generated.
+type SSHKey struct {
+	// Type is one of SSHKeyECDSA, SSHKeyED25519, or SSHKeyRSA.
+	Type string
+
+	// Bits is the size of RSA keys (defaults to 4096) or the curve size of
+	// ECDSA keys (defaults to 256). It's ignored for ed25519 keys.
+	Bits int
+
+	// Comment is appended to the public key and embedded in the private key.
+	Comment string
+}
+
+// SSHKeyPair is a generated SSH keypair.
+type SSHKeyPair struct {
+	// Fingerprint is the SHA256 fingerprint of the public key.
+	Fingerprint string
+
+	// PrivateKey is the PEM encoded private key in the OpenSSH format.
+	PrivateKey []byte
+
+	// PublicKey is the public key in the authorized_keys format.
+	PublicKey []byte
+}
+
+// Generate returns a new random SSH keypair.
+func (k SSHKey) Generate() (SSHKeyPair, error) {
+	return k.generate(rand.Reader)
+}
+
+// generate returns a new SSH keypair using randomness read from r.
+func (k SSHKey) generate(r io.Reader) (SSHKeyPair, error) {
+	var key crypto.Signer
+	var err error
+	switch k.Type {
+	case SSHKeyED25519:
+		_, key, err = ed25519.GenerateKey(r)
+	case SSHKeyRSA:
+		bits := k.Bits
+		if bits == 0 {
+			bits = 4096
+		}
+		if bits < 2048 {
+			return SSHKeyPair{}, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		key, err = rsa.GenerateKey(r, bits)
+	case SSHKeyECDSA:
+		var curve elliptic.Curve
+		switch k.Bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return SSHKeyPair{}, fmt.Errorf("ECDSA keys must be 256, 384, or 521 bits")
+		}
+		key, err = ecdsa.GenerateKey(curve, r)
+	default:
+		return SSHKeyPair{}, fmt.Errorf("unknown SSH key type: %s", k.Type)
+	}
+	if err != nil {
+		return SSHKeyPair{}, fmt.Errorf("error generating SSH key: %s", err)
+	}
+
+	public, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return SSHKeyPair{}, err
+	}
+
+	private, err := marshalSSHPrivateKey(r, key, public, k.Comment)
+	if err != nil {
+		return SSHKeyPair{}, err
+	}
+
+	authorized := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(public)), "\n")
+	if k.Comment != "" {
+		authorized += " " + k.Comment
+	}
+
+	return SSHKeyPair{
+		Fingerprint: ssh.FingerprintSHA256(public),
+		PrivateKey:  private,
+		PublicKey:   []byte(authorized + "\n"),
+	}, nil
+}
+
+// marshalSSHPrivateKey encodes an unencrypted private key in the OpenSSH
+// format described in PROTOCOL.key of the OpenSSH source.
+func marshalSSHPrivateKey(r io.Reader, key crypto.Signer, public ssh.PublicKey, comment string) ([]byte, error) {
+	var fields []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		fields = ssh.Marshal(struct {
+			Public  []byte
+			Private []byte
+		}{k.Public().(ed25519.PublicKey), k})
+	case *rsa.PrivateKey:
+		fields = ssh.Marshal(struct {
+			N, E, D, Iqmp, P, Q *big.Int
+		}{k.N, big.NewInt(int64(k.E)), k.D, k.Precomputed.Qinv, k.Primes[0], k.Primes[1]})
+	case *ecdsa.PrivateKey:
+		// The curve name is the suffix of the key type (e.g. nistp256)
+		curve := public.Type()[strings.LastIndex(public.Type(), "-")+1:]
+		fields = ssh.Marshal(struct {
+			Curve string
+			Point []byte
+			D     *big.Int
+		}{curve, elliptic.Marshal(k.Curve, k.X, k.Y), k.D})
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+
+	// Matching check values allow decryption to be verified when loading
+	var check [4]byte
+	if _, err := io.ReadFull(r, check[:]); err != nil {
+		return nil, fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	private := ssh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Type    string
+		Fields  []byte `ssh:"rest"`
+		Comment string
+	}{binary.BigEndian.Uint32(check[:]), binary.BigEndian.Uint32(check[:]), public.Type(), fields, comment})
+	for i := byte(1); len(private)%8 != 0; i++ {
+		private = append(private, i)
+	}
+
+	data := append([]byte("openssh-key-v1\x00"), ssh.Marshal(struct {
+		Cipher     string
+		KDF        string
+		KDFOptions string
+		Keys       uint32
+		Public     []byte
+		Private    []byte
+	}{"none", "none", "", 1, public.Marshal(), private})...)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data}), nil
+}
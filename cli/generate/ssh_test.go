@@ -0,0 +1,54 @@
+package generate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHKey(t *testing.T) {
+	is := is.New(t)
+
+	tests := []struct {
+		key      SSHKey
+		expected string
+	}{
+		{SSHKey{Type: SSHKeyED25519, Comment: "ops@glab"}, ssh.KeyAlgoED25519},
+		{SSHKey{Type: SSHKeyRSA, Bits: 2048}, ssh.KeyAlgoRSA},
+		{SSHKey{Type: SSHKeyECDSA}, ssh.KeyAlgoECDSA256},
+		{SSHKey{Type: SSHKeyECDSA, Bits: 384}, ssh.KeyAlgoECDSA384},
+		{SSHKey{Type: SSHKeyECDSA, Bits: 521}, ssh.KeyAlgoECDSA521},
+	}
+
+	for _, test := range tests {
+		pair, err := test.key.Generate()
+		is.NoErr(err)
+
+		public, comment, _, _, err := ssh.ParseAuthorizedKey(pair.PublicKey)
+		is.NoErr(err)
+		is.Equal(public.Type(), test.expected)
+		is.Equal(comment, test.key.Comment)
+		is.Equal(pair.Fingerprint, ssh.FingerprintSHA256(public))
+
+		signer, err := ssh.ParsePrivateKey(pair.PrivateKey)
+		is.NoErr(err)
+		is.Equal(signer.PublicKey().Marshal(), public.Marshal())
+	}
+
+	// With invalid keys
+	_, err := SSHKey{Type: "dsa"}.Generate()
+	is.Equal(err.Error(), "unknown SSH key type: dsa")
+
+	_, err = SSHKey{Type: SSHKeyRSA, Bits: 1024}.Generate()
+	is.Equal(err.Error(), "RSA keys must be at least 2048 bits")
+
+	_, err = SSHKey{Type: SSHKeyECDSA, Bits: 128}.Generate()
+	is.Equal(err.Error(), "ECDSA keys must be 256, 384, or 521 bits")
+
+	// With exhausted randomness
+	_, err = SSHKey{Type: SSHKeyED25519}.generate(bytes.NewReader(nil))
+	is.True(strings.HasPrefix(err.Error(), "error generating SSH key"))
+}
@@ -0,0 +1,96 @@
+package generate
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+const (
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+
+	// DefaultTokenBytes is the default number of random bytes in a token.
+	DefaultTokenBytes = 32
+)
+
+// Token describes how a random token is generated. Tokens are random bytes
+// encoded as text, which suits API keys and other machine credentials.
+type Token struct {
+	// Bytes is the number of random bytes encoded in the token.
+	Bytes int
+
+	// Encoding is either EncodingHex or EncodingBase64. Base64 tokens use
+	// the unpadded URL-safe alphabet.
+	Encoding string
+}
+
+// Entropy returns the bits of entropy of a token.
+func (t Token) Entropy() float64 {
+	return float64(t.Bytes * 8)
+}
+
+// Validate returns an error if the token can't be generated.
+func (t Token) Validate() error {
+	if t.Bytes < 1 {
+		return fmt.Errorf("byte count must be greater than zero")
+	}
+
+	switch t.Encoding {
+	case EncodingBase64, EncodingHex:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding: %s", t.Encoding)
+	}
+}
+
+// Generate returns a new random token.
+func (t Token) Generate() (string, error) {
+	return t.generate(rand.Reader)
+}
+
+// generate returns a new random token using randomness read from r.
+func (t Token) generate(r io.Reader) (string, error) {
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+
+	data := make([]byte, t.Bytes)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	if t.Encoding == EncodingHex {
+		return hex.EncodeToString(data), nil
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// UUID generates random (version 4) UUIDs.
+type UUID struct{}
+
+// Entropy returns the bits of entropy of a UUID. Six of its 128 bits are
+// fixed by the version and variant.
+func (u UUID) Entropy() float64 {
+	return 122
+}
+
+// Generate returns a new random UUID.
+func (u UUID) Generate() (string, error) {
+	return u.generate(rand.Reader)
+}
+
+// generate returns a new random UUID using randomness read from r.
+func (u UUID) generate(r io.Reader) (string, error) {
+	var data [16]byte
+	if _, err := io.ReadFull(r, data[:]); err != nil {
+		return "", fmt.Errorf("failed reading random data: %s", err)
+	}
+	data[6] = (data[6] & 0x0f) | 0x40
+	data[8] = (data[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:]), nil
+}
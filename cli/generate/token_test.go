@@ -0,0 +1,48 @@
+package generate
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestToken(t *testing.T) {
+	is := is.New(t)
+
+	// With hex
+	value, err := Token{Bytes: 16, Encoding: EncodingHex}.Generate()
+	is.NoErr(err)
+	is.True(regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(value))
+
+	// With base64
+	value, err = Token{Bytes: 32, Encoding: EncodingBase64}.Generate()
+	is.NoErr(err)
+	is.True(regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`).MatchString(value))
+	is.Equal(Token{Bytes: 32}.Entropy(), 256.0)
+
+	// With invalid token
+	_, err = Token{Encoding: EncodingHex}.Generate()
+	is.Equal(err.Error(), "byte count must be greater than zero")
+
+	_, err = Token{Bytes: 16, Encoding: "base32"}.Generate()
+	is.Equal(err.Error(), "unknown encoding: base32")
+
+	// With exhausted randomness
+	_, err = Token{Bytes: 16, Encoding: EncodingHex}.generate(bytes.NewReader(make([]byte, 8)))
+	is.True(strings.HasPrefix(err.Error(), "failed reading random data"))
+}
+
+func TestUUID(t *testing.T) {
+	is := is.New(t)
+
+	value, err := UUID{}.Generate()
+	is.NoErr(err)
+	is.True(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(value))
+
+	value, err = UUID{}.generate(bytes.NewReader(bytes.Repeat([]byte{0xff}, 16)))
+	is.NoErr(err)
+	is.Equal(value, "ffffffff-ffff-4fff-bfff-ffffffffffff")
+}
@@ -5,11 +5,11 @@ go 1.17
 require (
 	github.com/aws/aws-sdk-go v1.41.10
 	github.com/matryer/is v1.4.0
-	github.com/sethvargo/go-password v0.2.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/afero v1.6.0
 	github.com/urfave/cli/v2 v2.3.0
 	golang.org/x/crypto v0.0.0-20211108221036-ceb1ce70b4fa
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -19,5 +19,4 @@ require (
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
 	golang.org/x/text v0.3.6 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
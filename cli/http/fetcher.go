@@ -0,0 +1,70 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// httpClient is an interface for processing HTTP requests and returning HTTP
+// responses.
+type httpClient interface {
+	// Do sends an HTTP request and returns an HTTP response.
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// fetcher provides the common pipeline for downloading remote artifacts and
+// validating them against detached signatures.
+type fetcher struct {
+	httpClient httpClient
+}
+
+// download downloads the remote file at the given URL, returning a stream of
+// data and it's expected size.
+func (f *fetcher) download(url string) (io.ReadCloser, int64, error) {
+	log.Infof("Sending request to %s", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	log.WithFields(log.Fields{
+		"status": resp.StatusCode,
+		"length": resp.ContentLength,
+	}).Debug("Response received")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("unexpected status downloading %s: %d", url, resp.StatusCode)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+// validate downloads the detached signature for the remote file at the given
+// URL and validates the given data against it using the given verifier.
+func (f *fetcher) validate(data io.Reader, url string, verifier gcli.Verifier) (gcli.Signer, error) {
+	sig, _, err := f.download(fmt.Sprintf("%s%s", url, verifier.Extension()))
+	if err != nil {
+		log.Errorf("Error downloading signature file: %s", err)
+		return gcli.Signer{}, err
+	}
+	defer sig.Close()
+
+	return verifier.Verify(data, sig)
+}
+
+// newFetcher returns a fetcher configured with default dependencies.
+func newFetcher() fetcher {
+	return fetcher{
+		httpClient: &http.Client{},
+	}
+}
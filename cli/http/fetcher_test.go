@@ -0,0 +1,144 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/openpgp"
+)
+
+type MockHTTPClient struct {
+	fnDo func(req *http.Request) (*http.Response, error)
+}
+
+func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return m.fnDo(req)
+}
+
+type MockPGPClient struct {
+	fnReadArmoredKeyRing     func(r io.Reader) (openpgp.EntityList, error)
+	fnCheckDetachedSignature func(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error)
+}
+
+func (m *MockPGPClient) ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	return m.fnReadArmoredKeyRing(r)
+}
+
+func (m *MockPGPClient) CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error) {
+	return m.fnCheckDetachedSignature(keyring, signed, signature)
+}
+
+func TestDownload(t *testing.T) {
+	is := is.New(t)
+	expected_data := "test"
+	expected_size := 1024
+	expected_url := "url"
+
+	// With no error
+	var got_url string
+	mock := MockHTTPClient{
+		fnDo: func(req *http.Request) (*http.Response, error) {
+			got_url = req.URL.String()
+			return &http.Response{
+				Body:          io.NopCloser(strings.NewReader(expected_data)),
+				StatusCode:    http.StatusOK,
+				ContentLength: int64(expected_size),
+			}, nil
+		},
+	}
+
+	f := fetcher{
+		httpClient: &mock,
+	}
+	res, size, err := f.download(expected_url)
+	is.NoErr(err)
+	is.Equal(expected_url, got_url)
+	is.Equal(int64(expected_size), size)
+
+	res_data, err := io.ReadAll(res)
+	is.NoErr(err)
+	is.Equal(expected_data, string(res_data))
+
+	// With error
+	mock = MockHTTPClient{
+		fnDo: func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("error")
+		},
+	}
+
+	f = fetcher{
+		httpClient: &mock,
+	}
+	_, _, err = f.download(expected_url)
+	is.Equal(err.Error(), "error")
+
+	// With unexpected status
+	mock = MockHTTPClient{
+		fnDo: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader("")),
+				StatusCode: http.StatusNotFound,
+			}, nil
+		},
+	}
+
+	f = fetcher{
+		httpClient: &mock,
+	}
+	_, _, err = f.download(expected_url)
+	is.Equal(err.Error(), "unexpected status downloading url: 404")
+}
+
+func TestFetcherValidate(t *testing.T) {
+	is := is.New(t)
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	is.NoErr(err)
+
+	// With no error
+	var got_url string
+	var got_sig_data string
+	mock_http := MockHTTPClient{
+		fnDo: func(req *http.Request) (*http.Response, error) {
+			got_url = req.URL.String()
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader("testsignature")),
+				StatusCode: http.StatusOK,
+			}, nil
+		},
+	}
+	mock_pgp := MockPGPClient{
+		fnReadArmoredKeyRing: func(r io.Reader) (openpgp.EntityList, error) {
+			return openpgp.EntityList{}, nil
+		},
+		fnCheckDetachedSignature: func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+			data, _ := io.ReadAll(signature)
+			got_sig_data = string(data)
+			return entity, nil
+		},
+	}
+
+	f := fetcher{
+		httpClient: &mock_http,
+	}
+	verifier := pgp.NewVerifier(&mock_pgp, pgp.HashiCorpKey)
+	signer, err := f.validate(strings.NewReader("test"), "url", verifier)
+	is.NoErr(err)
+	is.Equal(got_url, "url.sig")
+	is.Equal(got_sig_data, "testsignature")
+	is.Equal(signer, pgp.NewSigner(entity))
+
+	// With failed validation
+	mock_pgp.fnCheckDetachedSignature = func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	_, err = f.validate(strings.NewReader("test"), "url", verifier)
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+}
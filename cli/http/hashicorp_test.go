@@ -0,0 +1,120 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestHashiCorpFetch(t *testing.T) {
+	is := is.New(t)
+	expected_url := fmt.Sprintf(releasesURL, "consul", "1.10.3", "consul_1.10.3_linux_amd64.zip")
+
+	var got_url string
+	mock := MockHTTPClient{
+		fnDo: func(req *http.Request) (*http.Response, error) {
+			got_url = req.URL.String()
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader("test")),
+				StatusCode: http.StatusOK,
+			}, nil
+		},
+	}
+
+	provider := HashiCorpProvider{
+		fetcher: fetcher{
+			httpClient: &mock,
+		},
+	}
+	_, _, err := provider.Fetch("consul", "1.10.3", "linux", "amd64")
+	is.NoErr(err)
+	is.Equal(expected_url, got_url)
+}
+
+func TestHashiCorpResolve(t *testing.T) {
+	is := is.New(t)
+
+	provider := HashiCorpProvider{}
+	source, err := provider.Resolve("vault", "1.8.4", "linux", "arm64")
+	is.NoErr(err)
+	is.Equal(source.URL, fmt.Sprintf(releasesURL, "vault", "1.8.4", "vault_1.8.4_linux_arm64.zip"))
+	is.Equal(source.Version, "1.8.4")
+}
+
+func TestHashiCorpValidate(t *testing.T) {
+	is := is.New(t)
+	expected_data := "test"
+	hash := sha256.Sum256([]byte(expected_data))
+	expected_sums := fmt.Sprintf("%s  consul_1.10.3_linux_amd64.zip\n%s  consul_1.10.3_darwin_amd64.zip\n",
+		hex.EncodeToString(hash[:]), strings.Repeat("0", 64))
+	expected_sums_url := fmt.Sprintf(releasesURL, "consul", "1.10.3", "consul_1.10.3_SHA256SUMS")
+
+	got_urls := []string{}
+	mock_http := MockHTTPClient{
+		fnDo: func(req *http.Request) (*http.Response, error) {
+			got_urls = append(got_urls, req.URL.String())
+			body := expected_sums
+			if strings.HasSuffix(req.URL.String(), ".sig") {
+				body = "testsignature"
+			}
+			return &http.Response{
+				Body:       io.NopCloser(strings.NewReader(body)),
+				StatusCode: http.StatusOK,
+			}, nil
+		},
+	}
+
+	var got_pub_key string
+	var got_sums string
+	mock_pgp := MockPGPClient{
+		fnReadArmoredKeyRing: func(r io.Reader) (openpgp.EntityList, error) {
+			data, _ := io.ReadAll(r)
+			got_pub_key = string(data)
+			return openpgp.EntityList{}, nil
+		},
+		fnCheckDetachedSignature: func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+			data, _ := io.ReadAll(signed)
+			got_sums = string(data)
+			return nil, nil
+		},
+	}
+
+	// With no error
+	provider := HashiCorpProvider{
+		fetcher: fetcher{
+			httpClient: &mock_http,
+		},
+		verifier: pgp.NewVerifier(&mock_pgp, pgp.HashiCorpKey),
+	}
+	_, err := provider.Validate(io.NopCloser(strings.NewReader(expected_data)), "consul", "1.10.3", "linux", "amd64")
+	is.NoErr(err)
+	is.Equal(got_urls, []string{expected_sums_url, expected_sums_url + ".sig"})
+	is.Equal(got_pub_key, pgp.HashiCorpKey)
+	is.Equal(got_sums, expected_sums)
+
+	// With checksum mismatch
+	_, err = provider.Validate(io.NopCloser(strings.NewReader("tampered")), "consul", "1.10.3", "linux", "amd64")
+	is.True(errors.Is(err, gcli.ErrChecksumMismatch))
+
+	// With missing checksum
+	_, err = provider.Validate(io.NopCloser(strings.NewReader(expected_data)), "consul", "1.10.3", "linux", "arm64")
+	is.Equal(err.Error(), "no checksum published for consul_1.10.3_linux_arm64.zip")
+
+	// With failed validation
+	mock_pgp.fnCheckDetachedSignature = func(keyring openpgp.KeyRing, signed, signature io.Reader) (*openpgp.Entity, error) {
+		return nil, fmt.Errorf("failed")
+	}
+
+	_, err = provider.Validate(io.NopCloser(strings.NewReader(expected_data)), "consul", "1.10.3", "linux", "amd64")
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+}
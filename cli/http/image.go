@@ -3,112 +3,75 @@ package http
 import (
 	"fmt"
 	"io"
-	"net/http"
-	"strings"
 
 	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/openpgp"
 )
 
-var baseURL string = "https://%s.release.flatcar-linux.net/%s-usr/current/%s"
+var baseURL string = "https://%s.release.flatcar-linux.net/%s-usr/%s/%s"
 
-// httpClient is an interface for processing HTTP requests and returning HTTP
-// responses.
-type httpClient interface {
-	// Do sends an HTTP request and returns an HTTP response.
-	Do(req *http.Request) (*http.Response, error)
-}
-
-// pgpClient is an interface for validating blobs of signed data using PGP keys.
-type pgpClient interface {
-	// ReadArmoredKeyRing reads one or more public/private keys from an armor
-	// keyring file.
-	ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error)
-
-	// CheckDetachedSignature takes a signed file and a detached signature and
-	// returns the signer if the signature is valid. If the signer isn't known,
-	// ErrUnknownIssuer is returned.
-	CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error)
-}
-
-// ImageProvider implements cli.ImageProvider using an httpClient and pgpClient.
+// ImageProvider implements cli.ImageProvider by downloading images from the
+// upstream release servers.
 type ImageProvider struct {
-	httpClient httpClient
-	pgpClient  pgpClient
+	fetcher
+	verifier gcli.Verifier
 }
 
-// openpgpClient implements pgpClient using the openpgp package.
-type openpgpClient struct{}
-
-func (o *openpgpClient) ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error) {
-	return openpgp.ReadArmoredKeyRing(r)
+// buildUrl returns the fully qualified URL to the requested Container Linux
+// production image file from the current release.
+func (i *ImageProvider) buildURL(channel string, arch string, filename string) string {
+	return i.buildVersionURL(channel, arch, "current", filename)
 }
 
-func (o *openpgpClient) CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error) {
-	return openpgp.CheckDetachedSignature(keyring, signed, signature)
+// buildVersionURL returns the fully qualified URL to the requested Container
+// Linux production image file from the given release.
+func (i *ImageProvider) buildVersionURL(channel string, arch string, version string, filename string) string {
+	return fmt.Sprintf(baseURL, channel, arch, version, filename)
 }
 
-// buildUrl returns the fully qualified URL to the requested Container Linux
-// production image file.
-func (i *ImageProvider) buildURL(channel string, arch string, filename string) string {
-	return fmt.Sprintf(baseURL, channel, arch, filename)
+func (i *ImageProvider) Fetch(source gcli.Source) (io.ReadCloser, int64, error) {
+	return i.download(source.URL)
 }
 
-// download downloads the remote file at the given URL, returning a stream of
-// data and it's expected size.
-func (i *ImageProvider) download(url string) (io.ReadCloser, int64, error) {
-	log.Info("Sending request to %s", url)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	resp, err := i.httpClient.Do(req)
+func (i *ImageProvider) Resolve(channel, arch, filename string) (gcli.Source, error) {
+	data, _, err := i.download(i.buildURL(channel, arch, "version.txt"))
 	if err != nil {
-		return nil, 0, err
+		log.Errorf("Error downloading version file: %s", err)
+		return gcli.Source{}, err
 	}
+	defer data.Close()
 
-	log.WithFields(log.Fields{
-		"status": resp.StatusCode,
-		"length": resp.ContentLength,
-	}).Debug("Response received")
-
-	return resp.Body, resp.ContentLength, nil
-}
+	version, err := gcli.ParseImageVersion(data)
+	if err != nil {
+		return gcli.Source{}, err
+	}
 
-func (i *ImageProvider) Fetch(channel, arch, filename string) (io.ReadCloser, int64, error) {
-	return i.download(i.buildURL(channel, arch, filename))
+	return gcli.Source{
+		URL:     i.buildVersionURL(channel, arch, version, filename),
+		Version: version,
+	}, nil
 }
 
-func (i *ImageProvider) Validate(data io.ReadCloser, channel, arch, filename string) error {
+func (i *ImageProvider) Validate(data io.ReadCloser, source gcli.Source) (gcli.Signer, error) {
 	log.WithFields(log.Fields{
-		"channel":      channel,
-		"architecture": arch,
-		"filename":     filename,
+		"url":     source.URL,
+		"version": source.Version,
 	}).Debug("Validating file with signature")
-	url := fmt.Sprintf("%s.sig", i.buildURL(channel, arch, filename))
-
-	sig, _, err := i.download(url)
-	if err != nil {
-		log.Error("Error downloading signature file: %s", err)
-		return err
-	}
 
-	keyring, err := i.pgpClient.ReadArmoredKeyRing(strings.NewReader(publicKey))
-	if err != nil {
-		log.Error("Error parsing PGP public key: %s", err)
-		return err
-	}
+	return i.validate(data, source.URL, i.verifier)
+}
 
-	_, err = i.pgpClient.CheckDetachedSignature(keyring, data, sig)
-	if err != nil {
-		log.Error("Error validating signature: %s", err)
-		return gcli.ErrSigCheckFailed
+// NewImageProvider returns an ImageProvider which validates images using the
+// given verifier. If no verifier is given, images are validated against the
+// Flatcar image signing key.
+func NewImageProvider(verifier gcli.Verifier) gcli.ImageProvider {
+	if verifier == nil {
+		verifier = pgp.NewVerifier(&pgp.OpenPGPClient{}, pgp.FlatcarKey)
 	}
 
-	return nil
-}
-
-func NewImageProvider() gcli.ImageProvider {
 	return &ImageProvider{
-		httpClient: &http.Client{},
-		pgpClient:  &openpgpClient{},
+		fetcher:  newFetcher(),
+		verifier: verifier,
 	}
 }
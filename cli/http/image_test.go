@@ -9,112 +9,92 @@ import (
 	"testing"
 
 	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/HomeOperations/jmgilman/cli/pgp"
 	"github.com/matryer/is"
 	"golang.org/x/crypto/openpgp"
 )
 
-type MockHTTPClient struct {
-	fnDo func(req *http.Request) (*http.Response, error)
-}
-
-func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
-	return m.fnDo(req)
-}
-
-type MockPGPClient struct {
-	fnReadArmoredKeyRing     func(r io.Reader) (openpgp.EntityList, error)
-	fnCheckDetachedSignature func(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error)
-}
-
-func (m *MockPGPClient) ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error) {
-	return m.fnReadArmoredKeyRing(r)
-}
-
-func (m *MockPGPClient) CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error) {
-	return m.fnCheckDetachedSignature(keyring, signed, signature)
-}
-
 func TestBuildURL(t *testing.T) {
 	is := is.New(t)
-	expected := fmt.Sprintf(baseURL, "alpha", "arm64", "flatcar_production_image.bin.bz2")
+	expected := fmt.Sprintf(baseURL, "alpha", "arm64", "current", "flatcar_production_image.bin.bz2")
 
-	fetcher := ImageProvider{
-		httpClient: &MockHTTPClient{},
-	}
-	got := fetcher.buildURL("alpha", "arm64", "flatcar_production_image.bin.bz2")
+	provider := ImageProvider{}
+	got := provider.buildURL("alpha", "arm64", "flatcar_production_image.bin.bz2")
 	is.Equal(expected, got)
 }
 
-func TestDownload(t *testing.T) {
+func TestFetch(t *testing.T) {
 	is := is.New(t)
-	expected_data := "test"
-	expected_size := 1024
-	expected_url := "url"
+	expected_url := fmt.Sprintf(baseURL, "alpha", "arm64", "3033.1.0", "flatcar_production_image.bin.bz2")
 
-	// With no error
 	var got_url string
 	mock := MockHTTPClient{
 		fnDo: func(req *http.Request) (*http.Response, error) {
 			got_url = req.URL.String()
 			return &http.Response{
-				Body:          io.NopCloser(strings.NewReader(expected_data)),
-				ContentLength: int64(expected_size),
+				Body:       io.NopCloser(strings.NewReader("test")),
+				StatusCode: http.StatusOK,
 			}, nil
 		},
 	}
 
-	fetcher := ImageProvider{
-		httpClient: &mock,
+	provider := ImageProvider{
+		fetcher: fetcher{
+			httpClient: &mock,
+		},
 	}
-	res, size, err := fetcher.download(expected_url)
+	_, _, err := provider.Fetch(gcli.Source{URL: expected_url, Version: "3033.1.0"})
 	is.NoErr(err)
 	is.Equal(expected_url, got_url)
-	is.Equal(int64(expected_size), size)
-
-	res_data, err := io.ReadAll(res)
-	is.NoErr(err)
-	is.Equal(expected_data, string(res_data))
-
-	// With error
-	mock = MockHTTPClient{
-		fnDo: func(req *http.Request) (*http.Response, error) {
-			return nil, fmt.Errorf("error")
-		},
-	}
-
-	fetcher = ImageProvider{
-		httpClient: &mock,
-	}
-	_, _, err = fetcher.download(expected_url)
-	is.Equal(err.Error(), "error")
 }
 
-func TestFetch(t *testing.T) {
+func TestResolve(t *testing.T) {
 	is := is.New(t)
-	expected_url := fmt.Sprintf(baseURL, "alpha", "arm64", "flatcar_production_image.bin.bz2")
+	expected_url := fmt.Sprintf(baseURL, "alpha", "arm64", "current", "version.txt")
 
+	// With no error
 	var got_url string
 	mock := MockHTTPClient{
 		fnDo: func(req *http.Request) (*http.Response, error) {
 			got_url = req.URL.String()
 			return &http.Response{
-				Body: io.NopCloser(strings.NewReader("test")),
+				Body:       io.NopCloser(strings.NewReader("FLATCAR_BUILD=3033\nFLATCAR_VERSION=3033.1.0\nFLATCAR_VERSION_ID=3033.1.0\n")),
+				StatusCode: http.StatusOK,
 			}, nil
 		},
 	}
 
-	fetcher := ImageProvider{
-		httpClient: &mock,
+	provider := ImageProvider{
+		fetcher: fetcher{
+			httpClient: &mock,
+		},
 	}
-	_, _, err := fetcher.Fetch("alpha", "arm64", "flatcar_production_image.bin.bz2")
+	source, err := provider.Resolve("alpha", "arm64", "flatcar_production_image.bin.bz2")
 	is.NoErr(err)
 	is.Equal(expected_url, got_url)
+	is.Equal(source.Version, "3033.1.0")
+	is.Equal(source.URL, fmt.Sprintf(baseURL, "alpha", "arm64", "3033.1.0", "flatcar_production_image.bin.bz2"))
+
+	// With invalid version file
+	mock.fnDo = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Body:       io.NopCloser(strings.NewReader("invalid")),
+			StatusCode: http.StatusOK,
+		}, nil
+	}
+
+	_, err = provider.Resolve("alpha", "arm64", "flatcar_production_image.bin.bz2")
+	is.Equal(err.Error(), "version file does not contain FLATCAR_VERSION")
 }
 
 func TestValidate(t *testing.T) {
 	is := is.New(t)
-	expected_url := fmt.Sprintf("%s.sig", fmt.Sprintf(baseURL, "alpha", "arm64", "flatcar_production_image.bin.bz2"))
-	expected_pub_key := publicKey
+	expected_source := gcli.Source{
+		URL:     fmt.Sprintf(baseURL, "alpha", "arm64", "3033.1.0", "flatcar_production_image.bin.bz2"),
+		Version: "3033.1.0",
+	}
+	expected_url := fmt.Sprintf("%s.sig", expected_source.URL)
+	expected_pub_key := pgp.FlatcarKey
 	expected_data := "test"
 	expected_sig_data := "testsignature"
 
@@ -123,7 +103,8 @@ func TestValidate(t *testing.T) {
 		fnDo: func(req *http.Request) (*http.Response, error) {
 			got_url = req.URL.String()
 			return &http.Response{
-				Body: io.NopCloser(strings.NewReader(expected_sig_data)),
+				Body:       io.NopCloser(strings.NewReader(expected_sig_data)),
+				StatusCode: http.StatusOK,
 			}, nil
 		},
 	}
@@ -149,11 +130,13 @@ func TestValidate(t *testing.T) {
 	}
 
 	// With no error
-	fetcher := ImageProvider{
-		httpClient: &mock_http,
-		pgpClient:  &mock_pgp,
+	provider := ImageProvider{
+		fetcher: fetcher{
+			httpClient: &mock_http,
+		},
+		verifier: pgp.NewVerifier(&mock_pgp, pgp.FlatcarKey),
 	}
-	err := fetcher.Validate(io.NopCloser(strings.NewReader(expected_data)), "alpha", "arm64", "flatcar_production_image.bin.bz2")
+	_, err := provider.Validate(io.NopCloser(strings.NewReader(expected_data)), expected_source)
 	is.NoErr(err)
 	is.Equal(expected_url, got_url)
 	is.Equal(expected_pub_key, got_pub_key)
@@ -165,10 +148,12 @@ func TestValidate(t *testing.T) {
 		return nil, fmt.Errorf("failed")
 	}
 
-	fetcher = ImageProvider{
-		httpClient: &mock_http,
-		pgpClient:  &mock_pgp,
+	provider = ImageProvider{
+		fetcher: fetcher{
+			httpClient: &mock_http,
+		},
+		verifier: pgp.NewVerifier(&mock_pgp, pgp.FlatcarKey),
 	}
-	err = fetcher.Validate(io.NopCloser(strings.NewReader(expected_data)), "alpha", "arm64", "flatcar_production_image.bin.bz2")
+	_, err = provider.Validate(io.NopCloser(strings.NewReader(expected_data)), expected_source)
 	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
 }
@@ -1,18 +1,52 @@
 package cli
 
 import (
+	"bufio"
 	"errors"
 	"io"
+	"strings"
 )
 
 var ErrSigCheckFailed = errors.New("signature check failed")
 
 type ImageProvider interface {
 	// Fetch returns a network stream containing the contents of the production
-	// Container Linux image at the given channel for the given architecture.
-	Fetch(channel, arch, filename string) (io.ReadCloser, int64, error)
+	// Container Linux image at the given source, as returned by Resolve.
+	Fetch(source Source) (io.ReadCloser, int64, error)
+
+	// Resolve returns the location and version of the production Container
+	// Linux image currently published at the given channel for the given
+	// architecture.
+	Resolve(channel, arch, filename string) (Source, error)
 
 	// Validate takes a stream containing a Container Linux image and validates it
-	// against the remote PGP signature for the given channel and architecture.
-	Validate(data io.ReadCloser, channel, arch, filename string) error
+	// against the remote PGP signature published alongside the given source.
+	Validate(data io.ReadCloser, source Source) (Signer, error)
+}
+
+// ImagePublisher represents a backend capable of storing Container Linux images
+// using the same layout as the upstream release servers.
+type ImagePublisher interface {
+	// Publish validates the given Container Linux image against the given PGP
+	// signature and then stores both at the given channel for the given
+	// architecture.
+	Publish(data io.ReadSeeker, signature io.ReadSeeker, channel, arch, filename string) error
+}
+
+// ParseImageVersion reads the version.txt file published alongside Container
+// Linux images and returns the version it contains.
+func ParseImageVersion(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) == 2 && parts[0] == "FLATCAR_VERSION" {
+			return parts[1], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.New("version file does not contain FLATCAR_VERSION")
 }
@@ -0,0 +1,173 @@
+package lock
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// Filename is the default name of the lockfile.
+const Filename = "boots.lock"
+
+// version is the current version of the lockfile format.
+const version = 1
+
+var ErrLockMismatch = errors.New("artifact does not match lockfile")
+var ErrNotLocked = errors.New("artifact not found in lockfile")
+
+// Entry records the exact artifact which was fetched from a remote source.
+type Entry struct {
+	Source  string            `json:"source"`
+	Version string            `json:"version"`
+	Size    int64             `json:"size"`
+	Digests map[string]string `json:"digests"`
+	Signer  string            `json:"signer"`
+}
+
+// Lockfile is an authoritative record of every artifact fetched by boots,
+// keyed by a name unique to each artifact.
+type Lockfile struct {
+	Version   int              `json:"version"`
+	Artifacts map[string]Entry `json:"artifacts"`
+}
+
+// Check returns an error if the given entry doesn't match the entry recorded
+// under the given name. Only the version and digests are compared as the
+// source and signer are not guaranteed to be stable across mirrors.
+func (l *Lockfile) Check(name string, entry Entry) error {
+	if err := l.CheckVersion(name, entry.Version); err != nil {
+		return err
+	}
+
+	locked := l.Artifacts[name]
+	if len(locked.Digests) == 0 {
+		return fmt.Errorf("%w: %s: no digests recorded", ErrLockMismatch, name)
+	}
+
+	for alg, digest := range locked.Digests {
+		if entry.Digests[alg] != digest {
+			return fmt.Errorf("%w: %s: expected %s digest %s, got %s", ErrLockMismatch, name, alg, digest, entry.Digests[alg])
+		}
+	}
+
+	return nil
+}
+
+// CheckVersion returns an error if the given version doesn't match the version
+// recorded under the given name. This allows a resolved artifact to be
+// rejected before it's downloaded.
+func (l *Lockfile) CheckVersion(name string, version string) error {
+	locked, ok := l.Artifacts[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotLocked, name)
+	}
+
+	if locked.Version != "" && locked.Version != version {
+		return fmt.Errorf("%w: %s: expected version %s, got %s", ErrLockMismatch, name, locked.Version, version)
+	}
+
+	return nil
+}
+
+// Set records the given entry under the given name, replacing any existing
+// entry.
+func (l *Lockfile) Set(name string, entry Entry) {
+	l.Artifacts[name] = entry
+}
+
+// Save writes the lockfile to the given path. The lockfile is first written to
+// a temporary file which then replaces the given path.
+func (l *Lockfile) Save(fs afero.Fs, path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.tmp", filepath.Base(path)))
+	if err := afero.WriteFile(fs, tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	return fs.Rename(tmp, path)
+}
+
+// Load reads the lockfile at the given path. An empty lockfile is returned if
+// the path doesn't exist.
+func Load(fs afero.Fs, path string) (*Lockfile, error) {
+	l := &Lockfile{
+		Version:   version,
+		Artifacts: make(map[string]Entry),
+	}
+
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return l, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("error parsing lockfile: %s", err)
+	}
+
+	if l.Version != version {
+		return nil, fmt.Errorf("unsupported lockfile version: %d", l.Version)
+	}
+
+	if l.Artifacts == nil {
+		l.Artifacts = make(map[string]Entry)
+	}
+
+	return l, nil
+}
+
+// Digester is an io.Writer which computes the digests recorded in a lockfile
+// for all data written to it.
+type Digester struct {
+	hashes map[string]hash.Hash
+	writer io.Writer
+}
+
+func (d *Digester) Write(p []byte) (int, error) {
+	return d.writer.Write(p)
+}
+
+// Digests returns the hex encoded digests of all data written so far, keyed by
+// algorithm.
+func (d *Digester) Digests() map[string]string {
+	result := make(map[string]string)
+	for alg, h := range d.hashes {
+		result[alg] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return result
+}
+
+// NewDigester returns a new Digester.
+func NewDigester() *Digester {
+	hashes := map[string]hash.Hash{
+		"sha256": sha256.New(),
+		"sha512": sha512.New(),
+	}
+
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+
+	return &Digester{
+		hashes: hashes,
+		writer: io.MultiWriter(writers...),
+	}
+}
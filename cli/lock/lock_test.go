@@ -0,0 +1,102 @@
+package lock
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+)
+
+func TestLoadSave(t *testing.T) {
+	is := is.New(t)
+	fs := afero.NewMemMapFs()
+
+	// With missing lockfile
+	l, err := Load(fs, Filename)
+	is.NoErr(err)
+	is.Equal(l.Version, version)
+	is.Equal(len(l.Artifacts), 0)
+
+	// With saved lockfile
+	expected := Entry{
+		Source:  "https://example.com/file",
+		Version: "1.0.0",
+		Size:    4,
+		Digests: map[string]string{"sha256": "test"},
+		Signer:  "ABCD",
+	}
+	l.Set("test", expected)
+	is.NoErr(l.Save(fs, Filename))
+
+	l, err = Load(fs, Filename)
+	is.NoErr(err)
+	is.Equal(l.Artifacts["test"], expected)
+
+	exists, err := afero.Exists(fs, ".boots.lock.tmp")
+	is.NoErr(err)
+	is.True(!exists)
+
+	// With unsupported version
+	afero.WriteFile(fs, Filename, []byte(`{"version": 2}`), 0644)
+	_, err = Load(fs, Filename)
+	is.Equal(err.Error(), "unsupported lockfile version: 2")
+
+	// With invalid lockfile
+	afero.WriteFile(fs, Filename, []byte(`invalid`), 0644)
+	_, err = Load(fs, Filename)
+	is.True(err != nil)
+}
+
+func TestCheck(t *testing.T) {
+	is := is.New(t)
+	entry := Entry{
+		Version: "1.0.0",
+		Digests: map[string]string{"sha256": "abc", "sha512": "def"},
+	}
+	l := Lockfile{
+		Version:   version,
+		Artifacts: map[string]Entry{"test": entry},
+	}
+
+	// With matching entry
+	is.NoErr(l.Check("test", entry))
+
+	// With missing entry
+	err := l.Check("missing", entry)
+	is.True(errors.Is(err, ErrNotLocked))
+
+	// With mismatched version
+	err = l.Check("test", Entry{Version: "1.0.1", Digests: entry.Digests})
+	is.True(errors.Is(err, ErrLockMismatch))
+
+	// With version only
+	is.NoErr(l.CheckVersion("test", "1.0.0"))
+	err = l.CheckVersion("test", "1.0.1")
+	is.Equal(err.Error(), "artifact does not match lockfile: test: expected version 1.0.0, got 1.0.1")
+	err = l.CheckVersion("missing", "1.0.0")
+	is.True(errors.Is(err, ErrNotLocked))
+
+	// With mismatched digest
+	err = l.Check("test", Entry{Version: "1.0.0", Digests: map[string]string{"sha256": "abc", "sha512": "xyz"}})
+	is.True(errors.Is(err, ErrLockMismatch))
+
+	// With no recorded digests
+	l.Artifacts["test"] = Entry{Version: "1.0.0"}
+	err = l.Check("test", entry)
+	is.True(errors.Is(err, ErrLockMismatch))
+}
+
+func TestDigester(t *testing.T) {
+	is := is.New(t)
+
+	d := NewDigester()
+	_, err := io.Copy(d, strings.NewReader("test"))
+	is.NoErr(err)
+
+	digests := d.Digests()
+	is.Equal(digests["sha256"], "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+	is.Equal(digests["sha512"], "ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db27ac185f8a0e1d5f84f88bc887fd67b143732c304cc5fa9ad8e6f57f50028a8ff")
+}
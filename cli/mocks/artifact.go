@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"io"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+)
+
+type MockArtifactProvider struct {
+	FnFetch    func(product, version, os, arch string) (io.ReadCloser, int64, error)
+	FnResolve  func(product, version, os, arch string) (gcli.Source, error)
+	FnValidate func(data io.ReadCloser, product, version, os, arch string) (gcli.Signer, error)
+}
+
+func (m *MockArtifactProvider) Fetch(product, version, os, arch string) (io.ReadCloser, int64, error) {
+	return m.FnFetch(product, version, os, arch)
+}
+
+func (m *MockArtifactProvider) Resolve(product, version, os, arch string) (gcli.Source, error) {
+	return m.FnResolve(product, version, os, arch)
+}
+
+func (m *MockArtifactProvider) Validate(data io.ReadCloser, product, version, os, arch string) (gcli.Signer, error) {
+	return m.FnValidate(data, product, version, os, arch)
+}
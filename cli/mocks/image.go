@@ -1,16 +1,33 @@
 package mocks
 
-import "io"
+import (
+	"io"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+)
 
 type MockImageProvider struct {
-	FnFetch    func(channel, arch, filename string) (io.ReadCloser, int64, error)
-	FnValidate func(data io.ReadCloser, channel, arch, filename string) error
+	FnFetch    func(source gcli.Source) (io.ReadCloser, int64, error)
+	FnResolve  func(channel, arch, filename string) (gcli.Source, error)
+	FnValidate func(data io.ReadCloser, source gcli.Source) (gcli.Signer, error)
+}
+
+func (m *MockImageProvider) Fetch(source gcli.Source) (io.ReadCloser, int64, error) {
+	return m.FnFetch(source)
+}
+
+func (m *MockImageProvider) Resolve(channel, arch, filename string) (gcli.Source, error) {
+	return m.FnResolve(channel, arch, filename)
+}
+
+func (m *MockImageProvider) Validate(data io.ReadCloser, source gcli.Source) (gcli.Signer, error) {
+	return m.FnValidate(data, source)
 }
 
-func (m *MockImageProvider) Fetch(channel, arch, filename string) (io.ReadCloser, int64, error) {
-	return m.FnFetch(channel, arch, filename)
+type MockImagePublisher struct {
+	FnPublish func(data io.ReadSeeker, signature io.ReadSeeker, channel, arch, filename string) error
 }
 
-func (m *MockImageProvider) Validate(data io.ReadCloser, channel, arch, filename string) error {
-	return m.FnValidate(data, channel, arch, filename)
+func (m *MockImagePublisher) Publish(data io.ReadSeeker, signature io.ReadSeeker, channel, arch, filename string) error {
+	return m.FnPublish(data, signature, channel, arch, filename)
 }
@@ -1,20 +1,19 @@
 package mocks
 
+import (
+	gcli "github.com/HomeOperations/jmgilman/cli"
+)
+
 type MockSecretProvider struct {
-	FnDelete   func(key string) error
-	FnGenerate func(key string, length int, nums int, symbols int) (string, error)
-	FnGet      func(key string) (string, error)
-	FnSet      func(key string, value string) error
+	FnDelete func(key string) error
+	FnGet    func(key string) (string, error)
+	FnSet    func(key string, value string) error
 }
 
 func (m *MockSecretProvider) Delete(key string) error {
 	return m.FnDelete(key)
 }
 
-func (m *MockSecretProvider) Generate(key string, length int, nums int, symbols int) (string, error) {
-	return m.FnGenerate(key, length, nums, symbols)
-}
-
 func (m *MockSecretProvider) Get(key string) (string, error) {
 	return m.FnGet(key)
 }
@@ -22,3 +21,67 @@ func (m *MockSecretProvider) Get(key string) (string, error) {
 func (m *MockSecretProvider) Set(key string, value string) error {
 	return m.FnSet(key, value)
 }
+
+type MockSecretCreator struct {
+	MockSecretProvider
+	FnCreate func(key string, value string) error
+}
+
+func (m *MockSecretCreator) Create(key string, value string) error {
+	return m.FnCreate(key, value)
+}
+
+type MockSecretAnnotatedCreator struct {
+	MockSecretAnnotator
+	FnCreateAnnotated func(key string, value string, description string, tags map[string]string) error
+}
+
+func (m *MockSecretAnnotatedCreator) CreateAnnotated(key string, value string, description string, tags map[string]string) error {
+	return m.FnCreateAnnotated(key, value, description, tags)
+}
+
+type MockSecretLister struct {
+	MockSecretProvider
+	FnList func(prefix string, recursive bool) ([]gcli.SecretMetadata, error)
+}
+
+func (m *MockSecretLister) List(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+	return m.FnList(prefix, recursive)
+}
+
+type MockSecretTagFilter struct {
+	MockSecretLister
+	FnListTagged func(prefix string, recursive bool, tags map[string]string) ([]gcli.SecretMetadata, error)
+}
+
+func (m *MockSecretTagFilter) ListTagged(prefix string, recursive bool, tags map[string]string) ([]gcli.SecretMetadata, error) {
+	return m.FnListTagged(prefix, recursive, tags)
+}
+
+type MockSecretVersioner struct {
+	MockSecretProvider
+	FnGetVersion func(key string, version int64) (string, error)
+	FnHistory    func(key string) ([]gcli.SecretVersion, error)
+}
+
+func (m *MockSecretVersioner) GetVersion(key string, version int64) (string, error) {
+	return m.FnGetVersion(key, version)
+}
+
+func (m *MockSecretVersioner) History(key string) ([]gcli.SecretVersion, error) {
+	return m.FnHistory(key)
+}
+
+type MockSecretAnnotator struct {
+	MockSecretLister
+	FnDescribe     func(key string) (gcli.SecretMetadata, error)
+	FnSetAnnotated func(key string, value string, description string, tags map[string]string) error
+}
+
+func (m *MockSecretAnnotator) Describe(key string) (gcli.SecretMetadata, error) {
+	return m.FnDescribe(key)
+}
+
+func (m *MockSecretAnnotator) SetAnnotated(key string, value string, description string, tags map[string]string) error {
+	return m.FnSetAnnotated(key, value, description, tags)
+}
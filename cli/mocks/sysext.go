@@ -0,0 +1,9 @@
+package mocks
+
+type MockPacker struct {
+	FnPack func(dir string, output string) error
+}
+
+func (m *MockPacker) Pack(dir string, output string) error {
+	return m.FnPack(dir, output)
+}
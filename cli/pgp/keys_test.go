@@ -0,0 +1,19 @@
+package pgp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestKeys(t *testing.T) {
+	is := is.New(t)
+	client := OpenPGPClient{}
+
+	for _, key := range []string{FlatcarKey, HashiCorpKey} {
+		keyring, err := client.ReadArmoredKeyRing(strings.NewReader(key))
+		is.NoErr(err)
+		is.Equal(len(keyring), 1)
+	}
+}
@@ -0,0 +1,130 @@
+package pgp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Client is an interface for validating blobs of signed data using PGP keys.
+type Client interface {
+	// ReadArmoredKeyRing reads one or more public/private keys from an armor
+	// keyring file.
+	ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error)
+
+	// CheckDetachedSignature takes a signed file and a detached signature and
+	// returns the signer if the signature is valid. If the signer isn't known,
+	// ErrUnknownIssuer is returned.
+	CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error)
+}
+
+// OpenPGPClient implements Client using the openpgp package.
+type OpenPGPClient struct{}
+
+func (o *OpenPGPClient) ReadArmoredKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	return openpgp.ReadArmoredKeyRing(r)
+}
+
+func (o *OpenPGPClient) CheckDetachedSignature(keyring openpgp.KeyRing, signed io.Reader, signature io.Reader) (signer *openpgp.Entity, err error) {
+	return openpgp.CheckDetachedSignature(keyring, signed, signature)
+}
+
+// Verifier implements cli.Verifier by validating detached PGP signatures
+// against a single armored public key.
+type Verifier struct {
+	client Client
+	key    string
+}
+
+func (v *Verifier) Extension() string {
+	return ".sig"
+}
+
+func (v *Verifier) Verify(data io.Reader, signature io.Reader) (gcli.Signer, error) {
+	keyring, err := v.client.ReadArmoredKeyRing(strings.NewReader(v.key))
+	if err != nil {
+		log.Errorf("Error parsing PGP public key: %s", err)
+		return gcli.Signer{}, err
+	}
+
+	signer, err := v.client.CheckDetachedSignature(keyring, data, signature)
+	if err != nil {
+		log.Errorf("Error validating signature: %s", err)
+		return gcli.Signer{}, gcli.ErrSigCheckFailed
+	}
+
+	return NewSigner(signer), nil
+}
+
+// NewVerifier returns a Verifier which validates signatures against the given
+// armored public key using the given Client.
+func NewVerifier(client Client, key string) *Verifier {
+	return &Verifier{
+		client: client,
+		key:    key,
+	}
+}
+
+// Sign writes a detached binary signature of the given data to signature using
+// the first private key found in the given armored keyring. Encrypted private
+// keys are decrypted with the given passphrase.
+func Sign(key io.Reader, passphrase string, data io.Reader, signature io.Writer) (gcli.Signer, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(key)
+	if err != nil {
+		return gcli.Signer{}, fmt.Errorf("error parsing PGP private key: %s", err)
+	}
+
+	var entity *openpgp.Entity
+	for _, e := range keyring {
+		if e.PrivateKey != nil {
+			entity = e
+			break
+		}
+	}
+	if entity == nil {
+		return gcli.Signer{}, errors.New("keyring does not contain a private key")
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return gcli.Signer{}, fmt.Errorf("error decrypting PGP private key: %s", err)
+		}
+	}
+
+	if err := openpgp.DetachSign(signature, entity, data, nil); err != nil {
+		return gcli.Signer{}, err
+	}
+
+	return NewSigner(entity), nil
+}
+
+// NewSigner returns a cli.Signer describing the given PGP entity.
+func NewSigner(entity *openpgp.Entity) gcli.Signer {
+	if entity == nil || entity.PrimaryKey == nil {
+		return gcli.Signer{}
+	}
+
+	var identity string
+	names := make([]string, 0, len(entity.Identities))
+	for name, id := range entity.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			identity = name
+		}
+		names = append(names, name)
+	}
+	if identity == "" && len(names) > 0 {
+		sort.Strings(names)
+		identity = names[0]
+	}
+
+	return gcli.Signer{
+		Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+		Identity:    identity,
+	}
+}
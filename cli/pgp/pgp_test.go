@@ -0,0 +1,88 @@
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestNewSigner(t *testing.T) {
+	is := is.New(t)
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	is.NoErr(err)
+
+	signer := NewSigner(entity)
+	is.Equal(signer.Fingerprint, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint))
+	is.Equal(signer.Identity, "test <test@example.com>")
+
+	// With no entity
+	is.Equal(NewSigner(nil), gcli.Signer{})
+}
+
+func TestVerifier(t *testing.T) {
+	is := is.New(t)
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	is.NoErr(err)
+
+	key := new(bytes.Buffer)
+	w, err := armor.Encode(key, openpgp.PublicKeyType, nil)
+	is.NoErr(err)
+	is.NoErr(entity.Serialize(w))
+	is.NoErr(w.Close())
+
+	sig := new(bytes.Buffer)
+	is.NoErr(openpgp.DetachSign(sig, entity, strings.NewReader("test"), nil))
+
+	verifier := NewVerifier(&OpenPGPClient{}, key.String())
+	is.Equal(verifier.Extension(), ".sig")
+
+	// With no error
+	signer, err := verifier.Verify(strings.NewReader("test"), bytes.NewReader(sig.Bytes()))
+	is.NoErr(err)
+	is.Equal(signer, NewSigner(entity))
+
+	// With tampered data
+	_, err = verifier.Verify(strings.NewReader("tampered"), bytes.NewReader(sig.Bytes()))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+}
+
+func TestSign(t *testing.T) {
+	is := is.New(t)
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	is.NoErr(err)
+
+	private := new(bytes.Buffer)
+	w, err := armor.Encode(private, openpgp.PrivateKeyType, nil)
+	is.NoErr(err)
+	is.NoErr(entity.SerializePrivate(w, nil))
+	is.NoErr(w.Close())
+
+	public := new(bytes.Buffer)
+	w, err = armor.Encode(public, openpgp.PublicKeyType, nil)
+	is.NoErr(err)
+	is.NoErr(entity.Serialize(w))
+	is.NoErr(w.Close())
+
+	// With no error
+	sig := new(bytes.Buffer)
+	signer, err := Sign(bytes.NewReader(private.Bytes()), "", strings.NewReader("test"), sig)
+	is.NoErr(err)
+	is.Equal(signer, NewSigner(entity))
+
+	_, err = NewVerifier(&OpenPGPClient{}, public.String()).Verify(strings.NewReader("test"), sig)
+	is.NoErr(err)
+
+	// With public key only
+	_, err = Sign(bytes.NewReader(public.Bytes()), "", strings.NewReader("test"), new(bytes.Buffer))
+	is.Equal(err.Error(), "keyring does not contain a private key")
+}
@@ -0,0 +1,195 @@
+// Package pki provides a minimal certificate authority for bootstrapping TLS
+// before Vault is available to issue certificates itself. It creates root and
+// intermediate CAs and issues server and client certificates for the Consul,
+// Nomad, and Vault agents. All keys are ECDSA P-256.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// clockSkew is subtracted from the start of the validity period of new
+// certificates to tolerate hosts with slightly slow clocks.
+const clockSkew = time.Minute
+
+// Certificate is an X.509 certificate along with its private key.
+type Certificate struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// Request describes a certificate to be issued by a CA.
+type Request struct {
+	CommonName  string
+	DNSNames    []string
+	ExtKeyUsage []x509.ExtKeyUsage
+	IPAddresses []net.IP
+	TTL         time.Duration
+}
+
+// NewRootCA returns a new self-signed root CA valid for the given duration.
+func NewRootCA(commonName string, ttl time.Duration) (Certificate, error) {
+	template, err := caTemplate(commonName, ttl)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	return create(template, nil)
+}
+
+// NewIntermediateCA returns a new intermediate CA signed by this CA. The
+// intermediate may only issue leaf certificates.
+func (c Certificate) NewIntermediateCA(commonName string, ttl time.Duration) (Certificate, error) {
+	template, err := caTemplate(commonName, ttl)
+	if err != nil {
+		return Certificate{}, err
+	}
+	template.MaxPathLenZero = true
+
+	return create(template, &c)
+}
+
+// Issue returns a new leaf certificate signed by this CA.
+func (c Certificate) Issue(req Request) (Certificate, error) {
+	if req.CommonName == "" {
+		return Certificate{}, fmt.Errorf("certificate must have a common name")
+	}
+
+	template, err := baseTemplate(req.CommonName, req.TTL)
+	if err != nil {
+		return Certificate{}, err
+	}
+	template.DNSNames = req.DNSNames
+	template.ExtKeyUsage = req.ExtKeyUsage
+	template.IPAddresses = req.IPAddresses
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+
+	return create(template, &c)
+}
+
+// CertificatePEM returns the PEM encoded certificate.
+func (c Certificate) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate.Raw})
+}
+
+// KeyPEM returns the PEM encoded private key.
+func (c Certificate) KeyPEM() ([]byte, error) {
+	key, ok := c.Key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type: %T", c.Key)
+	}
+
+	data, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: data}), nil
+}
+
+// Parse returns the certificate and private key contained in the given PEM
+// encoded data.
+func Parse(certPEM []byte, keyPEM []byte) (Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return Certificate{}, fmt.Errorf("no certificate found in PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("error parsing certificate: %s", err)
+	}
+
+	block, _ = pem.Decode(keyPEM)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return Certificate{}, fmt.Errorf("no private key found in PEM data")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("error parsing private key: %s", err)
+	}
+
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !pub.Equal(key.Public()) {
+		return Certificate{}, fmt.Errorf("private key does not match certificate")
+	}
+
+	return Certificate{Certificate: cert, Key: key}, nil
+}
+
+// baseTemplate returns a certificate template common to all certificates.
+func baseTemplate(commonName string, ttl time.Duration) (*x509.Certificate, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("TTL must be greater than zero")
+	}
+
+	// Serial numbers must be unique per CA and at most 20 bytes
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		BasicConstraintsValid: true,
+		NotAfter:              now.Add(ttl),
+		NotBefore:             now.Add(-clockSkew),
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+	}, nil
+}
+
+// caTemplate returns a certificate template for a CA.
+func caTemplate(commonName string, ttl time.Duration) (*x509.Certificate, error) {
+	template, err := baseTemplate(commonName, ttl)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	return template, nil
+}
+
+// create generates a key and creates a certificate from the template signed by
+// the given parent. The certificate is self-signed if parent is nil.
+func create(template *x509.Certificate, parent *Certificate) (Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("error generating key: %s", err)
+	}
+
+	issuer, signer := template, crypto.Signer(key)
+	if parent != nil {
+		if !parent.Certificate.IsCA {
+			return Certificate{}, fmt.Errorf("%s is not a CA", parent.Certificate.Subject.CommonName)
+		}
+
+		// A certificate can't outlive the CA which issued it
+		if template.NotAfter.After(parent.Certificate.NotAfter) {
+			template.NotAfter = parent.Certificate.NotAfter
+		}
+		issuer, signer = parent.Certificate, parent.Key
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), signer)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("error creating certificate: %s", err)
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	return Certificate{Certificate: cert, Key: key}, nil
+}
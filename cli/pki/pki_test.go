@@ -0,0 +1,83 @@
+package pki
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestIssue(t *testing.T) {
+	is := is.New(t)
+
+	root, err := NewRootCA("Root CA", 24*time.Hour)
+	is.NoErr(err)
+	is.True(root.Certificate.IsCA)
+	is.Equal(root.Certificate.Issuer.CommonName, "Root CA")
+
+	intermediate, err := root.NewIntermediateCA("Intermediate CA", 48*time.Hour)
+	is.NoErr(err)
+	is.True(intermediate.Certificate.MaxPathLenZero)
+	is.Equal(intermediate.Certificate.NotAfter, root.Certificate.NotAfter)
+
+	leaf, err := intermediate.Issue(Request{
+		CommonName:  "server.dc1.consul",
+		DNSNames:    []string{"server.dc1.consul"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		TTL:         time.Hour,
+	})
+	is.NoErr(err)
+
+	// With chain verification
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Certificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate.Certificate)
+	_, err = leaf.Certificate.Verify(x509.VerifyOptions{
+		DNSName:       "server.dc1.consul",
+		Intermediates: intermediates,
+		Roots:         roots,
+	})
+	is.NoErr(err)
+
+	// With leaf as issuer
+	_, err = leaf.Issue(Request{CommonName: "test", TTL: time.Hour})
+	is.Equal(err.Error(), "server.dc1.consul is not a CA")
+
+	// With invalid request
+	_, err = intermediate.Issue(Request{CommonName: "test"})
+	is.Equal(err.Error(), "TTL must be greater than zero")
+
+	_, err = intermediate.Issue(Request{TTL: time.Hour})
+	is.Equal(err.Error(), "certificate must have a common name")
+}
+
+func TestParse(t *testing.T) {
+	is := is.New(t)
+
+	root, err := NewRootCA("Root CA", time.Hour)
+	is.NoErr(err)
+	other, err := NewRootCA("Other CA", time.Hour)
+	is.NoErr(err)
+
+	key, err := root.KeyPEM()
+	is.NoErr(err)
+
+	parsed, err := Parse(root.CertificatePEM(), key)
+	is.NoErr(err)
+	is.True(parsed.Certificate.Equal(root.Certificate))
+
+	// With mismatched key
+	_, err = Parse(other.CertificatePEM(), key)
+	is.Equal(err.Error(), "private key does not match certificate")
+
+	// With invalid data
+	_, err = Parse(key, key)
+	is.Equal(err.Error(), "no certificate found in PEM data")
+
+	_, err = Parse(root.CertificatePEM(), root.CertificatePEM())
+	is.Equal(err.Error(), "no private key found in PEM data")
+}
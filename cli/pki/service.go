@@ -0,0 +1,78 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+)
+
+// The services certificates can be issued for.
+const (
+	ServiceConsul = "consul"
+	ServiceNomad  = "nomad"
+	ServiceVault  = "vault"
+)
+
+// The roles a certificate can be issued for.
+const (
+	// RoleServer is for agents running in server mode.
+	RoleServer = "server"
+
+	// RoleClient is for agents running in client mode.
+	RoleClient = "client"
+
+	// RoleCLI is for operators and tools which only call the HTTP API.
+	RoleCLI = "cli"
+)
+
+// ServiceRequest returns a request for a certificate with the names each
+// service verifies for the given role. Consul names certificates after the
+// datacenter and Nomad after the region, so location is whichever of the two
+// applies and is ignored for Vault.
+//
+// Consul and Nomad verify that server certificates are named
+// server.<location>.<service> when verify_server_hostname is enabled, and
+// agents in both modes present their certificate to each other for RPC, so
+// they're valid for both server and client authentication.
+func ServiceRequest(service string, role string, location string, ttl time.Duration) (Request, error) {
+	req := Request{TTL: ttl}
+
+	switch service {
+	case ServiceConsul, ServiceNomad:
+		if location == "" {
+			return Request{}, fmt.Errorf("%s certificates require a location", service)
+		}
+
+		switch role {
+		case RoleServer, RoleClient:
+			req.CommonName = fmt.Sprintf("%s.%s.%s", role, location, service)
+			req.DNSNames = []string{req.CommonName, "localhost"}
+			req.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+			req.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		case RoleCLI:
+			req.CommonName = fmt.Sprintf("cli.%s.%s", location, service)
+			req.DNSNames = []string{req.CommonName}
+			req.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		default:
+			return Request{}, fmt.Errorf("unknown role: %s", role)
+		}
+	case ServiceVault:
+		switch role {
+		case RoleServer:
+			req.CommonName = "vault.service.consul"
+			req.DNSNames = []string{req.CommonName, "active.vault.service.consul", "standby.vault.service.consul", "localhost"}
+			req.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+			req.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		case RoleClient, RoleCLI:
+			req.CommonName = "client.vault"
+			req.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		default:
+			return Request{}, fmt.Errorf("unknown role: %s", role)
+		}
+	default:
+		return Request{}, fmt.Errorf("unknown service: %s", service)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,44 @@
+package pki
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestServiceRequest(t *testing.T) {
+	is := is.New(t)
+
+	req, err := ServiceRequest(ServiceConsul, RoleServer, "dc1", time.Hour)
+	is.NoErr(err)
+	is.Equal(req.CommonName, "server.dc1.consul")
+	is.Equal(req.DNSNames, []string{"server.dc1.consul", "localhost"})
+	is.Equal(req.IPAddresses[0].String(), "127.0.0.1")
+	is.Equal(req.TTL, time.Hour)
+
+	req, err = ServiceRequest(ServiceNomad, RoleClient, "global", time.Hour)
+	is.NoErr(err)
+	is.Equal(req.CommonName, "client.global.nomad")
+	is.Equal(len(req.ExtKeyUsage), 2)
+
+	req, err = ServiceRequest(ServiceNomad, RoleCLI, "global", time.Hour)
+	is.NoErr(err)
+	is.Equal(req.CommonName, "cli.global.nomad")
+	is.Equal(req.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+
+	req, err = ServiceRequest(ServiceVault, RoleServer, "", time.Hour)
+	is.NoErr(err)
+	is.Equal(req.DNSNames[1], "active.vault.service.consul")
+
+	// With invalid request
+	_, err = ServiceRequest(ServiceConsul, RoleServer, "", time.Hour)
+	is.Equal(err.Error(), "consul certificates require a location")
+
+	_, err = ServiceRequest(ServiceConsul, "agent", "dc1", time.Hour)
+	is.Equal(err.Error(), "unknown role: agent")
+
+	_, err = ServiceRequest("boundary", RoleServer, "dc1", time.Hour)
+	is.Equal(err.Error(), "unknown service: boundary")
+}
@@ -2,13 +2,18 @@ package cli
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
 var Test string = "test"
 
+var ErrSecretExists = errors.New("secret already exists")
 var ErrSecretNotFound = errors.New("secret not found")
+var ErrUnsupported = errors.New("operation not supported by backend")
+var ErrVersionNotFound = errors.New("secret version not found")
 
 // SecretProvider represents a backend capable of storing sensitive data using a
 // key/value format.
@@ -16,10 +21,6 @@ type SecretProvider interface {
 	// Deletes the secret with the given key
 	Delete(key string) error
 
-	// Generates a new random secret value with the given key. Overwrites any
-	// previous value that existed with the key.
-	Generate(key string, length int, nums int, symbols int) (string, error)
-
 	// Returns the value of the secret with the given key
 	Get(key string) (string, error)
 
@@ -28,6 +29,96 @@ type SecretProvider interface {
 	Set(key string, value string) error
 }
 
+// SecretCreator is an optional interface implemented by a SecretProvider
+// capable of atomically creating a secret only if it doesn't already exist.
+type SecretCreator interface {
+	// Sets the value of the secret with the given key only if no secret exists
+	// with the key. Returns ErrSecretExists otherwise.
+	Create(key string, value string) error
+}
+
+// SecretAnnotatedCreator is an optional interface implemented by a
+// SecretCreator capable of storing a description and tags in the same request
+// which creates a secret.
+type SecretAnnotatedCreator interface {
+	// Sets the value of the secret with the given key along with its
+	// description and tags only if no secret exists with the key. Returns
+	// ErrSecretExists otherwise.
+	CreateAnnotated(key string, value string, description string, tags map[string]string) error
+}
+
+// SecretLister is an optional interface implemented by a SecretProvider
+// capable of enumerating the secrets it stores.
+type SecretLister interface {
+	// Returns metadata for the secrets under the given path prefix. If
+	// recursive is false, only secrets directly beneath the prefix are
+	// returned.
+	List(prefix string, recursive bool) ([]SecretMetadata, error)
+}
+
+// SecretMetadata describes a stored secret without revealing its value.
+type SecretMetadata struct {
+	Description  string            `json:"description,omitempty"`
+	Key          string            `json:"key"`
+	LastModified *time.Time        `json:"last_modified,omitempty"`
+	ModifiedBy   string            `json:"modified_by,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Type         string            `json:"type,omitempty"`
+	Version      int64             `json:"version,omitempty"`
+}
+
+// SecretAnnotator is an optional interface implemented by a SecretProvider
+// capable of storing a description and tags alongside its secrets.
+type SecretAnnotator interface {
+	// Returns the metadata of the secret with the given key, including its
+	// description and tags
+	Describe(key string) (SecretMetadata, error)
+
+	// Sets the value of the secret with the given key along with its
+	// description and tags. Existing tags which aren't given are kept.
+	SetAnnotated(key string, value string, description string, tags map[string]string) error
+}
+
+// SecretTagFilter is an optional interface implemented by a SecretLister
+// capable of filtering secrets by tag without describing each of them.
+type SecretTagFilter interface {
+	// Returns metadata for the secrets under the given path prefix which have
+	// all of the given tags. Only the matched tags are included in the
+	// returned metadata.
+	ListTagged(prefix string, recursive bool, tags map[string]string) ([]SecretMetadata, error)
+}
+
+// SecretVersioner is an optional interface implemented by a SecretProvider
+// which retains previous values of its secrets.
+type SecretVersioner interface {
+	// Returns the value of the given version of the secret with the given key
+	GetVersion(key string, version int64) (string, error)
+
+	// Returns the versions of the secret with the given key, oldest first
+	History(key string) ([]SecretVersion, error)
+}
+
+// SecretVersion describes a single version of a stored secret.
+type SecretVersion struct {
+	Deleted      bool       `json:"deleted,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	ModifiedBy   string     `json:"modified_by,omitempty"`
+	Version      int64      `json:"version"`
+}
+
+// MatchSecretPath returns whether the given key falls under the given path
+// prefix. If recursive is false, the key must be directly beneath the prefix.
+func MatchSecretPath(key string, prefix string, recursive bool) bool {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+
+	return recursive || !strings.Contains(strings.TrimPrefix(key, prefix), "/")
+}
+
 type SecretProviderConfig interface {
 	Flags() []cli.Flag
 }
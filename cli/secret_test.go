@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestMatchSecretPath(t *testing.T) {
+	is := is.New(t)
+
+	is.True(MatchSecretPath("/glab/test", "/glab", false))
+	is.True(MatchSecretPath("/glab/test", "/glab/", false))
+	is.True(!MatchSecretPath("/glab/nested/test", "/glab", false))
+	is.True(MatchSecretPath("/glab/nested/test", "/glab", true))
+	is.True(!MatchSecretPath("/glabs/test", "/glab", true))
+	is.True(MatchSecretPath("test", "", false))
+	is.True(!MatchSecretPath("nested/test", "", false))
+}
@@ -0,0 +1,206 @@
+// Package secretfile encodes and decodes flat maps of secrets to and from the
+// file formats supported by the secret import and export commands.
+package secretfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format is a file format for secrets.
+type Format string
+
+const (
+	FormatDotenv Format = "dotenv"
+	FormatJSON   Format = "json"
+	FormatYAML   Format = "yaml"
+
+	// EncryptedExt is the extension appended to encrypted secret files.
+	EncryptedExt = ".enc"
+)
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case FormatDotenv, "env":
+		return FormatDotenv, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatYAML, "yml":
+		return FormatYAML, nil
+	default:
+		return "", fmt.Errorf("invalid format: %s", name)
+	}
+}
+
+// FormatFromPath returns the Format matching the extension of the given path.
+// A trailing EncryptedExt is ignored.
+func FormatFromPath(path string) (Format, error) {
+	base := strings.TrimSuffix(filepath.Base(path), EncryptedExt)
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return FormatDotenv, nil
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(base), ".")
+	if ext == "" {
+		return "", fmt.Errorf("unable to determine format of %s", path)
+	}
+
+	return ParseFormat(ext)
+}
+
+// Marshal encodes the given secrets using the given format. Keys are always
+// written in sorted order.
+func Marshal(format Format, secrets map[string]string) ([]byte, error) {
+	switch format {
+	case FormatDotenv:
+		return marshalDotenv(secrets)
+	case FormatJSON:
+		data, err := json.MarshalIndent(secrets, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatYAML:
+		return yaml.Marshal(secrets)
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+}
+
+// Unmarshal decodes secrets from the given data using the given format. Only
+// flat maps of keys to scalar values are accepted.
+func Unmarshal(format Format, data []byte) (map[string]string, error) {
+	secrets := make(map[string]string)
+	switch format {
+	case FormatDotenv:
+		return unmarshalDotenv(data)
+	case FormatJSON:
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %s", err)
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &secrets); err != nil {
+			return nil, fmt.Errorf("error parsing YAML: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+
+	return secrets, nil
+}
+
+// marshalDotenv encodes secrets as KEY="VALUE" lines.
+func marshalDotenv(secrets map[string]string) ([]byte, error) {
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		if key == "" || strings.ContainsAny(key, "= \t\r\n\"'#") {
+			return nil, fmt.Errorf("key cannot be represented in dotenv format: %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s=\"%s\"\n", key, escapeDotenv(secrets[key]))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// unmarshalDotenv decodes KEY=VALUE lines. Blank lines, comments and a
+// leading "export" are ignored. Double quoted values support escape sequences
+// while single quoted values are taken literally.
+func unmarshalDotenv(data []byte) (map[string]string, error) {
+	secrets := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("error parsing dotenv: line %d: expected KEY=VALUE", n)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value, err := parseDotenvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing dotenv: line %d: %s", n, err)
+		}
+		secrets[key] = value
+	}
+
+	return secrets, scanner.Err()
+}
+
+// parseDotenvValue parses a single, possibly quoted, dotenv value.
+func parseDotenvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var value strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch raw[i] {
+			case '"':
+				return value.String(), nil
+			case '\\':
+				i++
+				if i == len(raw) {
+					return "", fmt.Errorf("unterminated quote")
+				}
+				switch raw[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 'r':
+					value.WriteByte('\r')
+				case 't':
+					value.WriteByte('\t')
+				default:
+					value.WriteByte(raw[i])
+				}
+			default:
+				value.WriteByte(raw[i])
+			}
+		}
+		return "", fmt.Errorf("unterminated quote")
+	default:
+		// Unquoted values end at an inline comment
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+}
+
+// escapeDotenv escapes a value for use within double quotes.
+func escapeDotenv(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		`$`, `\$`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+	).Replace(value)
+}
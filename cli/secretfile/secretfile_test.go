@@ -0,0 +1,108 @@
+package secretfile
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestFormatFromPath(t *testing.T) {
+	is := is.New(t)
+
+	tests := map[string]Format{
+		"secrets.yaml":     FormatYAML,
+		"secrets.yml":      FormatYAML,
+		"secrets.json":     FormatJSON,
+		"secrets.env":      FormatDotenv,
+		".env":             FormatDotenv,
+		".env.production":  FormatDotenv,
+		"secrets.yaml.enc": FormatYAML,
+		"dir/.env.enc":     FormatDotenv,
+	}
+	for path, expected := range tests {
+		format, err := FormatFromPath(path)
+		is.NoErr(err)
+		is.Equal(format, expected)
+	}
+
+	// With unknown extension
+	_, err := FormatFromPath("secrets.txt")
+	is.Equal(err.Error(), "invalid format: txt")
+
+	// With no extension
+	_, err = FormatFromPath("secrets")
+	is.Equal(err.Error(), "unable to determine format of secrets")
+}
+
+func TestRoundTrip(t *testing.T) {
+	is := is.New(t)
+	secrets := map[string]string{
+		"DB_PASSWORD": `p@ss "word" $HOME \ #1`,
+		"MULTILINE":   "line1\nline2\ttabbed",
+		"EMPTY":       "",
+	}
+
+	for _, format := range []Format{FormatDotenv, FormatJSON, FormatYAML} {
+		data, err := Marshal(format, secrets)
+		is.NoErr(err)
+
+		got, err := Unmarshal(format, data)
+		is.NoErr(err)
+		is.Equal(got, secrets)
+	}
+}
+
+func TestMarshalDotenv(t *testing.T) {
+	is := is.New(t)
+
+	data, err := Marshal(FormatDotenv, map[string]string{"B": "two", "A": "one"})
+	is.NoErr(err)
+	is.Equal(string(data), "A=\"one\"\nB=\"two\"\n")
+
+	// With unrepresentable key
+	_, err = Marshal(FormatDotenv, map[string]string{"a key": "value"})
+	is.Equal(err.Error(), `key cannot be represented in dotenv format: "a key"`)
+}
+
+func TestUnmarshalDotenv(t *testing.T) {
+	is := is.New(t)
+	data := `
+# Comment
+export EXPORTED=value
+UNQUOTED = some value # comment
+SINGLE='literal \n $HOME'
+DOUBLE="escaped\nvalue"
+PATH_LIKE=/glab/bootstrap/key=value
+`
+
+	secrets, err := Unmarshal(FormatDotenv, []byte(data))
+	is.NoErr(err)
+	is.Equal(secrets, map[string]string{
+		"EXPORTED":  "value",
+		"UNQUOTED":  "some value",
+		"SINGLE":    `literal \n $HOME`,
+		"DOUBLE":    "escaped\nvalue",
+		"PATH_LIKE": "/glab/bootstrap/key=value",
+	})
+
+	// With missing separator
+	_, err = Unmarshal(FormatDotenv, []byte("KEY\n"))
+	is.Equal(err.Error(), "error parsing dotenv: line 1: expected KEY=VALUE")
+
+	// With unterminated quote
+	_, err = Unmarshal(FormatDotenv, []byte("A=1\nKEY=\"value\n"))
+	is.Equal(err.Error(), "error parsing dotenv: line 2: unterminated quote")
+}
+
+func TestUnmarshalYAML(t *testing.T) {
+	is := is.New(t)
+
+	// With scalar values
+	secrets, err := Unmarshal(FormatYAML, []byte("port: 8080\nenabled: true\nname: test\n"))
+	is.NoErr(err)
+	is.Equal(secrets, map[string]string{"port": "8080", "enabled": "true", "name": "test"})
+
+	// With nested values
+	_, err = Unmarshal(FormatYAML, []byte("nested:\n  key: value\n"))
+	is.True(err != nil)
+}
@@ -0,0 +1,547 @@
+package sigstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_identity  = "sigstore-identity"
+	flag_issuer    = "sigstore-issuer"
+	flag_rekor_key = "sigstore-rekor-key"
+	flag_roots     = "sigstore-roots"
+
+	// noteSignaturePrefix starts each signature line of a signed note.
+	noteSignaturePrefix = "\u2014 "
+)
+
+var (
+	// oidIssuer is the Fulcio certificate extension containing the raw OIDC
+	// issuer URL.
+	oidIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+
+	// oidIssuerV2 is the Fulcio certificate extension containing the DER
+	// encoded OIDC issuer URL.
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// bundle is the offline verification bundle produced by cosign when signing
+// blobs with the --bundle flag.
+type bundle struct {
+	Base64Signature string      `json:"base64Signature"`
+	Cert            string      `json:"cert"`
+	RekorBundle     rekorBundle `json:"rekorBundle"`
+}
+
+// rekorBundle contains the signed promise of inclusion returned by Rekor when
+// the signature was uploaded to the transparency log. Bundles written by cosign
+// only carry the signed entry timestamp; a proof that the entry was included
+// in the log is verified when one is present.
+type rekorBundle struct {
+	SignedEntryTimestamp []byte          `json:"SignedEntryTimestamp"`
+	Payload              rekorPayload    `json:"Payload"`
+	InclusionProof       *inclusionProof `json:"inclusionProof,omitempty"`
+}
+
+// rekorPayload is the transparency log entry signed by Rekor.
+type rekorPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogIndex       int64  `json:"logIndex"`
+	LogID          string `json:"logID"`
+}
+
+// inclusionProof is a Merkle audit path proving a log entry is included in
+// the tree with the given root hash. The checkpoint is a note signed by Rekor
+// committing to the size and root hash of the tree.
+type inclusionProof struct {
+	Checkpoint string   `json:"checkpoint"`
+	LogIndex   int64    `json:"logIndex"`
+	RootHash   string   `json:"rootHash"`
+	TreeSize   int64    `json:"treeSize"`
+	Hashes     []string `json:"hashes"`
+}
+
+// hashedRekord is the body of a hashedrekord transparency log entry.
+type hashedRekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   string `json:"content"`
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// Verifier implements cli.Verifier by validating data offline against a
+// cosign bundle. The bundle's certificate must chain to the trusted Fulcio
+// roots and be issued to the configured identity by the configured issuer.
+// The bundle's transparency log entry must be signed by the trusted Rekor key
+// and match the signed data.
+type Verifier struct {
+	identity      string
+	intermediates *x509.CertPool
+	issuer        string
+	logID         string
+	rekorKey      crypto.PublicKey
+	roots         *x509.CertPool
+}
+
+func (v *Verifier) Extension() string {
+	return ".bundle"
+}
+
+func (v *Verifier) Verify(data io.Reader, signature io.Reader) (gcli.Signer, error) {
+	var b bundle
+	if err := json.NewDecoder(signature).Decode(&b); err != nil {
+		return gcli.Signer{}, fmt.Errorf("error parsing bundle: %s", err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, data); err != nil {
+		return gcli.Signer{}, err
+	}
+	digest := hash.Sum(nil)
+
+	signer, err := v.verify(b, digest)
+	if err != nil {
+		log.Errorf("Error validating bundle: %s", err)
+		return gcli.Signer{}, fmt.Errorf("%w: %s", gcli.ErrSigCheckFailed, err)
+	}
+
+	return signer, nil
+}
+
+// verify performs all checks against the given bundle for data with the given
+// SHA256 digest.
+func (v *Verifier) verify(b bundle, digest []byte) (gcli.Signer, error) {
+	cert, err := parseCertificate(b.Cert)
+	if err != nil {
+		return gcli.Signer{}, err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(b.Base64Signature)
+	if err != nil {
+		return gcli.Signer{}, fmt.Errorf("error decoding signature: %s", err)
+	}
+
+	// The log entry must be verified first as the integration time is used
+	// for validating the short-lived certificate.
+	if err := v.verifyEntry(b.RekorBundle, cert, sig, digest); err != nil {
+		return gcli.Signer{}, err
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		CurrentTime:   time.Unix(b.RekorBundle.Payload.IntegratedTime, 0),
+		Intermediates: v.intermediates,
+		Roots:         v.roots,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return gcli.Signer{}, fmt.Errorf("error validating certificate chain: %s", err)
+	}
+
+	identity, err := v.verifyIdentity(cert)
+	if err != nil {
+		return gcli.Signer{}, err
+	}
+
+	if err := verifySignature(cert.PublicKey, digest, sig); err != nil {
+		return gcli.Signer{}, err
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	return gcli.Signer{
+		Fingerprint: fmt.Sprintf("%X", fingerprint),
+		Identity:    identity,
+	}, nil
+}
+
+// verifyEntry validates the signed entry timestamp of the given transparency
+// log entry and checks that the entry records the given certificate,
+// signature, and digest. The entry's inclusion proof is validated if the
+// bundle contains one.
+func (v *Verifier) verifyEntry(rb rekorBundle, cert *x509.Certificate, sig []byte, digest []byte) error {
+	// Rekor identifies its log by the SHA256 hash of its public key
+	if rb.Payload.LogID != v.logID {
+		return fmt.Errorf("log entry is from untrusted log %q", rb.Payload.LogID)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"body":           rb.Payload.Body,
+		"integratedTime": rb.Payload.IntegratedTime,
+		"logIndex":       rb.Payload.LogIndex,
+		"logID":          rb.Payload.LogID,
+	})
+	if err != nil {
+		return err
+	}
+
+	set := sha256.Sum256(payload)
+	if err := verifySignature(v.rekorKey, set[:], rb.SignedEntryTimestamp); err != nil {
+		return fmt.Errorf("invalid signed entry timestamp: %s", err)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(rb.Payload.Body)
+	if err != nil {
+		return fmt.Errorf("error decoding log entry: %s", err)
+	}
+
+	if rb.InclusionProof != nil {
+		if err := v.verifyInclusion(*rb.InclusionProof, rb.Payload.LogIndex, body); err != nil {
+			return err
+		}
+	}
+
+	var entry hashedRekord
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("error parsing log entry: %s", err)
+	}
+
+	if entry.Kind != "hashedrekord" {
+		return fmt.Errorf("unsupported log entry kind: %s", entry.Kind)
+	}
+
+	if entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(digest) {
+		return errors.New("log entry does not match data")
+	}
+
+	entrySig, err := base64.StdEncoding.DecodeString(entry.Spec.Signature.Content)
+	if err != nil || !bytes.Equal(entrySig, sig) {
+		return errors.New("log entry does not match signature")
+	}
+
+	entryCert, err := parseCertificate(entry.Spec.Signature.PublicKey.Content)
+	if err != nil || !entryCert.Equal(cert) {
+		return errors.New("log entry does not match certificate")
+	}
+
+	return nil
+}
+
+// verifyIdentity checks that the given certificate was issued to the
+// configured identity by the configured issuer, returning the identity.
+func (v *Verifier) verifyIdentity(cert *x509.Certificate) (string, error) {
+	var issuer string
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuer):
+			issuer = string(ext.Value)
+		case ext.Id.Equal(oidIssuerV2):
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err != nil {
+				return "", fmt.Errorf("error parsing issuer extension: %s", err)
+			}
+		}
+	}
+
+	if issuer != v.issuer {
+		return "", fmt.Errorf("certificate issuer %q does not match %q", issuer, v.issuer)
+	}
+
+	identities := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+
+	for _, identity := range identities {
+		if identity == v.identity {
+			return identity, nil
+		}
+	}
+
+	return "", fmt.Errorf("certificate identities %v do not match %q", identities, v.identity)
+}
+
+// parseCertificate parses a PEM encoded certificate which may additionally be
+// base64 encoded.
+func parseCertificate(data string) (*x509.Certificate, error) {
+	raw := []byte(data)
+	if decoded, err := base64.StdEncoding.DecodeString(data); err == nil {
+		raw = decoded
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("error decoding certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// verifySignature validates the given signature over the given SHA256 digest
+// using the given public key.
+func verifySignature(key crypto.PublicKey, digest []byte, sig []byte) error {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig)
+	default:
+		return fmt.Errorf("unsupported public key type: %T", key)
+	}
+}
+
+// verifyInclusion validates the given inclusion proof for the log entry at the
+// given index. The proof's root hash and tree size must match a checkpoint
+// signed by the trusted Rekor key.
+func (v *Verifier) verifyInclusion(proof inclusionProof, logIndex int64, entry []byte) error {
+	if proof.LogIndex != logIndex {
+		return fmt.Errorf("inclusion proof index %d does not match log entry index %d", proof.LogIndex, logIndex)
+	}
+
+	size, root, err := v.verifyCheckpoint(proof.Checkpoint)
+	if err != nil {
+		return err
+	}
+
+	if size != proof.TreeSize || hex.EncodeToString(root) != proof.RootHash {
+		return errors.New("inclusion proof does not match signed checkpoint")
+	}
+
+	return verifyAuditPath(proof, entry)
+}
+
+// verifyCheckpoint validates the signature of the given checkpoint using the
+// trusted Rekor key and returns the tree size and root hash it commits to.
+// Checkpoints use the signed note format: an origin line, the tree size, and
+// the base64 root hash, followed by a blank line and one or more signature
+// lines.
+func (v *Verifier) verifyCheckpoint(note string) (int64, []byte, error) {
+	sep := strings.Index(note, "\n\n")
+	if sep < 0 {
+		return 0, nil, errors.New("invalid checkpoint: missing signatures")
+	}
+
+	text := note[:sep+1]
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) < 3 {
+		return 0, nil, errors.New("invalid checkpoint: missing tree size or root hash")
+	}
+
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid checkpoint tree size: %s", err)
+	}
+
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid checkpoint root hash: %s", err)
+	}
+
+	// Each signature is prefixed with a four byte hint identifying the key
+	digest := sha256.Sum256([]byte(text))
+	for _, line := range strings.Split(note[sep+2:], "\n") {
+		if !strings.HasPrefix(line, noteSignaturePrefix) {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, noteSignaturePrefix))
+		if len(fields) != 2 {
+			continue
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(sig) < 5 {
+			continue
+		}
+
+		if verifySignature(v.rekorKey, digest[:], sig[4:]) == nil {
+			return size, root, nil
+		}
+	}
+
+	return 0, nil, errors.New("checkpoint is not signed by the trusted Rekor key")
+}
+
+// verifyAuditPath validates the RFC 6962 audit path of the given inclusion
+// proof for the given log entry.
+func verifyAuditPath(proof inclusionProof, entry []byte) error {
+	if proof.LogIndex < 0 || proof.LogIndex >= proof.TreeSize {
+		return errors.New("invalid inclusion proof index")
+	}
+
+	hash := sha256.Sum256(append([]byte{0}, entry...))
+	root := hash[:]
+
+	fn, sn := proof.LogIndex, proof.TreeSize-1
+	for _, h := range proof.Hashes {
+		p, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("error decoding inclusion proof: %s", err)
+		}
+
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+
+		if fn%2 == 1 || fn == sn {
+			root = hashChildren(p, root)
+			for fn%2 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			root = hashChildren(root, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || hex.EncodeToString(root) != proof.RootHash {
+		return errors.New("inclusion proof does not match root hash")
+	}
+
+	return nil
+}
+
+// hashChildren returns the RFC 6962 hash of an interior node.
+func hashChildren(left, right []byte) []byte {
+	hash := sha256.New()
+	hash.Write([]byte{1})
+	hash.Write(left)
+	hash.Write(right)
+	return hash.Sum(nil)
+}
+
+// NewVerifier creates a new instance of Verifier using the given
+// configuration.
+func NewVerifier(config VerifierConfig) (*Verifier, error) {
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+
+	rest := config.roots
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Fulcio certificate: %s", err)
+		}
+
+		// Only self-signed certificates are trusted as roots
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			roots.AddCert(cert)
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	block, _ := pem.Decode(config.rekorKey)
+	if block == nil {
+		return nil, errors.New("error decoding Rekor public key")
+	}
+
+	rekorKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Rekor public key: %s", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(rekorKey)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding Rekor public key: %s", err)
+	}
+	logID := sha256.Sum256(der)
+
+	return &Verifier{
+		identity:      config.identity,
+		intermediates: intermediates,
+		issuer:        config.issuer,
+		logID:         hex.EncodeToString(logID[:]),
+		rekorKey:      rekorKey,
+		roots:         roots,
+	}, nil
+}
+
+// VerifierConfig provides the configuration details needed for instantiating
+// a new Verifier.
+type VerifierConfig struct {
+	identity string
+	issuer   string
+	rekorKey []byte
+	roots    []byte
+}
+
+// Flags returns the CLI flags that can be used to configure the Sigstore
+// verifier.
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  flag_identity,
+			Usage: "Expected signer identity (email or URI) in the Fulcio certificate",
+		},
+		&cli.StringFlag{
+			Name:  flag_issuer,
+			Usage: "Expected OIDC issuer in the Fulcio certificate",
+		},
+		&cli.StringFlag{
+			Name:  flag_roots,
+			Usage: "Path to the trusted Fulcio certificate chain (PEM)",
+		},
+		&cli.StringFlag{
+			Name:  flag_rekor_key,
+			Usage: "Path to the trusted Rekor public key (PEM)",
+		},
+	}
+}
+
+// NewVerifierConfig creates a new VerifierConfig by parsing CLI flags
+// contained within the passed cli.Context.
+func NewVerifierConfig(c *cli.Context) (VerifierConfig, error) {
+	for _, flag := range []string{flag_identity, flag_issuer, flag_roots, flag_rekor_key} {
+		if c.String(flag) == "" {
+			return VerifierConfig{}, fmt.Errorf("must supply --%s", flag)
+		}
+	}
+
+	roots, err := os.ReadFile(c.String(flag_roots))
+	if err != nil {
+		return VerifierConfig{}, err
+	}
+
+	rekorKey, err := os.ReadFile(c.String(flag_rekor_key))
+	if err != nil {
+		return VerifierConfig{}, err
+	}
+
+	return VerifierConfig{
+		identity: c.String(flag_identity),
+		issuer:   c.String(flag_issuer),
+		rekorKey: rekorKey,
+		roots:    roots,
+	}, nil
+}
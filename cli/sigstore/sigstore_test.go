@@ -0,0 +1,299 @@
+package sigstore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/matryer/is"
+)
+
+// The public key of rekor.sigstore.dev and the log ID it publishes for it.
+const (
+	productionRekorKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE2G2Y+2tabdTV5BcGiBIx0a9fAFwr
+kBbmLSGtks4L3qX6yYY0zufBnhC8Ur/iy55GhWP/9A/bY2LhC30M9+RYtw==
+-----END PUBLIC KEY-----
+`
+	productionLogID = "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d"
+)
+
+type testSigner struct {
+	cert     *x509.Certificate
+	certPEM  []byte
+	key      *ecdsa.PrivateKey
+	logID    string
+	rekorKey *ecdsa.PrivateKey
+}
+
+func newTestSigner(is *is.I, identity string, issuer string) (testSigner, VerifierConfig) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	is.NoErr(err)
+	caCert, err := x509.ParseCertificate(caDER)
+	is.NoErr(err)
+
+	issuerValue, err := asn1.Marshal(issuer)
+	is.NoErr(err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       now.Add(-time.Minute),
+		NotAfter:        now.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{identity},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuerValue}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	is.NoErr(err)
+	cert, err := x509.ParseCertificate(der)
+	is.NoErr(err)
+
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+	rekorDER, err := x509.MarshalPKIXPublicKey(&rekorKey.PublicKey)
+	is.NoErr(err)
+	logID := sha256.Sum256(rekorDER)
+
+	signer := testSigner{
+		cert:     cert,
+		certPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:      key,
+		logID:    hex.EncodeToString(logID[:]),
+		rekorKey: rekorKey,
+	}
+	config := VerifierConfig{
+		identity: identity,
+		issuer:   issuer,
+		rekorKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rekorDER}),
+		roots:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+	}
+
+	return signer, config
+}
+
+// checkpoint returns a checkpoint for the given tree signed by the given key.
+func checkpoint(is *is.I, key *ecdsa.PrivateKey, size int64, root []byte) string {
+	text := fmt.Sprintf("rekor.example.com - 1\n%d\n%s\n", size, base64.StdEncoding.EncodeToString(root))
+	digest := sha256.Sum256([]byte(text))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	is.NoErr(err)
+
+	hint := []byte{0, 0, 0, 0}
+	return fmt.Sprintf("%s\n\u2014 rekor.example.com %s\n", text, base64.StdEncoding.EncodeToString(append(hint, sig...)))
+}
+
+// sign returns a bundle for the given data. The log entry is included at index 1 of a tree of size 2.
+func (s testSigner) sign(is *is.I, data string) bundle {
+	digest := sha256.Sum256([]byte(data))
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	is.NoErr(err)
+
+	var entry hashedRekord
+	entry.Kind = "hashedrekord"
+	entry.Spec.Data.Hash.Algorithm = "sha256"
+	entry.Spec.Data.Hash.Value = hex.EncodeToString(digest[:])
+	entry.Spec.Signature.Content = base64.StdEncoding.EncodeToString(sig)
+	entry.Spec.Signature.PublicKey.Content = base64.StdEncoding.EncodeToString(s.certPEM)
+	body, err := json.Marshal(entry)
+	is.NoErr(err)
+
+	payload := rekorPayload{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: time.Now().Unix(),
+		LogIndex:       1,
+		LogID:          s.logID,
+	}
+	canonical, err := json.Marshal(map[string]interface{}{
+		"body":           payload.Body,
+		"integratedTime": payload.IntegratedTime,
+		"logIndex":       payload.LogIndex,
+		"logID":          payload.LogID,
+	})
+	is.NoErr(err)
+
+	set := sha256.Sum256(canonical)
+	setSig, err := ecdsa.SignASN1(rand.Reader, s.rekorKey, set[:])
+	is.NoErr(err)
+
+	other := sha256.Sum256([]byte("\x00other"))
+	leaf := sha256.Sum256(append([]byte{0}, body...))
+	root := hashChildren(other[:], leaf[:])
+
+	return bundle{
+		Base64Signature: base64.StdEncoding.EncodeToString(sig),
+		Cert:            base64.StdEncoding.EncodeToString(s.certPEM),
+		RekorBundle: rekorBundle{
+			SignedEntryTimestamp: setSig,
+			Payload:              payload,
+			InclusionProof: &inclusionProof{
+				Checkpoint: checkpoint(is, s.rekorKey, 2, root),
+				LogIndex:   1,
+				RootHash:   hex.EncodeToString(root),
+				TreeSize:   2,
+				Hashes:     []string{hex.EncodeToString(other[:])},
+			},
+		},
+	}
+}
+
+// cosignBundle returns the given bundle laid out as cosign sign-blob --bundle
+// writes it, which has no inclusion proof.
+func cosignBundle(b bundle) *strings.Reader {
+	return strings.NewReader(fmt.Sprintf(
+		`{"base64Signature":%q,"cert":%q,"rekorBundle":{"SignedEntryTimestamp":%q,"Payload":{"body":%q,"integratedTime":%d,"logIndex":%d,"logID":%q}}}`,
+		b.Base64Signature,
+		b.Cert,
+		base64.StdEncoding.EncodeToString(b.RekorBundle.SignedEntryTimestamp),
+		b.RekorBundle.Payload.Body,
+		b.RekorBundle.Payload.IntegratedTime,
+		b.RekorBundle.Payload.LogIndex,
+		b.RekorBundle.Payload.LogID,
+	))
+}
+
+func encode(is *is.I, b bundle) *bytes.Reader {
+	data, err := json.Marshal(b)
+	is.NoErr(err)
+	return bytes.NewReader(data)
+}
+
+func TestVerify(t *testing.T) {
+	is := is.New(t)
+	expected_data := "test"
+	signer, config := newTestSigner(is, "ci@example.com", "https://token.actions.githubusercontent.com")
+
+	verifier, err := NewVerifier(config)
+	is.NoErr(err)
+	is.Equal(verifier.Extension(), ".bundle")
+
+	// With no error
+	b := signer.sign(is, expected_data)
+	result, err := verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+	is.NoErr(err)
+	is.Equal(result.Identity, "ci@example.com")
+
+	fingerprint := sha256.Sum256(signer.cert.Raw)
+	is.Equal(result.Fingerprint, strings.ToUpper(hex.EncodeToString(fingerprint[:])))
+
+	// With a bundle written by cosign
+	result, err = verifier.Verify(strings.NewReader(expected_data), cosignBundle(b))
+	is.NoErr(err)
+	is.Equal(result.Identity, "ci@example.com")
+
+	_, err = verifier.Verify(strings.NewReader("tampered"), cosignBundle(b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+
+	// With tampered data
+	_, err = verifier.Verify(strings.NewReader("tampered"), encode(is, b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+
+	// With invalid inclusion proofs
+	valid := *b.RekorBundle.InclusionProof
+	forged := strings.Repeat("00", 32)
+	untrusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is.NoErr(err)
+
+	tests := []struct {
+		proof *inclusionProof
+		err   string
+	}{
+		{&inclusionProof{Checkpoint: valid.Checkpoint, LogIndex: 0, RootHash: valid.RootHash, TreeSize: 2, Hashes: valid.Hashes}, "inclusion proof index 0 does not match log entry index 1"},
+		{&inclusionProof{Checkpoint: valid.Checkpoint, LogIndex: 1, RootHash: forged, TreeSize: 2, Hashes: valid.Hashes}, "inclusion proof does not match signed checkpoint"},
+		{&inclusionProof{Checkpoint: checkpoint(is, untrusted, 2, make([]byte, 32)), LogIndex: 1, RootHash: forged, TreeSize: 2, Hashes: valid.Hashes}, "checkpoint is not signed by the trusted Rekor key"},
+		{&inclusionProof{Checkpoint: checkpoint(is, signer.rekorKey, 2, make([]byte, 32)), LogIndex: 1, RootHash: forged, TreeSize: 2, Hashes: valid.Hashes}, "inclusion proof does not match root hash"},
+		{&inclusionProof{Checkpoint: "invalid", LogIndex: 1}, "invalid checkpoint: missing signatures"},
+	}
+
+	for _, test := range tests {
+		b.RekorBundle.InclusionProof = test.proof
+		_, err = verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+		is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+		is.True(strings.HasSuffix(err.Error(), test.err))
+	}
+	b.RekorBundle.InclusionProof = &valid
+
+	// With an entry from another log
+	b.RekorBundle.Payload.LogID = productionLogID
+	_, err = verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+	is.True(strings.HasSuffix(err.Error(), fmt.Sprintf("log entry is from untrusted log %q", productionLogID)))
+	b.RekorBundle.Payload.LogID = signer.logID
+
+	// With tampered signed entry timestamp
+	b.RekorBundle.Payload.LogIndex = 2
+	_, err = verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+
+	// With mismatched identity
+	config.identity = "other@example.com"
+	verifier, err = NewVerifier(config)
+	is.NoErr(err)
+
+	b = signer.sign(is, expected_data)
+	_, err = verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+
+	// With mismatched issuer
+	config.identity = "ci@example.com"
+	config.issuer = "https://accounts.google.com"
+	verifier, err = NewVerifier(config)
+	is.NoErr(err)
+
+	_, err = verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+
+	// With untrusted root
+	_, other_config := newTestSigner(is, "ci@example.com", "https://token.actions.githubusercontent.com")
+	config.issuer = "https://token.actions.githubusercontent.com"
+	config.roots = other_config.roots
+	verifier, err = NewVerifier(config)
+	is.NoErr(err)
+
+	_, err = verifier.Verify(strings.NewReader(expected_data), encode(is, b))
+	is.True(errors.Is(err, gcli.ErrSigCheckFailed))
+}
+
+func TestNewVerifier(t *testing.T) {
+	is := is.New(t)
+
+	// With the public Rekor instance's key
+	verifier, err := NewVerifier(VerifierConfig{rekorKey: []byte(productionRekorKey)})
+	is.NoErr(err)
+	is.Equal(verifier.logID, productionLogID)
+
+	// With invalid Rekor key
+	_, err = NewVerifier(VerifierConfig{rekorKey: []byte("invalid")})
+	is.Equal(err.Error(), "error decoding Rekor public key")
+}
@@ -0,0 +1,140 @@
+// Package sshca provides a minimal SSH certificate authority for issuing host
+// and user certificates during bootstrap, before Vault is available to act as
+// the SSH CA.
+package sshca
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The extensions OpenSSH grants to user certificates by default.
+const (
+	ExtensionAgentForwarding = "permit-agent-forwarding"
+	ExtensionPortForwarding  = "permit-port-forwarding"
+	ExtensionPTY             = "permit-pty"
+	ExtensionUserRC          = "permit-user-rc"
+	ExtensionX11Forwarding   = "permit-X11-forwarding"
+)
+
+// DefaultUserExtensions returns the extensions ssh-keygen grants to user
+// certificates unless told otherwise.
+func DefaultUserExtensions() map[string]string {
+	return map[string]string{
+		ExtensionAgentForwarding: "",
+		ExtensionPortForwarding:  "",
+		ExtensionPTY:             "",
+		ExtensionUserRC:          "",
+		ExtensionX11Forwarding:   "",
+	}
+}
+
+// Request describes a certificate to be signed by the CA.
+type Request struct {
+	// CertType is either ssh.HostCert or ssh.UserCert.
+	CertType uint32
+
+	// CriticalOptions restrict how a user certificate may be used, such as
+	// force-command or source-address.
+	CriticalOptions map[string]string
+
+	// Extensions grant optional features to a user certificate.
+	Extensions map[string]string
+
+	// KeyID identifies the certificate in the logs of the SSH server.
+	KeyID string
+
+	// Principals are the hostnames or usernames the certificate is valid for.
+	Principals []string
+
+	// The window the certificate is valid in.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// Validate returns an error if the request can't be signed.
+func (r Request) Validate() error {
+	switch r.CertType {
+	case ssh.HostCert:
+		if len(r.CriticalOptions) > 0 || len(r.Extensions) > 0 {
+			return fmt.Errorf("host certificates can't have critical options or extensions")
+		}
+	case ssh.UserCert:
+	default:
+		return fmt.Errorf("unknown certificate type: %d", r.CertType)
+	}
+
+	// OpenSSH treats a certificate without principals as valid for any
+	if len(r.Principals) == 0 {
+		return fmt.Errorf("certificate must have at least one principal")
+	}
+
+	if !r.ValidBefore.After(r.ValidAfter) {
+		return fmt.Errorf("certificate must be valid before %s", r.ValidAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Sign returns a certificate for the given public key signed by the CA.
+func Sign(ca ssh.Signer, key ssh.PublicKey, req Request) (*ssh.Certificate, error) {
+	return sign(rand.Reader, ca, key, req)
+}
+
+// sign returns a certificate signed using randomness read from r.
+func sign(r io.Reader, ca ssh.Signer, key ssh.PublicKey, req Request) (*ssh.Certificate, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	var serial [8]byte
+	if _, err := io.ReadFull(r, serial[:]); err != nil {
+		return nil, fmt.Errorf("failed reading random data: %s", err)
+	}
+
+	cert := &ssh.Certificate{
+		CertType:        req.CertType,
+		Key:             key,
+		KeyId:           req.KeyID,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		ValidAfter:      uint64(req.ValidAfter.Unix()),
+		ValidBefore:     uint64(req.ValidBefore.Unix()),
+		ValidPrincipals: req.Principals,
+		Permissions: ssh.Permissions{
+			CriticalOptions: req.CriticalOptions,
+			Extensions:      req.Extensions,
+		},
+	}
+
+	if err := cert.SignCert(r, newCASigner(ca)); err != nil {
+		return nil, fmt.Errorf("error signing certificate: %s", err)
+	}
+
+	return cert, nil
+}
+
+// rsaSigner signs using SHA-512 instead of the SHA-1 signatures OpenSSH no
+// longer accepts from certificate authorities.
+type rsaSigner struct {
+	ssh.AlgorithmSigner
+}
+
+// Sign signs the data using the rsa-sha2-512 algorithm.
+func (s rsaSigner) Sign(r io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(r, data, ssh.SigAlgoRSASHA2512)
+}
+
+// newCASigner returns a signer for the CA which produces signatures OpenSSH
+// accepts.
+func newCASigner(ca ssh.Signer) ssh.Signer {
+	if signer, ok := ca.(ssh.AlgorithmSigner); ok && ca.PublicKey().Type() == ssh.KeyAlgoRSA {
+		return rsaSigner{signer}
+	}
+
+	return ca
+}
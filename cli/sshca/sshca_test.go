@@ -0,0 +1,94 @@
+package sshca
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	gen "github.com/HomeOperations/jmgilman/cli/generate"
+	"github.com/matryer/is"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSigner returns a signer for a new key of the given type.
+func newSigner(t *testing.T, typ string) ssh.Signer {
+	key := gen.SSHKey{Type: typ}
+	if typ == gen.SSHKeyRSA {
+		key.Bits = 2048
+	}
+
+	pair, err := key.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(pair.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func TestSign(t *testing.T) {
+	is := is.New(t)
+	host := newSigner(t, gen.SSHKeyED25519)
+	now := time.Now()
+
+	for _, typ := range []string{gen.SSHKeyED25519, gen.SSHKeyECDSA, gen.SSHKeyRSA} {
+		ca := newSigner(t, typ)
+
+		cert, err := Sign(ca, host.PublicKey(), Request{
+			CertType:    ssh.HostCert,
+			KeyID:       "node1",
+			Principals:  []string{"node1.glab.lan"},
+			ValidAfter:  now.Add(-time.Minute),
+			ValidBefore: now.Add(time.Hour),
+		})
+		is.NoErr(err)
+
+		if typ == gen.SSHKeyRSA {
+			is.Equal(cert.Signature.Format, ssh.SigAlgoRSASHA2512)
+		}
+
+		checker := ssh.CertChecker{
+			IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+				return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal())
+			},
+		}
+		is.NoErr(checker.CheckHostKey("node1.glab.lan:22", nil, cert))
+		is.True(checker.CheckHostKey("node2.glab.lan:22", nil, cert) != nil)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	is := is.New(t)
+	now := time.Now()
+	req := Request{
+		CertType:    ssh.UserCert,
+		Extensions:  DefaultUserExtensions(),
+		Principals:  []string{"ops"},
+		ValidAfter:  now,
+		ValidBefore: now.Add(time.Hour),
+	}
+	is.NoErr(req.Validate())
+
+	// With host extensions
+	req.CertType = ssh.HostCert
+	is.Equal(req.Validate().Error(), "host certificates can't have critical options or extensions")
+
+	// With unknown type
+	req.CertType = 3
+	is.Equal(req.Validate().Error(), "unknown certificate type: 3")
+
+	// With no principals
+	req.CertType = ssh.UserCert
+	req.Principals = nil
+	is.Equal(req.Validate().Error(), "certificate must have at least one principal")
+
+	// With invalid window
+	req.Principals = []string{"ops"}
+	req.ValidBefore = now
+	is.True(strings.HasPrefix(req.Validate().Error(), "certificate must be valid before"))
+}
@@ -0,0 +1,220 @@
+// Package sysext provides functionality for building systemd-sysext images
+// which extend the read-only /usr tree of Flatcar Container Linux.
+package sysext
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+const (
+	binaryDir  = "usr/bin"
+	releaseDir = "usr/lib/extension-release.d"
+	unitDir    = "usr/lib/systemd/system"
+
+	// ext4Overhead is the additional space reserved in ext4 images for
+	// filesystem metadata.
+	ext4Overhead = 16 * 1024 * 1024
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Image describes the contents of a systemd-sysext image.
+type Image struct {
+	// Name is the name of the extension. The image file must be named after
+	// the extension for systemd-sysext to accept the extension-release file.
+	Name string
+
+	// ID must match the ID field of the host's os-release file.
+	ID string
+
+	// Level must match the SYSEXT_LEVEL field of the host's os-release file.
+	Level string
+
+	// Arch optionally restricts the extension to the given architecture
+	// using the systemd naming scheme (i.e. x86-64, arm64).
+	Arch string
+
+	// Binaries are paths to executables installed under /usr/bin.
+	Binaries []string
+
+	// Units are paths to systemd unit files installed under
+	// /usr/lib/systemd/system.
+	Units []string
+}
+
+// ExtensionRelease returns the contents of the image's extension-release file.
+func (i Image) ExtensionRelease() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ID=%s\n", i.ID)
+	fmt.Fprintf(&b, "SYSEXT_LEVEL=%s\n", i.Level)
+	if i.Arch != "" {
+		fmt.Fprintf(&b, "ARCHITECTURE=%s\n", i.Arch)
+	}
+
+	return b.String()
+}
+
+// Validate returns an error if the image can't be built.
+func (i Image) Validate() error {
+	if !validName.MatchString(i.Name) {
+		return fmt.Errorf("invalid extension name: %q", i.Name)
+	}
+	if i.ID == "" {
+		return fmt.Errorf("must supply an ID")
+	}
+	if i.Level == "" {
+		return fmt.Errorf("must supply a SYSEXT_LEVEL")
+	}
+	if len(i.Binaries) == 0 && len(i.Units) == 0 {
+		return fmt.Errorf("must supply at least one binary or unit file")
+	}
+
+	return nil
+}
+
+// Stage lays out the contents of the image in the given directory.
+func Stage(fs afero.Fs, dir string, image Image) error {
+	if err := image.Validate(); err != nil {
+		return err
+	}
+
+	for _, binary := range image.Binaries {
+		if err := install(fs, binary, filepath.Join(dir, binaryDir), 0755); err != nil {
+			return err
+		}
+	}
+
+	for _, unit := range image.Units {
+		if err := install(fs, unit, filepath.Join(dir, unitDir), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := fs.MkdirAll(filepath.Join(dir, releaseDir), 0755); err != nil {
+		return err
+	}
+
+	release := filepath.Join(dir, releaseDir, "extension-release."+image.Name)
+	log.WithFields(log.Fields{
+		"path": release,
+		"id":   image.ID,
+	}).Debug("Writing extension-release file")
+
+	return afero.WriteFile(fs, release, []byte(image.ExtensionRelease()), 0644)
+}
+
+// install copies the given file into the given directory with the given mode.
+func install(fs afero.Fs, src string, dir string, mode os.FileMode) error {
+	in, err := fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(dir, filepath.Base(src))
+	log.Debugf("Installing %s to %s", src, dst)
+
+	out, err := fs.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// Packer is an interface for packing a staged directory into an image file.
+type Packer interface {
+	// Pack packs the contents of dir into the image file at output.
+	Pack(dir string, output string) error
+}
+
+// runner is an interface for running external commands.
+type runner interface {
+	Run(name string, args ...string) error
+}
+
+// execRunner implements runner using the exec package.
+type execRunner struct{}
+
+func (e *execRunner) Run(name string, args ...string) error {
+	log.Infof("Running %s %s", name, strings.Join(args, " "))
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error running %s: %s: %s", name, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// SquashfsPacker implements Packer by packing images as squashfs using
+// mksquashfs.
+type SquashfsPacker struct {
+	runner runner
+}
+
+func (s *SquashfsPacker) Pack(dir string, output string) error {
+	return s.runner.Run("mksquashfs", dir, output, "-all-root", "-noappend", "-quiet")
+}
+
+// Ext4Packer implements Packer by packing images as raw ext4 using mkfs.ext4.
+type Ext4Packer struct {
+	fs     afero.Fs
+	runner runner
+}
+
+func (e *Ext4Packer) Pack(dir string, output string) error {
+	var size int64
+	err := afero.Walk(e.fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// mkfs.ext4 requires the image file to exist at its final size
+	size = (size*2 + ext4Overhead + 4095) / 4096 * 4096
+	f, err := e.fs.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return e.runner.Run("mkfs.ext4", "-q", "-F", "-E", "root_owner=0:0", "-d", dir, output)
+}
+
+// NewPacker returns the Packer for the given image format (squashfs or ext4).
+func NewPacker(format string) (Packer, error) {
+	switch format {
+	case "squashfs":
+		return &SquashfsPacker{runner: &execRunner{}}, nil
+	case "ext4":
+		return &Ext4Packer{fs: afero.NewOsFs(), runner: &execRunner{}}, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+}
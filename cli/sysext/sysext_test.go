@@ -0,0 +1,107 @@
+package sysext
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/spf13/afero"
+)
+
+type mockRunner struct {
+	fnRun func(name string, args ...string) error
+}
+
+func (m *mockRunner) Run(name string, args ...string) error {
+	return m.fnRun(name, args...)
+}
+
+func TestExtensionRelease(t *testing.T) {
+	is := is.New(t)
+
+	image := Image{Name: "consul", ID: "flatcar", Level: "1.0"}
+	is.Equal(image.ExtensionRelease(), "ID=flatcar\nSYSEXT_LEVEL=1.0\n")
+
+	image.Arch = "x86-64"
+	is.Equal(image.ExtensionRelease(), "ID=flatcar\nSYSEXT_LEVEL=1.0\nARCHITECTURE=x86-64\n")
+}
+
+func TestStage(t *testing.T) {
+	is := is.New(t)
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "bin/consul", []byte("binary"), 0644)
+	afero.WriteFile(fs, "units/consul.service", []byte("unit"), 0644)
+
+	// With no error
+	image := Image{
+		Name:     "consul",
+		ID:       "flatcar",
+		Level:    "1.0",
+		Binaries: []string{"bin/consul"},
+		Units:    []string{"units/consul.service"},
+	}
+	is.NoErr(Stage(fs, "stage", image))
+
+	data, err := afero.ReadFile(fs, "stage/usr/bin/consul")
+	is.NoErr(err)
+	is.Equal(string(data), "binary")
+
+	info, err := fs.Stat("stage/usr/bin/consul")
+	is.NoErr(err)
+	is.Equal(info.Mode().Perm(), os.FileMode(0755))
+
+	data, err = afero.ReadFile(fs, "stage/usr/lib/systemd/system/consul.service")
+	is.NoErr(err)
+	is.Equal(string(data), "unit")
+
+	data, err = afero.ReadFile(fs, "stage/usr/lib/extension-release.d/extension-release.consul")
+	is.NoErr(err)
+	is.Equal(string(data), image.ExtensionRelease())
+
+	// With missing binary
+	image.Binaries = []string{"bin/missing"}
+	is.True(Stage(fs, "stage", image) != nil)
+
+	// With invalid name
+	image.Name = "../consul"
+	is.Equal(Stage(fs, "stage", image).Error(), `invalid extension name: "../consul"`)
+
+	// With no contents
+	image = Image{Name: "consul", ID: "flatcar", Level: "1.0"}
+	is.Equal(Stage(fs, "stage", image).Error(), "must supply at least one binary or unit file")
+}
+
+func TestPack(t *testing.T) {
+	is := is.New(t)
+
+	var got []string
+	runner := &mockRunner{
+		fnRun: func(name string, args ...string) error {
+			got = append([]string{name}, args...)
+			return nil
+		},
+	}
+
+	// With squashfs
+	squashfs := SquashfsPacker{runner: runner}
+	is.NoErr(squashfs.Pack("stage", "consul.raw"))
+	is.Equal(strings.Join(got, " "), "mksquashfs stage consul.raw -all-root -noappend -quiet")
+
+	// With ext4
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "stage/usr/bin/consul", []byte("binary"), 0755)
+
+	ext4 := Ext4Packer{fs: fs, runner: runner}
+	is.NoErr(ext4.Pack("stage", "consul.raw"))
+	is.Equal(strings.Join(got, " "), "mkfs.ext4 -q -F -E root_owner=0:0 -d stage consul.raw")
+
+	info, err := fs.Stat("consul.raw")
+	is.NoErr(err)
+	is.True(info.Size() >= ext4Overhead)
+	is.Equal(info.Size()%4096, int64(0))
+
+	// With invalid format
+	_, err = NewPacker("zip")
+	is.Equal(err.Error(), "invalid format: zip")
+}
@@ -0,0 +1,517 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flag_address     = "vault-address"
+	flag_auth_method = "vault-auth-method"
+	flag_auth_mount  = "vault-auth-mount"
+	flag_mount       = "vault-mount"
+	flag_namespace   = "vault-namespace"
+	flag_password    = "vault-password"
+	flag_role_id     = "vault-role-id"
+	flag_secret_id   = "vault-secret-id"
+	flag_token       = "vault-token"
+	flag_username    = "vault-username"
+)
+
+// errNotFound is returned by send when the API responds with a 404.
+var errNotFound = errors.New("not found")
+
+// errCASMismatch is returned by send when a write is rejected because its
+// check-and-set version doesn't match the current version of the secret.
+var errCASMismatch = errors.New("check-and-set parameter did not match the current version")
+
+// httpClient is an interface for sending HTTP requests.
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// SecretProvider implements bootstrap.SecretProvider using a Vault KV version 2
+// secrets engine as the backend. Each secret is stored as a single "value"
+// field at the path matching its key.
+type SecretProvider struct {
+	address   string
+	auth      authenticator
+	client    httpClient
+	mount     string
+	namespace string
+	token     string
+}
+
+// Delete deletes all versions of the secret with the given key.
+func (s *SecretProvider) Delete(key string) error {
+	log.Infof("Sending delete request for key: %s", key)
+
+	// Vault doesn't report deleting a missing secret as an error
+	err := s.request(http.MethodGet, s.path("metadata", key), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.request(http.MethodDelete, s.path("metadata", key), nil, nil)
+}
+
+// Get returns the value of the latest version of the secret with the given
+// key.
+func (s *SecretProvider) Get(key string) (string, error) {
+	log.Infof("Sending get request for key: %s", key)
+	return s.get(s.path("data", key), key)
+}
+
+// GetVersion returns the value of the given version of the secret with the
+// given key.
+func (s *SecretProvider) GetVersion(key string, version int64) (string, error) {
+	log.Infof("Sending get request for key: %s (version %d)", key, version)
+
+	value, err := s.get(fmt.Sprintf("%s?version=%d", s.path("data", key), version), key)
+	if err == gcli.ErrSecretNotFound {
+		// Vault doesn't distinguish missing versions from missing secrets
+		if _, merr := s.metadata(key); merr == nil {
+			return "", gcli.ErrVersionNotFound
+		}
+	}
+
+	return value, err
+}
+
+// History returns the versions of the secret with the given key. Vault doesn't
+// record the identity which created each version.
+func (s *SecretProvider) History(key string) ([]gcli.SecretVersion, error) {
+	log.Infof("Sending history request for key: %s", key)
+
+	var out struct {
+		Data struct {
+			Versions map[string]struct {
+				CreatedTime  time.Time `json:"created_time"`
+				DeletionTime string    `json:"deletion_time"`
+				Destroyed    bool      `json:"destroyed"`
+			} `json:"versions"`
+		} `json:"data"`
+	}
+	if err := s.request(http.MethodGet, s.path("metadata", key), nil, &out); err != nil {
+		return nil, err
+	}
+
+	versions := make([]gcli.SecretVersion, 0, len(out.Data.Versions))
+	for v, meta := range out.Data.Versions {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Vault response: invalid version %s", v)
+		}
+
+		created := meta.CreatedTime
+		versions = append(versions, gcli.SecretVersion{
+			Deleted:      meta.Destroyed || meta.DeletionTime != "",
+			LastModified: &created,
+			Version:      version,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	return versions, nil
+}
+
+// get returns the value field of the secret at the given API path.
+func (s *SecretProvider) get(path string, key string) (string, error) {
+	var out struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := s.request(http.MethodGet, path, nil, &out); err != nil {
+		return "", err
+	}
+
+	value, ok := out.Data.Data["value"].(string)
+	if !ok {
+		return "", fmt.Errorf("secret at %s does not contain a value field", key)
+	}
+
+	return value, nil
+}
+
+// List returns metadata for the secrets under the given path prefix, walking
+// nested paths if recursive is true.
+func (s *SecretProvider) List(prefix string, recursive bool) ([]gcli.SecretMetadata, error) {
+	log.Infof("Sending list request for prefix: %s", prefix)
+
+	path := strings.Trim(prefix, "/")
+	if path != "" {
+		path += "/"
+	}
+
+	var out struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := s.request("LIST", strings.TrimSuffix(s.path("metadata", path), "/")+"/", nil, &out)
+	if err == gcli.ErrSecretNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var secrets []gcli.SecretMetadata
+	for _, key := range out.Data.Keys {
+		if strings.HasSuffix(key, "/") {
+			if !recursive {
+				continue
+			}
+
+			nested, err := s.List(path+key, true)
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, nested...)
+			continue
+		}
+
+		metadata, err := s.metadata(path + key)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, metadata)
+	}
+
+	return secrets, nil
+}
+
+// metadata returns the metadata of the secret with the given key.
+func (s *SecretProvider) metadata(key string) (gcli.SecretMetadata, error) {
+	var out struct {
+		Data struct {
+			CurrentVersion int64     `json:"current_version"`
+			UpdatedTime    time.Time `json:"updated_time"`
+		} `json:"data"`
+	}
+	if err := s.request(http.MethodGet, s.path("metadata", key), nil, &out); err != nil {
+		return gcli.SecretMetadata{}, err
+	}
+
+	return gcli.SecretMetadata{
+		Key:          key,
+		LastModified: &out.Data.UpdatedTime,
+		Type:         "kv-v2",
+		Version:      out.Data.CurrentVersion,
+	}, nil
+}
+
+// Set sets the value of the secret with the given key. Overwrites any previous
+// value that existed with the key.
+func (s *SecretProvider) Set(key string, value string) error {
+	log.Infof("Sending set request for key: %s", key)
+
+	in := map[string]interface{}{
+		"data": map[string]string{"value": value},
+	}
+	return s.request(http.MethodPost, s.path("data", key), in, nil)
+}
+
+// Create sets the value of the secret with the given key only if it doesn't
+// already exist, using a check-and-set version of zero.
+func (s *SecretProvider) Create(key string, value string) error {
+	log.Infof("Sending create request for key: %s", key)
+
+	in := map[string]interface{}{
+		"data":    map[string]string{"value": value},
+		"options": map[string]int{"cas": 0},
+	}
+	err := s.request(http.MethodPost, s.path("data", key), in, nil)
+	if err == errCASMismatch {
+		return gcli.ErrSecretExists
+	}
+
+	return err
+}
+
+// path returns the API path for the given KV v2 endpoint and key.
+func (s *SecretProvider) path(endpoint string, key string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.Trim(s.mount, "/"), endpoint, strings.Trim(key, "/"))
+}
+
+// request sends an authenticated request to the given API path. The response,
+// if any, is decoded into out. A 404 response is returned as
+// ErrSecretNotFound.
+func (s *SecretProvider) request(method string, path string, in interface{}, out interface{}) error {
+	if s.token == "" && s.auth != nil {
+		token, err := s.auth.login(s)
+		if err != nil {
+			return fmt.Errorf("error authenticating with Vault: %s", err)
+		}
+		s.token = token
+	}
+
+	err := s.send(method, path, in, out)
+	if err == errNotFound {
+		return gcli.ErrSecretNotFound
+	}
+
+	return err
+}
+
+// send sends a request to the given API path using the current token.
+func (s *SecretProvider) send(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimRight(s.address, "/"), path)
+	log.Debugf("Sending %s request to %s", method, url)
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error querying Vault: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var verr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&verr)
+		if resp.StatusCode == http.StatusBadRequest && len(verr.Errors) == 1 && strings.HasPrefix(verr.Errors[0], errCASMismatch.Error()) {
+			return errCASMismatch
+		}
+		return fmt.Errorf("error querying Vault: %d: %s", resp.StatusCode, strings.Join(verr.Errors, ", "))
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing Vault response: %s", err)
+	}
+
+	return nil
+}
+
+// authenticator is an interface for exchanging credentials for a Vault token.
+type authenticator interface {
+	login(s *SecretProvider) (string, error)
+}
+
+// approleAuth authenticates using the AppRole auth method.
+type approleAuth struct {
+	mount    string
+	roleID   string
+	secretID string
+}
+
+func (a *approleAuth) login(s *SecretProvider) (string, error) {
+	log.Infof("Logging in with AppRole at %s", a.mount)
+	in := map[string]string{
+		"role_id":   a.roleID,
+		"secret_id": a.secretID,
+	}
+
+	return loginToken(s, fmt.Sprintf("auth/%s/login", a.mount), in)
+}
+
+// userpassAuth authenticates using the userpass auth method.
+type userpassAuth struct {
+	mount    string
+	username string
+	password string
+}
+
+func (u *userpassAuth) login(s *SecretProvider) (string, error) {
+	log.Infof("Logging in as %s at %s", u.username, u.mount)
+	in := map[string]string{
+		"password": u.password,
+	}
+
+	return loginToken(s, fmt.Sprintf("auth/%s/login/%s", u.mount, u.username), in)
+}
+
+// loginToken sends a login request to the given path and returns the client
+// token from the response.
+func loginToken(s *SecretProvider, path string, in interface{}) (string, error) {
+	var out struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := s.send(http.MethodPost, path, in, &out); err != nil {
+		return "", err
+	}
+
+	if out.Auth.ClientToken == "" {
+		return "", fmt.Errorf("login response did not contain a token")
+	}
+
+	return out.Auth.ClientToken, nil
+}
+
+// NewSecretProvider creates a new instance of SecretProvider using the given
+// configuration.
+func NewSecretProvider(config SecretProviderConfig) SecretProvider {
+	return SecretProvider{
+		address:   config.address,
+		auth:      config.auth,
+		client:    http.DefaultClient,
+		mount:     config.mount,
+		namespace: config.namespace,
+		token:     config.token,
+	}
+}
+
+// SecretProviderConfig provides the configuration details needed for
+// instantiating a new SecretProvider.
+type SecretProviderConfig struct {
+	address   string
+	auth      authenticator
+	mount     string
+	namespace string
+	token     string
+}
+
+// Flags returns the CLI flags that can be used to configure the Vault secret
+// provider.
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    flag_address,
+			Usage:   "Vault server address",
+			Value:   "http://127.0.0.1:8200",
+			EnvVars: []string{"VAULT_ADDR"},
+		},
+		&cli.StringFlag{
+			Name:  flag_auth_method,
+			Usage: "Vault auth method to use (token, approle, or userpass)",
+			Value: "token",
+		},
+		&cli.StringFlag{
+			Name:        flag_auth_mount,
+			Usage:       "Path the Vault auth method is mounted at",
+			DefaultText: "auth method name",
+		},
+		&cli.StringFlag{
+			Name:  flag_mount,
+			Usage: "Path the Vault KV v2 secrets engine is mounted at",
+			Value: "secret",
+		},
+		&cli.StringFlag{
+			Name:    flag_namespace,
+			Usage:   "Vault namespace",
+			EnvVars: []string{"VAULT_NAMESPACE"},
+		},
+		&cli.StringFlag{
+			Name:    flag_token,
+			Usage:   "Vault token used with the token auth method",
+			EnvVars: []string{"VAULT_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    flag_role_id,
+			Usage:   "Role ID used with the approle auth method",
+			EnvVars: []string{"VAULT_ROLE_ID"},
+		},
+		&cli.StringFlag{
+			Name:    flag_secret_id,
+			Usage:   "Secret ID used with the approle auth method",
+			EnvVars: []string{"VAULT_SECRET_ID"},
+		},
+		&cli.StringFlag{
+			Name:  flag_username,
+			Usage: "Username used with the userpass auth method",
+		},
+		&cli.StringFlag{
+			Name:    flag_password,
+			Usage:   "Password used with the userpass auth method",
+			EnvVars: []string{"VAULT_PASSWORD"},
+		},
+	}
+}
+
+// NewSecretProviderConfig creates a new SecretProviderConfig by parsing CLI
+// flags contained within the passed cli.Context.
+func NewSecretProviderConfig(c *cli.Context) (SecretProviderConfig, error) {
+	config := SecretProviderConfig{
+		address:   c.String(flag_address),
+		mount:     c.String(flag_mount),
+		namespace: c.String(flag_namespace),
+	}
+	if config.address == "" {
+		return SecretProviderConfig{}, fmt.Errorf("must supply a Vault address")
+	}
+	if config.mount == "" {
+		config.mount = "secret"
+	}
+
+	method := c.String(flag_auth_method)
+	mount := c.String(flag_auth_mount)
+	if mount == "" {
+		mount = method
+	}
+
+	switch method {
+	case "", "token":
+		if c.String(flag_token) == "" {
+			return SecretProviderConfig{}, fmt.Errorf("must supply a Vault token")
+		}
+		config.token = c.String(flag_token)
+	case "approle":
+		if c.String(flag_role_id) == "" || c.String(flag_secret_id) == "" {
+			return SecretProviderConfig{}, fmt.Errorf("must supply both role and secret IDs")
+		}
+		config.auth = &approleAuth{
+			mount:    mount,
+			roleID:   c.String(flag_role_id),
+			secretID: c.String(flag_secret_id),
+		}
+	case "userpass":
+		if c.String(flag_username) == "" || c.String(flag_password) == "" {
+			return SecretProviderConfig{}, fmt.Errorf("must supply both username and password")
+		}
+		config.auth = &userpassAuth{
+			mount:    mount,
+			username: c.String(flag_username),
+			password: c.String(flag_password),
+		}
+	default:
+		return SecretProviderConfig{}, fmt.Errorf("invalid auth method: %s", method)
+	}
+
+	log.Infof("Using Vault at %s", config.address)
+	return config, nil
+}
@@ -0,0 +1,352 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcli "github.com/HomeOperations/jmgilman/cli"
+	"github.com/matryer/is"
+	"github.com/urfave/cli/v2"
+)
+
+// devVault is a minimal stand-in for a dev-mode Vault server with a KV v2
+// secrets engine mounted at "secret" and the AppRole and userpass auth methods
+// enabled.
+type devVault struct {
+	mu         sync.Mutex
+	namespaces []string
+	secrets    map[string]map[string]interface{}
+	token      string
+}
+
+func (d *devVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.namespaces = append(d.namespaces, r.Header.Get("X-Vault-Namespace"))
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "auth/approle/login":
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["role_id"] != "role" || in["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":["invalid role or secret ID"]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"auth":{"client_token":"%s"}}`, d.token)
+		return
+	case path == "auth/userpass/login/admin":
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["password"] != "password" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":["invalid username or password"]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"auth":{"client_token":"%s"}}`, d.token)
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != d.token {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "secret/data/"):
+		key := strings.TrimPrefix(path, "secret/data/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := d.secrets[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[]}`)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": data},
+			})
+		case http.MethodPost:
+			var in struct {
+				Data    map[string]interface{} `json:"data"`
+				Options map[string]int         `json:"options"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			if cas, ok := in.Options["cas"]; ok && cas == 0 && d.secrets[key] != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"errors":["check-and-set parameter did not match the current version"]}`)
+				return
+			}
+			d.secrets[key] = in.Data
+			fmt.Fprint(w, `{"data":{"version":1}}`)
+		}
+	case strings.HasPrefix(path, "secret/metadata/"):
+		key := strings.TrimPrefix(path, "secret/metadata/")
+		switch r.Method {
+		case "LIST":
+			keys := make(map[string]bool)
+			for k := range d.secrets {
+				if strings.HasPrefix(k, key) {
+					rest := strings.TrimPrefix(k, key)
+					if i := strings.Index(rest, "/"); i >= 0 {
+						rest = rest[:i+1]
+					}
+					keys[rest] = true
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[]}`)
+				return
+			}
+			var list []string
+			for k := range keys {
+				list = append(list, k)
+			}
+			sort.Strings(list)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"keys": list},
+			})
+		case http.MethodGet:
+			if _, ok := d.secrets[key]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"errors":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"data":{"current_version":3,"updated_time":"2021-11-01T00:00:00Z"}}`)
+		case http.MethodDelete:
+			delete(d.secrets, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestProvider(address string) SecretProvider {
+	return SecretProvider{
+		address: address,
+		client:  http.DefaultClient,
+		mount:   "secret",
+		token:   "root",
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	is := is.New(t)
+	server := &devVault{secrets: make(map[string]map[string]interface{}), token: "root"}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	provider := newTestProvider(ts.URL)
+
+	// With missing key
+	_, err := provider.Get("glab/test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	err = provider.Delete("glab/test")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	// With set key
+	is.NoErr(provider.Set("glab/test", "value"))
+	is.Equal(server.secrets["glab/test"]["value"], "value")
+
+	value, err := provider.Get("glab/test")
+	is.NoErr(err)
+	is.Equal(value, "value")
+
+	// With created key
+	is.NoErr(provider.Create("glab/generated", "generated"))
+	is.Equal(server.secrets["glab/generated"]["value"], "generated")
+
+	err = provider.Create("glab/generated", "other")
+	is.True(errors.Is(err, gcli.ErrSecretExists))
+	is.Equal(server.secrets["glab/generated"]["value"], "generated")
+
+	// With listed keys
+	is.NoErr(provider.Set("glab/nested/test", "value"))
+	modified := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	secrets, err := provider.List("glab", false)
+	is.NoErr(err)
+	is.Equal(secrets, []gcli.SecretMetadata{
+		{Key: "glab/generated", LastModified: &modified, Type: "kv-v2", Version: 3},
+		{Key: "glab/test", LastModified: &modified, Type: "kv-v2", Version: 3},
+	})
+
+	secrets, err = provider.List("glab", true)
+	is.NoErr(err)
+	is.Equal(len(secrets), 3)
+	is.Equal(secrets[1].Key, "glab/nested/test")
+
+	secrets, err = provider.List("missing", true)
+	is.NoErr(err)
+	is.Equal(len(secrets), 0)
+
+	// With deleted key
+	is.NoErr(provider.Delete("glab/test"))
+	_, ok := server.secrets["glab/test"]
+	is.True(!ok)
+
+	// With secret missing a value field
+	server.secrets["glab/other"] = map[string]interface{}{"password": "value"}
+	_, err = provider.Get("glab/other")
+	is.Equal(err.Error(), "secret at glab/other does not contain a value field")
+
+	// With namespace
+	provider.namespace = "glab"
+	_, err = provider.Get("glab/generated")
+	is.NoErr(err)
+	is.Equal(server.namespaces[len(server.namespaces)-1], "glab")
+
+	// With invalid token
+	provider = newTestProvider(ts.URL)
+	provider.token = "invalid"
+	_, err = provider.Get("glab/generated")
+	is.Equal(err.Error(), "error querying Vault: 403: permission denied")
+}
+
+func TestHistory(t *testing.T) {
+	is := is.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/secret/metadata/glab/test":
+			fmt.Fprint(w, `{"data":{"current_version":3,"versions":{
+				"1":{"created_time":"2021-11-01T00:00:00Z","deletion_time":"","destroyed":true},
+				"3":{"created_time":"2021-11-03T00:00:00Z","deletion_time":"","destroyed":false},
+				"2":{"created_time":"2021-11-02T00:00:00Z","deletion_time":"2021-11-04T00:00:00Z","destroyed":false}
+			}}}`)
+		case r.URL.Path == "/v1/secret/data/glab/test" && r.URL.Query().Get("version") == "2":
+			fmt.Fprint(w, `{"data":{"data":{"value":"old"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+		}
+	}))
+	defer ts.Close()
+
+	provider := newTestProvider(ts.URL)
+
+	// With versions
+	versions, err := provider.History("glab/test")
+	is.NoErr(err)
+	is.Equal(len(versions), 3)
+	is.Equal(versions[0].Version, int64(1))
+	is.True(versions[0].Deleted)
+	is.True(versions[1].Deleted)
+	is.True(!versions[2].Deleted)
+	is.Equal(*versions[2].LastModified, time.Date(2021, 11, 3, 0, 0, 0, 0, time.UTC))
+
+	// With version
+	value, err := provider.GetVersion("glab/test", 2)
+	is.NoErr(err)
+	is.Equal(value, "old")
+
+	// With missing version
+	_, err = provider.GetVersion("glab/test", 9)
+	is.True(errors.Is(err, gcli.ErrVersionNotFound))
+
+	// With missing key
+	_, err = provider.GetVersion("glab/missing", 1)
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+
+	_, err = provider.History("glab/missing")
+	is.True(errors.Is(err, gcli.ErrSecretNotFound))
+}
+
+func TestAuth(t *testing.T) {
+	is := is.New(t)
+	server := &devVault{
+		secrets: map[string]map[string]interface{}{"test": {"value": "value"}},
+		token:   "login",
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// With AppRole
+	provider := newTestProvider(ts.URL)
+	provider.token = ""
+	provider.auth = &approleAuth{mount: "approle", roleID: "role", secretID: "secret"}
+	value, err := provider.Get("test")
+	is.NoErr(err)
+	is.Equal(value, "value")
+	is.Equal(provider.token, "login")
+
+	// With userpass
+	provider.token = ""
+	provider.auth = &userpassAuth{mount: "userpass", username: "admin", password: "password"}
+	_, err = provider.Get("test")
+	is.NoErr(err)
+	is.Equal(provider.token, "login")
+
+	// With invalid credentials
+	provider.token = ""
+	provider.auth = &userpassAuth{mount: "userpass", username: "admin", password: "wrong"}
+	_, err = provider.Get("test")
+	is.Equal(err.Error(), "error authenticating with Vault: error querying Vault: 400: invalid username or password")
+}
+
+func TestNewSecretProviderConfig(t *testing.T) {
+	is := is.New(t)
+	for _, env := range []string{"VAULT_ADDR", "VAULT_NAMESPACE", "VAULT_TOKEN"} {
+		t.Setenv(env, "") // Restores the environment after the test
+		os.Unsetenv(env)
+	}
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("test", 0)
+		for _, f := range Flags() {
+			is.NoErr(f.Apply(set))
+		}
+		is.NoErr(set.Parse(args))
+		return cli.NewContext(&cli.App{}, set, nil)
+	}
+
+	// With token
+	config, err := NewSecretProviderConfig(newContext("--vault-token", "root", "--vault-namespace", "glab"))
+	is.NoErr(err)
+	is.Equal(config.address, "http://127.0.0.1:8200")
+	is.Equal(config.mount, "secret")
+	is.Equal(config.namespace, "glab")
+	is.Equal(config.token, "root")
+
+	// With missing token
+	_, err = NewSecretProviderConfig(newContext())
+	is.Equal(err.Error(), "must supply a Vault token")
+
+	// With AppRole
+	config, err = NewSecretProviderConfig(newContext(
+		"--vault-auth-method", "approle",
+		"--vault-auth-mount", "glab",
+		"--vault-role-id", "role",
+		"--vault-secret-id", "secret",
+	))
+	is.NoErr(err)
+	is.Equal(config.auth, &approleAuth{mount: "glab", roleID: "role", secretID: "secret"})
+
+	// With userpass
+	config, err = NewSecretProviderConfig(newContext(
+		"--vault-auth-method", "userpass",
+		"--vault-username", "admin",
+		"--vault-password", "password",
+	))
+	is.NoErr(err)
+	is.Equal(config.auth, &userpassAuth{mount: "userpass", username: "admin", password: "password"})
+
+	// With invalid auth method
+	_, err = NewSecretProviderConfig(newContext("--vault-auth-method", "ldap"))
+	is.Equal(err.Error(), "invalid auth method: ldap")
+}
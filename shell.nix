@@ -12,7 +12,9 @@ pkgs.mkShell {
   buildInputs = [
     boots
     pkgs.consul
+    pkgs.e2fsprogs
     pkgs.nomad
+    pkgs.squashfsTools
     pkgs.vault
     pkgs.vagrant
   ];